@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics 记录请求数（按路由模板与状态码）与耗时；未匹配的路由统一记为空，避免按原始路径产生大量序列
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		metrics.HTTPDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	}
+}
@@ -0,0 +1,57 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	grpcclient "github.com/CCDD2022/seckill-system/internal/client/grpc"
+)
+
+// HealthHandler 网关存活与就绪探针
+type HealthHandler struct {
+	clients *grpcclient.Clients
+	life    context.Context // 进程生命周期，收到退出信号后取消
+}
+
+func NewHealthHandler(clients *grpcclient.Clients, life context.Context) *HealthHandler {
+	return &HealthHandler{clients: clients, life: life}
+}
+
+// Livez 存活探针：进程能处理请求即返回 ok，不检查下游
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz 就绪探针：所有下游服务均为 SERVING 时返回 200，否则返回 503 及各服务不可用原因
+// 收到退出信号后立即返回 503，负载均衡先摘除流量再关闭
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	if h.life.Err() != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting_down"})
+		return
+	}
+	if h.clients == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not_ready", "reasons": []string{"grpc clients not initialized"}})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	services := h.clients.CheckHealth(ctx)
+	code, state := http.StatusOK, "ready"
+	for _, s := range services {
+		if !s.Ready {
+			code, state = http.StatusServiceUnavailable, "not_ready"
+			break
+		}
+	}
+	c.JSON(code, gin.H{"status": state, "services": services})
+}
+
+func (h *HealthHandler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/livez", h.Livez)
+	r.GET("/readyz", h.Readyz)
+}
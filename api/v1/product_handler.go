@@ -193,6 +193,7 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		return
 	}
 	req.ProductId = productID
+	req.Operator = operatorOf(c)
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
@@ -269,13 +270,172 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	})
 }
 
+// ListActiveSeckillProducts 获取正在秒杀的商品列表（由秒杀活动驱动）
+func (h *ProductHandler) ListActiveSeckillProducts(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.client.ListActiveSeckillProducts(ctx, &product.ListProductsRequest{
+		Page:     int32(page),
+		PageSize: int32(pageSize),
+	})
+	if err != nil {
+		st, _ := status.FromError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    e.ERROR,
+			"message": st.Message(),
+		})
+		return
+	}
+
+	if resp.GetCode() != e.SUCCESS {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    resp.GetCode(),
+			"message": resp.GetMessage(),
+		})
+		return
+	}
+
+	JSONProto(c, http.StatusOK, resp)
+}
+
+// stockRequest 库存调整请求体
+type stockRequest struct {
+	Quantity int32 `json:"quantity" binding:"required,gt=0"`
+}
+
+// DeductStock 扣减商品库存（管理员）
+func (h *ProductHandler) DeductStock(c *gin.Context) {
+	h.adjustStock(c, true)
+}
+
+// ReturnStock 归还商品库存（管理员）
+func (h *ProductHandler) ReturnStock(c *gin.Context) {
+	h.adjustStock(c, false)
+}
+
+// adjustStock 扣减/归还库存的公共处理
+func (h *ProductHandler) adjustStock(c *gin.Context, deduct bool) {
+	if username, ok := c.Get("username"); !ok || username.(string) != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    e.ERROR,
+			"message": "forbidden: admin only",
+		})
+		return
+	}
+	productID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    e.INVALID_PARAMS,
+			"message": e.GetMsg(e.INVALID_PARAMS),
+		})
+		return
+	}
+	var req stockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    e.INVALID_PARAMS,
+			"message": e.GetMsg(e.INVALID_PARAMS),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var success bool
+	var message string
+	if deduct {
+		resp, rpcErr := h.client.DeductStock(ctx, &product.DeductStockRequest{ProductId: productID, Quantity: req.Quantity, Operator: operatorOf(c)})
+		err = rpcErr
+		success, message = resp.GetSuccess(), resp.GetMessage()
+	} else {
+		resp, rpcErr := h.client.ReturnStock(ctx, &product.ReturnStockRequest{ProductId: productID, Quantity: req.Quantity, Operator: operatorOf(c)})
+		err = rpcErr
+		success, message = resp.GetSuccess(), resp.GetMessage()
+	}
+	if err != nil {
+		st, _ := status.FromError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    e.ERROR,
+			"message": st.Message(),
+		})
+		return
+	}
+
+	if !success {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    e.ERROR,
+			"message": message,
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    e.SUCCESS,
+		"message": message,
+		"success": true,
+	})
+}
+
+// ListStockLogs 查询商品（或指定秒杀活动）的库存变更流水（管理员）
+func (h *ProductHandler) ListStockLogs(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	productID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": e.INVALID_PARAMS, "message": e.GetMsg(e.INVALID_PARAMS)})
+		return
+	}
+	activityID, _ := strconv.ParseInt(c.DefaultQuery("activity_id", "0"), 10, 64)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.client.ListStockLogs(ctx, &product.ListStockLogsRequest{
+		ProductId:  productID,
+		ActivityId: activityID,
+		Page:       int32(page),
+		PageSize:   int32(pageSize),
+	})
+	if err != nil {
+		st, _ := status.FromError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": e.ERROR, "message": st.Message()})
+		return
+	}
+
+	if resp.GetCode() != e.SUCCESS {
+		c.JSON(http.StatusBadRequest, gin.H{"code": resp.GetCode(), "message": resp.GetMessage()})
+		return
+	}
+
+	JSONProto(c, http.StatusOK, resp)
+}
+
 // RegisterRoutes 注册商品相关路由
 func (h *ProductHandler) RegisterRoutes(rg *gin.RouterGroup) {
 	
 	rg.GET("/:id", h.GetProduct)
 	rg.GET("", h.ListProducts)
+	rg.GET("/seckill", h.ListActiveSeckillProducts)
 	rg.POST("", h.CreateProduct)
 	rg.PUT("/:id", h.UpdateProduct)
 	rg.DELETE("/:id", h.DeleteProduct)
+	rg.POST("/:id/stock/deduct", h.DeductStock)
+	rg.POST("/:id/stock/return", h.ReturnStock)
+	rg.GET("/:id/stock/logs", h.ListStockLogs)
 	
 }
@@ -0,0 +1,200 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/status"
+
+	"github.com/CCDD2022/seckill-system/pkg/e"
+	"github.com/CCDD2022/seckill-system/proto_output/seckill"
+)
+
+// ActivityHandler 秒杀活动管理处理器
+type ActivityHandler struct {
+	client seckill.SeckillServiceClient
+}
+
+func NewActivityHandler(client seckill.SeckillServiceClient) *ActivityHandler {
+	return &ActivityHandler{client: client}
+}
+
+// requireAdmin 管理员校验，未通过时直接写响应
+func requireAdmin(c *gin.Context) bool {
+	if username, ok := c.Get("username"); !ok || username.(string) != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    e.ERROR,
+			"message": "forbidden: admin only",
+		})
+		return false
+	}
+	return true
+}
+
+// operatorOf 管理员操作者标识，随请求传给后端记入库存日志
+func operatorOf(c *gin.Context) string {
+	userID, _ := c.Get("user_id")
+	return fmt.Sprintf("admin:%v", userID)
+}
+
+// GetActivity 获取单个秒杀活动
+func (h *ActivityHandler) GetActivity(c *gin.Context) {
+	activityID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": e.INVALID_PARAMS, "message": e.GetMsg(e.INVALID_PARAMS)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.client.GetActivity(ctx, &seckill.GetActivityRequest{ActivityId: activityID})
+	if err != nil {
+		st, _ := status.FromError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": e.ERROR, "message": st.Message()})
+		return
+	}
+
+	if resp.GetCode() != e.SUCCESS {
+		c.JSON(http.StatusNotFound, gin.H{"code": resp.GetCode(), "message": resp.GetMessage()})
+		return
+	}
+
+	JSONProto(c, http.StatusOK, resp)
+}
+
+// ListActivities 分页获取秒杀活动（可按 product_id 筛选）
+func (h *ActivityHandler) ListActivities(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	productID, _ := strconv.ParseInt(c.DefaultQuery("product_id", "0"), 10, 64)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.client.ListActivities(ctx, &seckill.ListActivitiesRequest{
+		Page:      int32(page),
+		PageSize:  int32(pageSize),
+		ProductId: productID,
+	})
+	if err != nil {
+		st, _ := status.FromError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": e.ERROR, "message": st.Message()})
+		return
+	}
+
+	if resp.GetCode() != e.SUCCESS {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": resp.GetCode(), "message": resp.GetMessage()})
+		return
+	}
+
+	JSONProto(c, http.StatusOK, resp)
+}
+
+// CreateActivity 创建秒杀活动
+func (h *ActivityHandler) CreateActivity(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	var req seckill.CreateActivityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": e.INVALID_PARAMS, "message": e.GetMsg(e.INVALID_PARAMS)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.client.CreateActivity(ctx, &req)
+	if err != nil {
+		st, _ := status.FromError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": e.ERROR, "message": st.Message()})
+		return
+	}
+
+	if resp.GetCode() != e.SUCCESS {
+		c.JSON(http.StatusBadRequest, gin.H{"code": resp.GetCode(), "message": resp.GetMessage()})
+		return
+	}
+
+	JSONProto(c, http.StatusCreated, resp)
+}
+
+// UpdateActivity 更新秒杀活动
+func (h *ActivityHandler) UpdateActivity(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	activityID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": e.INVALID_PARAMS, "message": e.GetMsg(e.INVALID_PARAMS)})
+		return
+	}
+
+	var req seckill.UpdateActivityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": e.INVALID_PARAMS, "message": e.GetMsg(e.INVALID_PARAMS)})
+		return
+	}
+	req.ActivityId = activityID
+	req.Operator = operatorOf(c)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.client.UpdateActivity(ctx, &req)
+	if err != nil {
+		st, _ := status.FromError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": e.ERROR, "message": st.Message()})
+		return
+	}
+
+	if resp.GetCode() != e.SUCCESS {
+		c.JSON(http.StatusBadRequest, gin.H{"code": resp.GetCode(), "message": resp.GetMessage()})
+		return
+	}
+
+	JSONProto(c, http.StatusOK, resp)
+}
+
+// DeleteActivity 删除秒杀活动
+func (h *ActivityHandler) DeleteActivity(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	activityID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": e.INVALID_PARAMS, "message": e.GetMsg(e.INVALID_PARAMS)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.client.DeleteActivity(ctx, &seckill.DeleteActivityRequest{ActivityId: activityID})
+	if err != nil {
+		st, _ := status.FromError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": e.ERROR, "message": st.Message()})
+		return
+	}
+
+	if resp.GetCode() != e.SUCCESS {
+		c.JSON(http.StatusBadRequest, gin.H{"code": resp.GetCode(), "message": resp.GetMessage()})
+		return
+	}
+
+	JSONProto(c, http.StatusOK, resp)
+}
+
+// RegisterRoutes 注册秒杀活动路由
+func (h *ActivityHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/:id", h.GetActivity)
+	rg.GET("", h.ListActivities)
+	rg.POST("", h.CreateActivity)
+	rg.PUT("/:id", h.UpdateActivity)
+	rg.DELETE("/:id", h.DeleteActivity)
+}
@@ -58,8 +58,12 @@ func (h *SeckillHandler) ExecuteSeckill(c *gin.Context) {
 	}
 
 	if !resp.GetSuccess() {
+		code := resp.GetCode()
+		if code == e.SUCCESS {
+			code = e.ERROR
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"code":    e.ERROR,
+			"code":    code,
 			"message": resp.GetMessage(),
 			"success": false,
 		})
@@ -71,10 +75,59 @@ func (h *SeckillHandler) ExecuteSeckill(c *gin.Context) {
 		"message":  resp.GetMessage(),
 		"success":  true,
 		"order_id": resp.GetOrderId(),
+		"ticket":   resp.GetTicket(),
 	})
 }
 
+// QuerySeckillResult 凭秒杀凭证轮询异步下单结果
+func (h *SeckillHandler) QuerySeckillResult(c *gin.Context) {
+	ticket := c.Param("ticket")
+	if ticket == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    e.INVALID_PARAMS,
+			"message": e.GetMsg(e.INVALID_PARAMS),
+		})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    e.ERROR_AUTH,
+			"message": "未授权访问",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.seckillClient.QuerySeckillResult(ctx, &seckill.QuerySeckillResultRequest{
+		UserId: userID.(int64),
+		Ticket: ticket,
+	})
+	if err != nil {
+		st, _ := status.FromError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    e.ERROR,
+			"message": st.Message(),
+		})
+		return
+	}
+
+	if resp.GetCode() == e.ERROR_NOT_EXIST {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    resp.GetCode(),
+			"message": resp.GetMessage(),
+		})
+		return
+	}
+
+	JSONProto(c, http.StatusOK, resp)
+}
+
 // RegisterRoutes 注册路由
 func (h *SeckillHandler) RegisterRoutes(rg *gin.RouterGroup) {
 	rg.POST("/execute", h.ExecuteSeckill)
+	rg.GET("/result/:ticket", h.QuerySeckillResult)
 }
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/CCDD2022/seckill-system/internal/client/grpc"
 	"github.com/CCDD2022/seckill-system/pkg/app"
 	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
@@ -18,6 +21,8 @@ import (
 func main() {
 	// 加载配置
 	cfg := app.BootstrapApp()
+	rt := app.NewRuntime(cfg)
+	rt.InitTracing(cfg.Tracing, "api_gateway")
 
 	// 设置Gin模式
 	switch cfg.Server.Mode {
@@ -36,15 +41,22 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowAllOrigins:  true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Type"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "traceparent", "tracestate"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Type", middleware.TraceIDHeader},
 		AllowCredentials: false,
 	}))
 
+	// 请求指标放在限流之前，被限流拒绝的请求同样计数
+	r.Use(middleware.Metrics())
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// 链路追踪：探针与指标抓取不记录
+	r.Use(middleware.Tracing("/metrics", "/health", "/livez", "/readyz"))
+
 	// 全局限流中间件（配置化）
 	r.Use(middleware.GlobalRateLimit(cfg))
 
-	// 健康检查接口
+	// 健康检查接口（仅表示网关进程存活，下游状态见 /readyz）
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "ok",
@@ -62,11 +74,15 @@ func main() {
 	// JWT 工具
 	jwtUtil := utils.NewJWTUtil(cfg.JWT.Secret, cfg.JWT.ExpireHours)
 
+	// 存活 /livez 与就绪 /readyz 探针（就绪聚合下游 gRPC 健康检查）
+	v1.NewHealthHandler(clients, rt.Context()).RegisterRoutes(r)
+
 	// 创建处理器实例
 	authHandler := v1.NewAuthHandler(clients.AuthService)
 	userHandler := v1.NewUserHandler(clients.UserService)
 	productHandler := v1.NewProductHandler(clients.ProductService)
 	seckillHandler := v1.NewSeckillHandler(clients.SeckillService)
+	activityHandler := v1.NewActivityHandler(clients.SeckillService)
 	orderHandler := v1.NewOrderHandler(clients.OrderService)
 
 	// 定义API路由组
@@ -85,6 +101,8 @@ func main() {
 			userHandler.RegisterRoutes(protected.Group("/users"))
 			// 商品路由
 			productHandler.RegisterRoutes(protected.Group("/products"))
+			// 秒杀活动路由（增删改仅管理员）
+			activityHandler.RegisterRoutes(protected.Group("/seckill/activities"))
 			// 订单路由（独立限流）
 			ordersGroup := protected.Group("/orders")
 			ordersGroup.Use(middleware.OrderRateLimit(cfg))
@@ -100,7 +118,13 @@ func main() {
 	// 启动服务器
 	serverAddr := fmt.Sprintf("%s:%d", cfg.Services.APIGateway.Host, cfg.Services.APIGateway.Port)
 	logger.Info("API Gateway starting on " + serverAddr)
-	if err := r.Run(serverAddr); err != nil {
-		logger.Error("Failed to start API Gateway: ", "err", err)
+	srv := &http.Server{
+		Addr:         serverAddr,
+		Handler:      r,
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
 	}
+	rt.ServeHTTP("http", srv)
+	rt.OnClose("grpc clients", func(context.Context) error { return clients.Close() })
+	rt.Wait()
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 
@@ -9,9 +10,9 @@ import (
 	"github.com/CCDD2022/seckill-system/internal/service"
 	"github.com/CCDD2022/seckill-system/pkg/app"
 	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/CCDD2022/seckill-system/pkg/tracing"
 	"github.com/CCDD2022/seckill-system/proto_output/auth"
-	"google.golang.org/grpc/health"
-	"google.golang.org/grpc/health/grpc_health_v1"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
@@ -19,6 +20,9 @@ import (
 
 func main() {
 	cfg := app.BootstrapApp()
+	rt := app.NewRuntime(cfg)
+	rt.ServeMetrics(cfg.Metrics.AddrFor("auth_service"))
+	rt.InitTracing(cfg.Tracing, "auth_service")
 	db, err := mysql.InitDB(&cfg.Database.Mysql)
 	if err != nil {
 		logger.Error("连接Mysql数据库失败: ", "err", err)
@@ -30,16 +34,15 @@ func main() {
 	authService := service.NewAuthService(authDao, cfg.JWT.Secret, cfg.JWT.ExpireHours)
 
 	// 创建 gRPC 服务器
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(metrics.UnaryServerInterceptor()), tracing.ServerOption())
 	// 测试的时候会依赖反射调用  生产环境要去掉
 	reflection.Register(grpcServer)
 	// 当收到auth.authService/Register的时候  调用authService.Register方法
 	auth.RegisterAuthServiceServer(grpcServer, authService)
 
-	// 创建健康检查实例并注册到gRPC服务器上
-	healthServer := health.NewServer()
-	grpc_health_v1.RegisterHealthServer(grpcServer, healthServer)
-	healthServer.SetServingStatus("auth", grpc_health_v1.HealthCheckResponse_SERVING)
+	// 创建健康检查实例并注册到gRPC服务器上，依赖不可用时为 NOT_SERVING
+	hc := app.NewHealth(grpcServer, "auth")
+	hc.AddCheck("mysql", func(ctx context.Context) error { return mysql.Ping(ctx, db) })
 
 	// 启动 gRPC 服务器
 	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Services.AuthService.Host, cfg.Services.AuthService.Port))
@@ -48,7 +51,8 @@ func main() {
 	}
 
 	logger.Info("Auth gRPC service started on ", "port", cfg.Services.AuthService.Port)
-	if err := grpcServer.Serve(lis); err != nil {
-		logger.Error("Failed to serve: ", "err", err)
-	}
+	rt.ServeGRPC("grpc", grpcServer, lis)
+	rt.Go("health", hc.Run)
+	rt.OnClose("mysql", func(context.Context) error { return mysql.Close(db) })
+	rt.Wait()
 }
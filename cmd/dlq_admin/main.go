@@ -0,0 +1,216 @@
+// 死信管理命令行：调用 DLQService 查询、查看、重放与丢弃死信
+//
+//	dlq_admin list    [-status 0] [-routing-key order.create] [-queue q] [-reason rejected] [-page 1] [-size 20]
+//	dlq_admin show    -id 12
+//	dlq_admin replay  -ids 12,13 | [-status 0] [-routing-key order.create] [-limit 100]
+//	dlq_admin discard -ids 12,13 | [-status 0] [-routing-key order.create] [-limit 100]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/config"
+	"github.com/CCDD2022/seckill-system/proto_output/dlq"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const rpcTimeout = 60 * time.Second // 批量重放逐条等待确认，超时放宽
+
+// options 各子命令共用的参数
+type options struct {
+	addr       string
+	id         int64
+	ids        string
+	status     int
+	routingKey string
+	queue      string
+	reason     string
+	messageID  string
+	page       int
+	size       int
+	limit      int
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd := os.Args[1]
+
+	var opt options
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	fs.StringVar(&opt.addr, "addr", defaultAddr(), "DLQService 地址")
+	fs.Int64Var(&opt.id, "id", 0, "死信ID（show）")
+	fs.StringVar(&opt.ids, "ids", "", "逗号分隔的死信ID，指定后忽略过滤条件（replay/discard）")
+	fs.IntVar(&opt.status, "status", 0, "状态过滤：0待处理 1已重放 2已丢弃 -1全部")
+	fs.StringVar(&opt.routingKey, "routing-key", "", "按原路由键过滤")
+	fs.StringVar(&opt.queue, "queue", "", "按死信来源队列过滤")
+	fs.StringVar(&opt.reason, "reason", "", "按死信原因过滤：rejected/expired/maxlen")
+	fs.StringVar(&opt.messageID, "message-id", "", "按 MessageId 过滤")
+	fs.IntVar(&opt.page, "page", 1, "页码（list）")
+	fs.IntVar(&opt.size, "size", 20, "每页条数（list）")
+	fs.IntVar(&opt.limit, "limit", 100, "按条件批量处理的最大条数（replay/discard）")
+	_ = fs.Parse(os.Args[2:])
+
+	conn, err := grpc.NewClient(opt.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fail("连接 DLQService 失败: %v", err)
+	}
+	defer conn.Close()
+	client := dlq.NewDLQServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	switch cmd {
+	case "list":
+		list(ctx, client, &opt)
+	case "show":
+		show(ctx, client, &opt)
+	case "replay":
+		replay(ctx, client, &opt)
+	case "discard":
+		discard(ctx, client, &opt)
+	default:
+		usage()
+	}
+}
+
+func list(ctx context.Context, client dlq.DLQServiceClient, opt *options) {
+	resp, err := client.ListDeadLetters(ctx, &dlq.ListDeadLettersRequest{
+		Filter:   opt.filter(),
+		Page:     int32(opt.page),
+		PageSize: int32(opt.size),
+	})
+	check(resp.GetCode(), resp.GetMessage(), err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tROUTING_KEY\tQUEUE\tREASON\tMESSAGE_ID\tREPLAYS\tCREATED_AT")
+	for _, dl := range resp.DeadLetters {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			dl.Id, statusText(dl.Status), dl.RoutingKey, dl.Queue, dl.Reason, dl.MessageId, dl.ReplayCount,
+			time.Unix(dl.CreatedAt, 0).Format(time.DateTime))
+	}
+	_ = w.Flush()
+	fmt.Printf("共 %d 条，第 %d 页\n", resp.Total, opt.page)
+}
+
+func show(ctx context.Context, client dlq.DLQServiceClient, opt *options) {
+	if opt.id <= 0 {
+		fail("show 需要 -id")
+	}
+	resp, err := client.GetDeadLetter(ctx, &dlq.GetDeadLetterRequest{Id: opt.id})
+	check(resp.GetCode(), resp.GetMessage(), err)
+
+	dl := resp.DeadLetter
+	fmt.Printf("ID:          %d\n", dl.Id)
+	fmt.Printf("Status:      %s (replayed %d times)\n", statusText(dl.Status), dl.ReplayCount)
+	fmt.Printf("MessageId:   %s\n", dl.MessageId)
+	fmt.Printf("Exchange:    %s\n", dl.Exchange)
+	fmt.Printf("RoutingKey:  %s\n", dl.RoutingKey)
+	fmt.Printf("Queue:       %s\n", dl.Queue)
+	fmt.Printf("Reason:      %s\n", dl.Reason)
+	fmt.Printf("CreatedAt:   %s\n", time.Unix(dl.CreatedAt, 0).Format(time.DateTime))
+	if dl.ReplayedAt > 0 {
+		fmt.Printf("ReplayedAt:  %s\n", time.Unix(dl.ReplayedAt, 0).Format(time.DateTime))
+	}
+	fmt.Printf("Headers:     %s\n", dl.Headers)
+	fmt.Printf("Body:\n%s\n", dl.Body)
+}
+
+func replay(ctx context.Context, client dlq.DLQServiceClient, opt *options) {
+	resp, err := client.ReplayDeadLetters(ctx, &dlq.ReplayDeadLettersRequest{
+		Ids:    opt.parseIDs(),
+		Filter: opt.filter(),
+		Limit:  int32(opt.limit),
+	})
+	check(resp.GetCode(), resp.GetMessage(), err)
+
+	fmt.Printf("已重放 %d 条，失败 %d 条\n", resp.Replayed, len(resp.Failures))
+	for _, f := range resp.Failures {
+		fmt.Printf("  id=%d: %s\n", f.Id, f.Reason)
+	}
+}
+
+func discard(ctx context.Context, client dlq.DLQServiceClient, opt *options) {
+	resp, err := client.DiscardDeadLetters(ctx, &dlq.DiscardDeadLettersRequest{
+		Ids:    opt.parseIDs(),
+		Filter: opt.filter(),
+		Limit:  int32(opt.limit),
+	})
+	check(resp.GetCode(), resp.GetMessage(), err)
+	fmt.Printf("已丢弃 %d 条\n", resp.Discarded)
+}
+
+func (o *options) filter() *dlq.DeadLetterFilter {
+	return &dlq.DeadLetterFilter{
+		Status:     int32(o.status),
+		RoutingKey: o.routingKey,
+		Queue:      o.queue,
+		Reason:     o.reason,
+		MessageId:  o.messageID,
+	}
+}
+
+func (o *options) parseIDs() []int64 {
+	if o.ids == "" {
+		return nil
+	}
+	var ids []int64
+	for _, s := range strings.Split(o.ids, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil || id <= 0 {
+			fail("无效的死信ID: %q", s)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// defaultAddr 优先使用配置文件中的 dlq_service 地址
+func defaultAddr() string {
+	cfg, err := config.LoadConfig()
+	if err != nil || cfg.Services.DLQService.Port == 0 {
+		return "localhost:50056"
+	}
+	return fmt.Sprintf("%s:%d", cfg.Services.DLQService.Host, cfg.Services.DLQService.Port)
+}
+
+func statusText(status int32) string {
+	switch status {
+	case 0:
+		return "pending"
+	case 1:
+		return "replayed"
+	case 2:
+		return "discarded"
+	}
+	return strconv.Itoa(int(status))
+}
+
+func check(code int32, message string, err error) {
+	if err != nil {
+		fail("调用失败: %v", err)
+	}
+	if code != 0 {
+		fail("调用失败: code=%d %s", code, message)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dlq_admin <list|show|replay|discard> [flags]，使用 dlq_admin <command> -h 查看参数")
+	os.Exit(2)
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -1,55 +1,135 @@
 package main
 
 import (
-	"fmt"
-	"os"
+	"context"
+	"encoding/json"
 	"time"
 
+	"github.com/CCDD2022/seckill-system/internal/dao"
+	"github.com/CCDD2022/seckill-system/internal/dao/mysql"
+	redisinit "github.com/CCDD2022/seckill-system/internal/dao/redis"
+	"github.com/CCDD2022/seckill-system/internal/model"
 	"github.com/CCDD2022/seckill-system/internal/mq"
 	"github.com/CCDD2022/seckill-system/pkg/app"
 	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/streadway/amqp"
 )
 
 const (
-	dlqName = "order.create.dlq"
+	dlqName        = "order.create.dlq"
+	orderCreateKey = "order.create"
+	// 死信未携带 x-death 时的默认原交换机
+	seckillExchange = "seckill.exchange"
 )
 
 func main() {
 	cfg := app.BootstrapApp()
+	rt := app.NewRuntime(cfg)
+	rt.ServeMetrics(cfg.Metrics.AddrFor("dlq_consumer"))
+	rt.InitTracing(cfg.Tracing, "dlq_consumer")
 
-	// 独立连接，避免影响主业务
-	// 这里不需要绑定交换机，因为 setupDLQ 已经绑定好了，直接消费队列即可
-	conn, ch, msgs, err := mq.NewConsumerChannel(&cfg.MQ, dlqName, "", "", true, 10, nil)
+	db, err := mysql.InitDB(&cfg.Database.Mysql)
+	if err != nil {
+		logger.Fatal("连接Mysql数据库失败", "err", err)
+	}
+	rdb, err := redisinit.InitRedis(&cfg.Database.Redis)
 	if err != nil {
-		logger.Fatal("DLQ consumer init failed", "err", err)
+		logger.Fatal("连接Redis失败", "err", err)
 	}
-	defer mq.CloseConsumer(conn, ch)
+	resultDao := dao.NewSeckillResultDao(rdb)
+	reservationDao := dao.NewSeckillReservationDao(rdb)
+	deadLetterDao := dao.NewDeadLetterDao(db)
+
+	// 独立连接，避免影响主业务；断线后自动重连
+	// 这里不需要绑定交换机，因为 setupDLQ 已经绑定好了，直接消费队列即可
+	consumer := mq.NewConsumer(&cfg.MQ, mq.ConsumerSpec{
+		Queue:    dlqName,
+		Durable:  true,
+		Prefetch: 10,
+	})
 
 	logger.Info("DLQ Monitor started", "queue", dlqName)
 
-	// 打开报警日志文件
-	f, err := os.OpenFile("dlq_alarm.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		logger.Fatal("open dlq log file failed", "err", err)
-	}
-	defer f.Close()
+	go consumer.Run(func(msgs <-chan amqp.Delivery) {
+		for d := range msgs {
+			ctx := mq.DeliveryContext(d)
+			// 1. 持久化死信，供 dlq_admin 查询、重放或丢弃
+			dl := toDeadLetter(d)
+			created, err := deadLetterDao.CreateDeadLetter(ctx, dl)
+			if err != nil {
+				logger.Error("保存死信失败", "msg_id", d.MessageId, "err", err)
+				// 数据库不可用时放回队列，稍后重试，避免死信丢失
+				time.Sleep(time.Second)
+				_ = d.Nack(false, true)
+				continue
+			}
 
-	for d := range msgs {
-		// 1. 记录报警日志
-		logContent := fmt.Sprintf("[%s] ALARM: Dead Letter Received | MsgID: %s | Body: %s\n",
-			time.Now().Format(time.DateTime),
-			d.MessageId,
-			string(d.Body))
+			// 2. 报警日志；确认失败后重新投递的同一死信已有待处理记录，不再重复计数与报警（以下预占与结果处理幂等，照常执行）
+			if created {
+				metrics.DLQArrivals.WithLabelValues(dl.Queue, dl.Reason).Inc()
+				logger.Warn("ALARM: Dead letter received", "id", dl.ID, "msg_id", d.MessageId, "routing_key", dl.RoutingKey, "queue", dl.Queue, "reason", dl.Reason)
+			} else {
+				logger.Info("死信已保存，跳过重复记录", "id", dl.ID, "msg_id", d.MessageId)
+			}
 
-		if _, err := f.WriteString(logContent); err != nil {
-			logger.Error("write dlq log failed", "err", err)
+			// 下单消息进入死信（含TTL过期/队列溢出等Broker侧原因），标记秒杀结果为失败；
+			// 保留库存预占，重放后消费者可再次认领并下单（消费者已保留时幂等），丢弃死信时才归还
+			if dl.RoutingKey == orderCreateKey && d.MessageId != "" {
+				if held, err := reservationDao.HoldReservation(ctx, d.MessageId); err != nil {
+					logger.Error("保留库存预占失败", "msg_id", d.MessageId, "err", err)
+				} else if !held {
+					logger.Warn("库存预占已释放，该死信重放后不会下单", "msg_id", d.MessageId)
+				}
+				if err := resultDao.MarkFailed(ctx, d.MessageId, "订单处理失败，已转人工处理"); err != nil {
+					logger.Error("mark seckill result failed", "msg_id", d.MessageId, "err", err)
+				}
+			}
+
+			// 3. 已落库，确认消息
+			_ = d.Ack(false)
 		}
+	})
 
-		// 2. 打印到控制台方便调试
-		logger.Warn("ALARM: Dead letter received", "msg_id", d.MessageId)
+	// 退出时先停止消费并处理完已到达的死信，再关闭连接
+	rt.OnStop("consumer", consumer.Shutdown)
+	rt.OnClose("redis", func(context.Context) error { return rdb.Close() })
+	rt.OnClose("mysql", func(context.Context) error { return mysql.Close(db) })
+	rt.Wait()
+}
 
-		// 3. 确认消息（表示报警已处理，避免死信堆积）
-		// 实际场景中可能需要人工确认后再Ack，或者转存到数据库
-		_ = d.Ack(false)
+// toDeadLetter 从死信投递中提取原交换机、路由键与死信原因
+// x-death 由 Broker 写入，首个元素为最近一次死信记录
+func toDeadLetter(d amqp.Delivery) *model.DeadLetter {
+	dl := &model.DeadLetter{
+		MessageID:  d.MessageId,
+		Exchange:   seckillExchange,
+		RoutingKey: d.RoutingKey,
+		Body:       string(d.Body),
+		Status:     model.DeadLetterStatusPending,
+	}
+	if deaths, ok := d.Headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+		if death, ok := deaths[0].(amqp.Table); ok {
+			if v, ok := death["exchange"].(string); ok && v != "" {
+				dl.Exchange = v
+			}
+			if v, ok := death["queue"].(string); ok {
+				dl.Queue = v
+			}
+			if v, ok := death["reason"].(string); ok {
+				dl.Reason = v
+			}
+			if keys, ok := death["routing-keys"].([]interface{}); ok && len(keys) > 0 {
+				if v, ok := keys[0].(string); ok {
+					dl.RoutingKey = v
+				}
+			}
+		}
+	}
+	if len(d.Headers) > 0 {
+		if b, err := json.Marshal(d.Headers); err == nil {
+			dl.Headers = string(b)
+		}
 	}
+	return dl
 }
@@ -0,0 +1,68 @@
+// DLQService gRPC 启动入口：死信查询、重放与丢弃（运维内部接口）
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/CCDD2022/seckill-system/internal/dao"
+	"github.com/CCDD2022/seckill-system/internal/dao/mysql"
+	redisinit "github.com/CCDD2022/seckill-system/internal/dao/redis"
+	"github.com/CCDD2022/seckill-system/internal/mq"
+	"github.com/CCDD2022/seckill-system/internal/service"
+	"github.com/CCDD2022/seckill-system/pkg/app"
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/CCDD2022/seckill-system/pkg/tracing"
+	"github.com/CCDD2022/seckill-system/proto_output/dlq"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+func main() {
+	cfg := app.BootstrapApp()
+	rt := app.NewRuntime(cfg)
+	rt.ServeMetrics(cfg.Metrics.AddrFor("dlq_service"))
+	rt.InitTracing(cfg.Tracing, "dlq_service")
+
+	db, err := mysql.InitDB(&cfg.Database.Mysql)
+	if err != nil {
+		logger.Fatal("连接Mysql数据库失败", "err", err)
+	}
+
+	// 下单死信的库存预占：重放前检查、丢弃时归还
+	rdb, err := redisinit.InitRedis(&cfg.Database.Redis)
+	if err != nil {
+		logger.Fatal("连接Redis失败", "err", err)
+	}
+
+	// 重放经生产者池发布，逐条等待Broker确认
+	mqPool, err := mq.Init(&cfg.MQ)
+	if err != nil {
+		logger.Fatal("init mq failed", "err", err)
+	}
+
+	dlqService := service.NewDLQService(dao.NewDeadLetterDao(db), dao.NewSeckillReservationDao(rdb), mqPool)
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(metrics.UnaryServerInterceptor()), tracing.ServerOption())
+	reflection.Register(grpcServer)
+	dlq.RegisterDLQServiceServer(grpcServer, dlqService)
+
+	// 健康检查：依赖不可用时为 NOT_SERVING
+	hc := app.NewHealth(grpcServer, "dlq")
+	hc.AddCheck("mysql", func(ctx context.Context) error { return mysql.Ping(ctx, db) })
+	hc.AddCheck("redis", func(ctx context.Context) error { return rdb.Ping(ctx).Err() })
+	hc.AddCheck("mq", func(context.Context) error { return mqPool.Ping() })
+
+	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Services.DLQService.Host, cfg.Services.DLQService.Port))
+	if err != nil {
+		logger.Fatal("监听端口失败", "err", err)
+	}
+	logger.Info("DLQ gRPC service started", "port", cfg.Services.DLQService.Port)
+	rt.ServeGRPC("grpc", grpcServer, lis)
+	rt.Go("health", hc.Run)
+	rt.OnClose("redis", func(context.Context) error { return rdb.Close() })
+	rt.OnClose("mysql", func(context.Context) error { return mysql.Close(db) })
+	rt.OnClose("mq", mqPool.Shutdown)
+	rt.Wait()
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/CCDD2022/seckill-system/internal/dao"
 	"github.com/CCDD2022/seckill-system/internal/dao/mysql"
 	rds "github.com/CCDD2022/seckill-system/internal/dao/redis"
+	"github.com/CCDD2022/seckill-system/internal/model"
 	"github.com/CCDD2022/seckill-system/internal/mq"
 	"github.com/CCDD2022/seckill-system/pkg/app"
 	"github.com/CCDD2022/seckill-system/pkg/logger"
@@ -22,6 +23,7 @@ type OrderCanceledEvent struct {
 	OrderID    int64  `json:"order_id"`
 	UserID     int64  `json:"user_id"`
 	ProductID  int64  `json:"product_id"`
+	ActivityID int64  `json:"activity_id"`
 	Quantity   int32  `json:"quantity"`
 }
 
@@ -35,6 +37,9 @@ const (
 func main() {
 
 	cfg := app.BootstrapApp()
+	rt := app.NewRuntime(cfg)
+	rt.ServeMetrics(cfg.Metrics.AddrFor("order_cancel_consumer"))
+	rt.InitTracing(cfg.Tracing, "order_cancel_consumer")
 
 	db, err := mysql.InitDB(&cfg.Database.Mysql)
 	if err != nil {
@@ -45,24 +50,30 @@ func main() {
 		logger.Fatal("连接Redis失败", "err", err)
 	}
 	productDao := dao.NewProductDao(db, rdb)
+	activityDao := dao.NewSeckillActivityDao(db, rdb)
 
 	// 1. 配置主队列参数，指定死信交换机
 	args := amqp.Table{
 		"x-dead-letter-exchange": dlxName,
 	}
 
-	// 2. 启动消费者，绑定 order.canceled
-	conn, consumerCh, msgs, err := mq.NewConsumerChannel(&cfg.MQ, queueOrderCanceled, "order.canceled", "seckill.exchange", true, cfg.MQ.ConsumerPrefetch, args)
-	if err != nil {
-		logger.Fatal("init consumer channel failed", "err", err)
-	}
-	defer func() { mq.CloseConsumer(conn, consumerCh) }()
+	// 2. 启动消费者，绑定 order.canceled；断线后自动重连并重新声明队列
+	consumer := mq.NewConsumer(&cfg.MQ, mq.ConsumerSpec{
+		Queue:    queueOrderCanceled,
+		BindKey:  "order.canceled",
+		Exchange: "seckill.exchange",
+		Durable:  true,
+		Prefetch: cfg.MQ.ConsumerPrefetch,
+		Args:     args,
+		// 归还库存失败先进入重试延迟队列，用尽次数后才进入死信
+		Retry: mq.NewRetryPolicy(&cfg.MQ),
+	})
 
 	logger.Info("Product Consumer started, waiting for order.canceled events...")
-	forever := make(chan bool)
 
-	go func() {
+	go consumer.Run(func(msgs <-chan amqp.Delivery) {
 		for d := range msgs {
+			ctx := mq.DeliveryContext(d)
 			var evt OrderCanceledEvent
 			if err := json.Unmarshal(d.Body, &evt); err != nil {
 				logger.Error("取消事件解析失败", "err", err)
@@ -72,7 +83,7 @@ func main() {
 			}
 			// 幂等去重（Redis SETNX）
 			dedupKey := fmt.Sprintf(eventDedupKeyFmt, evt.EventID)
-			ok, derr := rdb.SetNX(context.Background(), dedupKey, 1, 24*time.Hour).Result()
+			ok, derr := rdb.SetNX(ctx, dedupKey, 1, 24*time.Hour).Result()
 			if derr != nil {
 				logger.Error("去重键写入失败", "err", derr)
 				// 临时错误，允许重试（requeue=true）
@@ -92,17 +103,33 @@ func main() {
 				// 如果这里直接操作 MySQL，可能会与 Reconciler 冲突
 				// 但考虑到取消订单是低频操作，且 ReturnStock 内部逻辑通常是先改 DB 再删缓存
 				// 为了保持一致性，建议 ReturnStock 也改为只操作 Redis（增加库存），并标记 dirty
-				if err := productDao.ReturnStock(context.Background(), evt.ProductID, evt.Quantity); err != nil {
-					logger.Error("归还库存失败", "product_id", evt.ProductID, "qty", evt.Quantity, "err", err)
-					// 业务处理失败，进入死信队列，人工介入
+				// 活动订单归还到活动库存，兼容旧版商品秒杀订单归还到商品库存
+				// 同时释放该用户的限购额度，取消的订单不计入已购数量
+				var err error
+				op := dao.StockOp{Reason: model.StockReasonOrderCancel, Actor: model.SystemActor("order_cancel_consumer"), Ref: fmt.Sprintf("order:%d", evt.OrderID)}
+				if evt.ActivityID > 0 {
+					err = activityDao.ReturnStockForUser(ctx, evt.ActivityID, evt.UserID, evt.Quantity, op)
+				} else {
+					err = productDao.ReturnStockForUser(ctx, evt.ProductID, evt.UserID, evt.Quantity, op)
+				}
+				if err != nil {
+					logger.Error("归还库存失败", "product_id", evt.ProductID, "activity_id", evt.ActivityID, "qty", evt.Quantity, "attempt", mq.RetryAttempt(d), "err", err)
+					_ = rdb.Del(ctx, dedupKey).Err()
+					if consumer.Retry(d) {
+						continue
+					}
+					// 重试次数用尽，进入死信队列，人工介入
 					d.Nack(false, false)
-					_ = rdb.Del(context.Background(), dedupKey).Err()
 					continue
 				}
-				logger.Info("归还库存成功", "product_id", evt.ProductID, "qty", evt.Quantity, "order_id", evt.OrderID)
+				logger.Info("归还库存成功", "product_id", evt.ProductID, "activity_id", evt.ActivityID, "qty", evt.Quantity, "order_id", evt.OrderID)
 			}
 			d.Ack(false)
 		}
-	}()
-	<-forever
+	})
+
+	rt.OnStop("consumer", consumer.Shutdown)
+	rt.OnClose("redis", func(context.Context) error { return rdb.Close() })
+	rt.OnClose("mysql", func(context.Context) error { return mysql.Close(db) })
+	rt.Wait()
 }
@@ -3,23 +3,30 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
-	"github.com/CCDD2022/seckill-system/config"
+	"github.com/CCDD2022/seckill-system/internal/dao"
 	"github.com/CCDD2022/seckill-system/internal/dao/mysql"
 	redisinit "github.com/CCDD2022/seckill-system/internal/dao/redis"
 	"github.com/CCDD2022/seckill-system/internal/model"
 	"github.com/CCDD2022/seckill-system/internal/mq"
 	"github.com/CCDD2022/seckill-system/pkg/app"
 	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/tracing"
+	"github.com/redis/go-redis/v9"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
 type SeckillMessage struct {
+	OrderID    int64   `json:"order_id"` // 秒杀服务预分配的订单ID
 	UserID     int64   `json:"user_id"`
 	ProductID  int64   `json:"product_id"`
+	ActivityID int64   `json:"activity_id"`
 	Quantity   int32   `json:"quantity"`
 	TotalPrice float64 `json:"total_price"`
 }
@@ -31,10 +38,23 @@ const (
 	// 死信交换机与队列配置
 	dlxName = "seckill.dlx"
 	dlqName = "order.create.dlq"
+	// 支付超时：延迟队列到期后死信转发到 order.payment.timeout，由 order_timeout_consumer 处理
+	paymentDelayQueue = "order.payment.delay"
+	paymentDelayKey   = "order.payment.delay"
+	paymentTimeoutKey = "order.payment.timeout"
+	seckillExchange   = "seckill.exchange"
 )
 
+// OrderTimeoutMessage 支付超时检查消息
+type OrderTimeoutMessage struct {
+	OrderID int64 `json:"order_id"`
+}
+
 func main() {
 	cfg := app.BootstrapApp()
+	rt := app.NewRuntime(cfg)
+	rt.ServeMetrics(cfg.Metrics.AddrFor("order_create_consumer"))
+	rt.InitTracing(cfg.Tracing, "order_create_consumer")
 
 	db, err := mysql.InitDB(&cfg.Database.Mysql)
 	if err != nil {
@@ -46,86 +66,338 @@ func main() {
 		logger.Fatal("连接Redis失败", "err", err)
 	}
 
-	// 1. 初始化死信队列基础设施 (DLX + DLQ)
-	if err := setupDLQ(&cfg.MQ); err != nil {
-		logger.Fatal("setup dlq failed", "err", err)
+	// 秒杀结果记录与库存预占台账（ticket即MessageId）
+	resultDao := dao.NewSeckillResultDao(rdb)
+	reservationDao := dao.NewSeckillReservationDao(rdb)
+
+	// 生产者池：订单创建后投递支付超时延迟消息
+	mqPool, err := mq.Init(&cfg.MQ)
+	if err != nil {
+		logger.Fatal("init mq failed", "err", err)
+	}
+	if err := mqPool.EnsureDelayQueue(seckillExchange, paymentDelayQueue, paymentDelayKey, seckillExchange, paymentTimeoutKey); err != nil {
+		logger.Fatal("ensure payment delay queue failed", "err", err)
 	}
+	paymentTimeout := time.Duration(cfg.Order.PaymentTimeoutSeconds) * time.Second
 
-	// 2. 配置主队列参数，指定死信交换机
+	// 1. 配置主队列参数，指定死信交换机
 	args := amqp.Table{
 		"x-dead-letter-exchange": dlxName,
 	}
 
-	// 3. 启动消费者，绑定 order.create，避免误消费 order.canceled
-	conn, consumerCh, msgs, err := mq.NewConsumerChannel(&cfg.MQ, orderCreateQueue, orderCreateKey, "seckill.exchange", true, cfg.MQ.ConsumerPrefetch, args)
-	if err != nil {
-		logger.Fatal("init consumer channel failed", "err", err)
+	// 批量落库：攒够 order_batch_size 条或等待 order_batch_interval_ms 后一次写入
+	// 预取数不小于批大小，否则批次永远攒不满
+	batchSize := cfg.MQ.OrderBatchSize
+	prefetch := cfg.MQ.ConsumerPrefetch
+	if prefetch < batchSize {
+		prefetch = batchSize
+	}
+
+	// 2. 启动消费者，绑定 order.create，避免误消费 order.canceled
+	// 每次（重新）连接先声明死信基础设施 (DLX + DLQ)，断线后自动重连继续消费
+	consumer := mq.NewConsumer(&cfg.MQ, mq.ConsumerSpec{
+		Queue:    orderCreateQueue,
+		BindKey:  orderCreateKey,
+		Exchange: seckillExchange,
+		Durable:  true,
+		Prefetch: prefetch,
+		Args:     args,
+		Setup:    declareDLQ,
+		// 写库失败（死锁/超时等临时错误）先进入重试延迟队列，用尽次数后才进入死信
+		Retry: mq.NewRetryPolicy(&cfg.MQ),
+	})
+
+	logger.Info("Order Create Consumer started with DLQ support", "batch_size", batchSize, "batch_interval_ms", cfg.MQ.OrderBatchIntervalMs)
+
+	h := &orderCreator{
+		consumer:       consumer,
+		orderDao:       dao.NewOrderDao(db),
+		rdb:            rdb,
+		resultDao:      resultDao,
+		reservationDao: reservationDao,
+		mqPool:         mqPool,
+		paymentTimeout: paymentTimeout,
+		batchSize:      batchSize,
+		batchInterval:  time.Duration(cfg.MQ.OrderBatchIntervalMs) * time.Millisecond,
+		uniqueSeckill:  cfg.Order.UniqueSeckillOrder,
 	}
-	defer mq.CloseConsumer(conn, consumerCh)
+	go consumer.Run(h.run)
+
+	// 停止消费后 h.run 将已攒批的订单落库并确认；支付超时消息发布后等待确认再关闭生产者池
+	rt.OnStop("consumer", consumer.Shutdown)
+	rt.OnClose("redis", func(context.Context) error { return rdb.Close() })
+	rt.OnClose("mysql", func(context.Context) error { return mysql.Close(db) })
+	rt.OnClose("mq", mqPool.Shutdown)
+	rt.Wait()
+}
+
+// orderCreator 创建订单消息的处理依赖
+type orderCreator struct {
+	consumer       *mq.Consumer
+	orderDao       *dao.OrderDao
+	rdb            redis.UniversalClient
+	resultDao      *dao.SeckillResultDao
+	reservationDao *dao.SeckillReservationDao
+	mqPool         *mq.Pool
+	paymentTimeout time.Duration
+	batchSize      int
+	batchInterval  time.Duration
+	uniqueSeckill  bool // 写入 seckill_key，每人每活动只允许一单
+}
+
+// pendingOrder 已通过幂等校验与预占认领、等待批量落库的消息
+type pendingOrder struct {
+	d       amqp.Delivery
+	orderID int64 // 消息携带的预分配订单ID
+	order   *model.Order
+}
+
+// doneKey 已落库消息的缓存标记，仅用于跳过重复投递的快速路径；幂等最终由订单表 message_id 唯一索引保证
+func doneKey(msgID string) string {
+	return "seckill:msg:done:" + msgID
+}
 
-	logger.Info("Order Create Consumer started with DLQ support")
+// run 消费直到 msgs 关闭（连接断开/停止），按批量或时间窗口落库
+func (h *orderCreator) run(msgs <-chan amqp.Delivery) {
+	batch := make([]*pendingOrder, 0, h.batchSize)
+	ticker := time.NewTicker(h.batchInterval)
+	defer ticker.Stop()
 
-	for d := range msgs {
-		key := "seckill:msg:done:" + d.MessageId
-		// 幂等：如果MessageId存在则用Redis去重
-		if d.MessageId != "" {
-			added, _ := rdb.SetNX(context.Background(), key, 1, 30*time.Minute).Result()
-			if !added {
-				// 如果已经存在，说明已经处理过，直接ACK
-				logger.Error("Duplicate message detected, skipping", "message_id", d.MessageId)
+	for {
+		select {
+		case d, ok := <-msgs:
+			if !ok {
+				// 连接已断开：已认领的预占仍需落库，Ack 失败的消息重投后由唯一索引去重
+				h.flush(batch)
+				return
+			}
+			if p := h.prepare(d); p != nil {
+				batch = append(batch, p)
+			}
+			if len(batch) >= h.batchSize {
+				h.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				h.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// prepare 幂等校验、解析与认领预占；不需要落库的消息在此直接确认/拒绝并返回nil
+func (h *orderCreator) prepare(d amqp.Delivery) *pendingOrder {
+	ctx := mq.DeliveryContext(d)
+	// 快速路径：已落库的消息直接确认（Redis标记可能过期或丢失，不影响正确性）
+	if d.MessageId != "" {
+		if n, _ := h.rdb.Exists(ctx, doneKey(d.MessageId)).Result(); n > 0 {
+			logger.Warn("Duplicate message detected, skipping", "message_id", d.MessageId)
+			_ = d.Ack(false)
+			return nil
+		}
+	}
+	var m SeckillMessage
+	if err := json.Unmarshal(d.Body, &m); err != nil {
+		logger.Error("订单创建消息解析失败", "err", err)
+		// 解析失败属于不可恢复错误，直接丢入死信队列，不重试
+		_ = d.Nack(false, false)
+		markFailed(ctx, h.resultDao, d.MessageId, "订单消息解析失败")
+		return nil
+	}
+	// 认领库存预占：认领后清理进程不再释放；预占已过期释放则不能再创建订单，否则会超卖
+	if d.MessageId != "" {
+		claimed, err := h.reservationDao.ClaimReservation(ctx, d.MessageId)
+		if err != nil {
+			logger.Error("认领库存预占失败", "message_id", d.MessageId, "err", err)
+			// 临时错误，重新入队重试
+			_ = d.Nack(false, true)
+			return nil
+		}
+		if !claimed {
+			// 预占不存在：订单已落库并确认预占（重复投递/死信重放），或预占已过期释放
+			existing, err := h.orderDao.GetOrderByMessageID(ctx, d.MessageId)
+			if err == nil {
+				logger.Warn("订单已存在，按已处理确认", "message_id", d.MessageId, "order_id", existing.ID)
+				h.onCreated(&pendingOrder{d: d, order: existing})
 				_ = d.Ack(false)
-				continue
+				return nil
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				logger.Error("查询订单失败", "message_id", d.MessageId, "err", err)
+				_ = d.Nack(false, true)
+				return nil
 			}
+			logger.Warn("库存预占已过期释放，跳过下单", "message_id", d.MessageId)
+			markFailed(ctx, h.resultDao, d.MessageId, "下单超时，库存已释放")
+			_ = d.Ack(false)
+			return nil
 		}
-		var m SeckillMessage
-		if err := json.Unmarshal(d.Body, &m); err != nil {
-			logger.Error("订单创建消息解析失败", "err", err)
-			// 解析失败属于不可恢复错误，直接丢入死信队列，不重试
-			_ = d.Nack(false, false)
-			continue
+	}
+	// 激进派策略：不再扣减MySQL库存，直接信任Redis的扣减结果（库存由Redis+Reconciler保障）
+	// 优势：数据库写入性能翻倍（少了一次行锁竞争和Update操作）
+	// 风险：如果Redis挂了且数据丢失，MySQL库存会偏多（少卖），但绝不会超卖（因为Redis挡住了）
+	order := &model.Order{
+		ID:         m.OrderID,
+		UserID:     m.UserID,
+		ProductID:  m.ProductID,
+		ActivityID: m.ActivityID,
+		Quantity:   m.Quantity,
+		TotalPrice: m.TotalPrice,
+		Status:     model.OrderStatusPending,
+	}
+	if d.MessageId != "" {
+		msgID := d.MessageId
+		order.MessageID = &msgID
+	}
+	if h.uniqueSeckill {
+		seckillKey := model.SeckillOrderKey(m.UserID, m.ProductID, m.ActivityID)
+		order.SeckillKey = &seckillKey
+	}
+	return &pendingOrder{d: d, orderID: m.OrderID, order: order}
+}
+
+// flush 单事务批量写入，成功后一次 Ack(multiple=true)；
+// 批量失败时逐条写入，唯一索引冲突按已处理确认，只有真正失败的消息进入死信
+func (h *orderCreator) flush(batch []*pendingOrder) {
+	if len(batch) == 0 {
+		return
+	}
+	orders := make([]*model.Order, len(batch))
+	for i, p := range batch {
+		orders[i] = p.order
+	}
+	ctx, span := startBatchSpan(batch)
+	err := h.orderDao.CreateOrdersBatch(ctx, orders)
+	tracing.RecordError(span, err)
+	span.End()
+	if err == nil {
+		for _, p := range batch {
+			h.onCreated(p)
 		}
-		// 事务：仅创建订单（库存扣减已由Redis+Reconciler保障）
-		err = db.Transaction(func(tx *gorm.DB) error {
-			// 1. 激进派策略：不再扣减MySQL库存，直接信任Redis的扣减结果
-			// 优势：数据库写入性能翻倍（少了一次行锁竞争和Update操作）
-			// 风险：如果Redis挂了且数据丢失，MySQL库存会偏多（少卖），但绝不会超卖（因为Redis挡住了）
-
-			// 2. 创建订单
-			order := &model.Order{
-				UserID:     m.UserID,
-				ProductID:  m.ProductID,
-				Quantity:   m.Quantity,
-				TotalPrice: m.TotalPrice,
-				Status:     model.OrderStatusPending,
+		// 批内消息的 delivery tag 递增，确认最后一条即确认整批（此前已单独确认/拒绝的不受影响）
+		_ = batch[len(batch)-1].d.Ack(true)
+		return
+	}
+
+	logger.Warn("批量创建订单失败，降级逐条写入", "size", len(batch), "err", err)
+	for _, p := range batch {
+		// 事务已回滚，恢复预分配的主键（未预分配时清除批量插入回填的自增ID）
+		p.order.ID = p.orderID
+		if err := h.orderDao.CreateOrder(mq.DeliveryContext(p.d), p.order); err != nil {
+			if errors.Is(err, dao.ErrDuplicateOrderMessage) || errors.Is(err, dao.ErrDuplicateSeckillOrder) {
+				h.onDuplicate(p, err)
+				continue
 			}
-			return tx.Create(order).Error
-		})
-		if err != nil {
-			logger.Error("处理消息失败", "err", err)
-			// 关键修改：requeue=false，将失败消息投递到死信队列，防止无限循环
-			_ = d.Nack(false, false)
-			rdb.Del(context.Background(), key) // 消费失败，删除幂等key，允许重试（如果后续有人处理死信队列并重发）
+			h.onFailed(p, err)
 			continue
 		}
+		h.onCreated(p)
+		_ = p.d.Ack(false)
+	}
+}
+
+// onCreated 订单落库后确认预占、记录结果并投递支付超时检查
+func (h *orderCreator) onCreated(p *pendingOrder) {
+	ctx := mq.DeliveryContext(p.d)
+	orderID := p.order.ID
+	// 记录下单成功，供用户凭ticket查询订单号（失败不影响订单本身）
+	if p.d.MessageId != "" {
+		h.rdb.Set(ctx, doneKey(p.d.MessageId), 1, 30*time.Minute)
+		if err := h.reservationDao.ConfirmReservation(ctx, p.d.MessageId); err != nil {
+			logger.Warn("确认库存预占失败", "message_id", p.d.MessageId, "err", err)
+		}
+		if err := h.resultDao.MarkCreated(ctx, p.d.MessageId, orderID); err != nil {
+			logger.Warn("记录秒杀结果失败", "message_id", p.d.MessageId, "order_id", orderID, "err", err)
+		}
+	}
+	// 投递支付超时检查，超时未支付由 order_timeout_consumer 自动取消并归还库存
+	schedulePaymentTimeout(ctx, h.mqPool, orderID, h.paymentTimeout)
+}
+
+// onDuplicate 唯一索引冲突：同一消息已落库则按成功处理；
+// 用户已有该活动订单（seckill_key 冲突）则确认消息、结果标记失败并归还本次预占
+func (h *orderCreator) onDuplicate(p *pendingOrder, err error) {
+	d := p.d
+	ctx := mq.DeliveryContext(d) // 确认后消费 span 即结束，提前取出
+	if errors.Is(err, dao.ErrDuplicateOrderMessage) {
+		existing, qerr := h.orderDao.GetOrderByMessageID(ctx, d.MessageId)
+		if qerr != nil {
+			h.onFailed(p, qerr)
+			return
+		}
+		logger.Warn("订单已存在，按已处理确认", "message_id", d.MessageId, "order_id", existing.ID)
+		h.onCreated(&pendingOrder{d: d, order: existing})
 		_ = d.Ack(false)
+		return
+	}
+	logger.Warn("用户已有该活动订单，拒绝重复下单", "message_id", d.MessageId, "user_id", p.order.UserID, "activity_id", p.order.ActivityID)
+	_ = d.Ack(false)
+	markFailed(ctx, h.resultDao, d.MessageId, "每人限购一单，已存在该活动订单")
+	if d.MessageId != "" {
+		if err := h.reservationDao.AbandonReservation(ctx, d.MessageId, time.Now().Unix()); err != nil {
+			logger.Error("放弃库存预占失败", "message_id", d.MessageId, "err", err)
+		}
 	}
 }
 
-// setupDLQ 声明死信交换机和死信队列
-func setupDLQ(cfg *config.MQConfig) error {
-	url := fmt.Sprintf("amqp://%s:%s@%s:%d/", cfg.User, cfg.Password, cfg.Host, cfg.Port)
-	conn, err := amqp.Dial(url)
-	if err != nil {
-		return fmt.Errorf("dial rabbitmq failed: %w", err)
+// onFailed 单条订单写入失败：优先延迟重试（预占保持认领状态），次数用尽后进入死信队列，预占保留至重放或丢弃
+func (h *orderCreator) onFailed(p *pendingOrder, err error) {
+	d := p.d
+	ctx := mq.DeliveryContext(d)
+	logger.Error("处理消息失败", "message_id", d.MessageId, "attempt", mq.RetryAttempt(d), "err", err)
+	if h.consumer.Retry(d) {
+		return
 	}
-	defer conn.Close()
+	// 保留预占（不再过期、清理进程不释放）：死信重放后可再次认领并下单，丢弃死信时才归还库存
+	if d.MessageId != "" {
+		if _, err := h.reservationDao.HoldReservation(ctx, d.MessageId); err != nil {
+			logger.Error("保留库存预占失败", "message_id", d.MessageId, "err", err)
+		}
+	}
+	// 关键修改：requeue=false，将失败消息投递到死信队列，防止无限循环
+	_ = d.Nack(false, false)
+	markFailed(ctx, h.resultDao, d.MessageId, "订单创建失败")
+}
 
-	ch, err := conn.Channel()
+// schedulePaymentTimeout 投递支付超时延迟消息（失败仅告警，用户仍可手动取消）
+func schedulePaymentTimeout(ctx context.Context, mqPool *mq.Pool, orderID int64, delay time.Duration) {
+	body, err := json.Marshal(OrderTimeoutMessage{OrderID: orderID})
 	if err != nil {
-		return fmt.Errorf("open channel failed: %w", err)
+		logger.Warn("支付超时消息序列化失败", "order_id", orderID, "err", err)
+		return
+	}
+	msgID := fmt.Sprintf("timeout:%d", orderID)
+	if err := mqPool.PublishDelayedWithID(ctx, seckillExchange, paymentDelayKey, body, msgID, delay); err != nil {
+		logger.Warn("支付超时消息投递失败", "order_id", orderID, "err", err)
 	}
-	defer ch.Close()
+}
+
+// startBatchSpan 批量落库跨越多条链路：单独成链，并关联批内每条消息的消费 span
+func startBatchSpan(batch []*pendingOrder) (context.Context, trace.Span) {
+	links := make([]trace.Link, 0, len(batch))
+	for _, p := range batch {
+		links = append(links, trace.LinkFromContext(mq.DeliveryContext(p.d)))
+	}
+	return tracing.Tracer().Start(context.Background(), "create orders batch",
+		trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("batch.size", len(batch))),
+	)
+}
+
+// markFailed 记录秒杀下单失败（消息进入死信队列）
+func markFailed(ctx context.Context, resultDao *dao.SeckillResultDao, ticket, reason string) {
+	if ticket == "" {
+		return
+	}
+	if err := resultDao.MarkFailed(ctx, ticket, reason); err != nil {
+		logger.Warn("记录秒杀结果失败", "message_id", ticket, "err", err)
+	}
+}
 
+// declareDLQ 声明死信交换机和死信队列
+func declareDLQ(ch *amqp.Channel) error {
 	// 1. 声明死信交换机 (修改为 Topic 类型，以便接收所有死信)
 	if err := ch.ExchangeDeclare(dlxName, "topic", true, false, false, false, nil); err != nil {
 		return fmt.Errorf("declare dlx failed: %w", err)
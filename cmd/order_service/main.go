@@ -2,22 +2,30 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 
 	"github.com/CCDD2022/seckill-system/internal/dao"
 	"github.com/CCDD2022/seckill-system/internal/dao/mysql"
-	"github.com/CCDD2022/seckill-system/internal/mq"
+	redisinit "github.com/CCDD2022/seckill-system/internal/dao/redis"
 	"github.com/CCDD2022/seckill-system/internal/service"
 	"github.com/CCDD2022/seckill-system/pkg/app"
+	"github.com/CCDD2022/seckill-system/pkg/idgen"
 	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/CCDD2022/seckill-system/pkg/tracing"
 	"github.com/CCDD2022/seckill-system/proto_output/order"
+	goredis "github.com/redis/go-redis/v9"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
 
 func main() {
 	cfg := app.BootstrapApp()
+	rt := app.NewRuntime(cfg)
+	rt.ServeMetrics(cfg.Metrics.AddrFor("order_service"))
+	rt.InitTracing(cfg.Tracing, "order_service")
 
 	db, err := mysql.InitDB(&cfg.Database.Mysql)
 	if err != nil {
@@ -27,30 +35,48 @@ func main() {
 	logger.Info("数据库连接成功")
 	orderDao := dao.NewOrderDao(db)
 
-	mqPool, err := mq.Init(&cfg.MQ)
-	if err != nil {
-		logger.Warn("init mq failed", "err", err)
-	}
-
-	// 声明基础交换机
-	if mqPool != nil {
-		if err := mqPool.EnsureBaseTopology(); err != nil {
-			logger.Warn("ensure exchange failed", "err", err)
+	// 订单ID生成器：lease 模式需要 Redis 租用 workerID
+	var rdb goredis.UniversalClient
+	if cfg.IDGen.Mode != "static" {
+		if rdb, err = redisinit.InitRedis(&cfg.Database.Redis); err != nil {
+			logger.Error("连接Redis失败", "err", err)
+			return
 		}
 	}
+	idGen, err := idgen.NewFromConfig(&cfg.IDGen, rdb)
+	if err != nil {
+		logger.Error("初始化订单ID生成器失败", "err", err)
+		return
+	}
 
-	orderService := service.NewOrderServiceWithMQ(orderDao, mqPool)
-	grpcServer := grpc.NewServer()
+	// 订单事件写入发件箱，由 outbox_relay 投递，本服务不再直连 RabbitMQ
+	orderService := service.NewOrderService(orderDao, idGen)
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(metrics.UnaryServerInterceptor()), tracing.ServerOption())
 	reflection.Register(grpcServer)
 	order.RegisterOrderServiceServer(grpcServer, orderService)
 
+	// 健康检查：依赖不可用时为 NOT_SERVING
+	hc := app.NewHealth(grpcServer, "order")
+	hc.AddCheck("mysql", func(ctx context.Context) error { return mysql.Ping(ctx, db) })
+	if rdb != nil {
+		hc.AddCheck("redis", func(ctx context.Context) error { return rdb.Ping(ctx).Err() })
+	}
+	// workerID 租约丢失期间无法生成订单ID，重新租用成功后恢复
+	hc.AddCheck("idgen", func(context.Context) error { return idGen.Ping() })
+
 	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Services.OrderService.Host, cfg.Services.OrderService.Port))
 	if err != nil {
 		logger.Error("监听端口失败", "err", err)
 		return
 	}
 	logger.Info("Order gRPC service started", "port", cfg.Services.OrderService.Port)
-	if err := grpcServer.Serve(lis); err != nil {
-		logger.Error("gRPC服务启动失败", "err", err)
+	rt.ServeGRPC("grpc", grpcServer, lis)
+	rt.Go("health", hc.Run)
+	// 先释放 workerID 租约（需要 Redis）
+	rt.OnClose("idgen", func(context.Context) error { idGen.Close(); return nil })
+	if rdb != nil {
+		rt.OnClose("redis", func(context.Context) error { return rdb.Close() })
 	}
+	rt.OnClose("mysql", func(context.Context) error { return mysql.Close(db) })
+	rt.Wait()
 }
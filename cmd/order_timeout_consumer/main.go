@@ -0,0 +1,150 @@
+// 订单支付超时消费入口：待支付订单超时自动取消，并经发件箱发布 order.canceled 事件归还库存
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/internal/dao"
+	"github.com/CCDD2022/seckill-system/internal/dao/mysql"
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"github.com/CCDD2022/seckill-system/internal/mq"
+	"github.com/CCDD2022/seckill-system/pkg/app"
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/streadway/amqp"
+	"gorm.io/gorm"
+)
+
+// OrderTimeoutMessage 支付超时检查消息（由 order_create_consumer 经延迟队列投递）
+type OrderTimeoutMessage struct {
+	OrderID int64 `json:"order_id"`
+}
+
+// OrderCanceledEvent 与订单服务发布的取消事件保持一致，由 order_cancel_consumer 归还库存
+type OrderCanceledEvent struct {
+	EventID    string `json:"event_id"`
+	OccurredAt int64  `json:"occurred_at"`
+	OrderID    int64  `json:"order_id"`
+	UserID     int64  `json:"user_id"`
+	ProductID  int64  `json:"product_id"`
+	ActivityID int64  `json:"activity_id"`
+	Quantity   int32  `json:"quantity"`
+}
+
+const (
+	queuePaymentTimeout = "order.payment.timeout"
+	paymentTimeoutKey   = "order.payment.timeout"
+	orderCanceledKey    = "order.canceled"
+	seckillExchange     = "seckill.exchange"
+	// 死信交换机与队列配置
+	dlxName = "seckill.dlx"
+)
+
+func main() {
+	cfg := app.BootstrapApp()
+	rt := app.NewRuntime(cfg)
+	rt.ServeMetrics(cfg.Metrics.AddrFor("order_timeout_consumer"))
+	rt.InitTracing(cfg.Tracing, "order_timeout_consumer")
+
+	db, err := mysql.InitDB(&cfg.Database.Mysql)
+	if err != nil {
+		logger.Fatal("连接Mysql数据库失败", "err", err)
+	}
+	orderDao := dao.NewOrderDao(db)
+
+	args := amqp.Table{
+		"x-dead-letter-exchange": dlxName,
+	}
+	// 断线后自动重连并重新声明队列
+	consumer := mq.NewConsumer(&cfg.MQ, mq.ConsumerSpec{
+		Queue:    queuePaymentTimeout,
+		BindKey:  paymentTimeoutKey,
+		Exchange: seckillExchange,
+		Durable:  true,
+		Prefetch: cfg.MQ.ConsumerPrefetch,
+		Args:     args,
+		// 查询/取消订单失败（MySQL 不可用等）先进入重试延迟队列，用尽次数后才进入死信
+		Retry: mq.NewRetryPolicy(&cfg.MQ),
+	})
+
+	logger.Info("Order Timeout Consumer started", "payment_timeout_seconds", cfg.Order.PaymentTimeoutSeconds)
+
+	go consumer.Run(func(msgs <-chan amqp.Delivery) {
+		for d := range msgs {
+			handleTimeout(d, consumer, orderDao)
+		}
+	})
+
+	rt.OnStop("consumer", consumer.Shutdown)
+	rt.OnClose("mysql", func(context.Context) error { return mysql.Close(db) })
+	rt.Wait()
+}
+
+// handleTimeout 处理单条支付超时消息
+func handleTimeout(d amqp.Delivery, consumer *mq.Consumer, orderDao *dao.OrderDao) {
+	ctx := mq.DeliveryContext(d)
+	var m OrderTimeoutMessage
+	if err := json.Unmarshal(d.Body, &m); err != nil || m.OrderID <= 0 {
+		logger.Error("支付超时消息解析失败", "err", err)
+		_ = d.Nack(false, false)
+		return
+	}
+
+	ord, err := orderDao.GetOrderByID(ctx, m.OrderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			_ = d.Ack(false)
+			return
+		}
+		logger.Error("查询订单失败", "order_id", m.OrderID, "attempt", mq.RetryAttempt(d), "err", err)
+		retryOrDeadLetter(consumer, d)
+		return
+	}
+
+	evt, err := canceledEvent(ord)
+	if err != nil {
+		logger.Error("订单取消事件序列化失败", "order_id", ord.ID, "err", err)
+		_ = d.Nack(false, false)
+		return
+	}
+
+	// 条件更新：只有仍处于待支付的订单才会被取消，已支付/已取消直接忽略
+	// 取消事件与状态变更同一事务写入发件箱，由 outbox_relay 投递到 order.canceled 归还库存
+	err = orderDao.CancelOrder(ctx, ord.ID, evt)
+	if errors.Is(err, dao.ErrOrderStatusChanged) {
+		_ = d.Ack(false)
+		return
+	}
+	if err != nil {
+		logger.Error("超时取消订单失败", "order_id", ord.ID, "attempt", mq.RetryAttempt(d), "err", err)
+		retryOrDeadLetter(consumer, d)
+		return
+	}
+	logger.Info("订单支付超时，已自动取消", "order_id", ord.ID, "event_id", evt.EventID)
+	_ = d.Ack(false)
+}
+
+// retryOrDeadLetter 临时错误延迟重试，避免数据库故障期间立即重新入队造成热循环；次数用尽进入死信队列，人工介入
+func retryOrDeadLetter(consumer *mq.Consumer, d amqp.Delivery) {
+	if consumer.Retry(d) {
+		return
+	}
+	_ = d.Nack(false, false)
+}
+
+// canceledEvent 构建订单取消事件的发件箱记录
+func canceledEvent(ord *model.Order) (*model.OutboxEvent, error) {
+	evt := OrderCanceledEvent{
+		EventID:    fmt.Sprintf("%d-%d-%d-%s", ord.ID, ord.ProductID, ord.UserID, "timeout"),
+		OccurredAt: time.Now().Unix(),
+		OrderID:    ord.ID,
+		UserID:     ord.UserID,
+		ProductID:  ord.ProductID,
+		ActivityID: ord.ActivityID,
+		Quantity:   ord.Quantity,
+	}
+	return model.NewOutboxEvent(evt.EventID, seckillExchange, orderCanceledKey, evt)
+}
@@ -0,0 +1,92 @@
+// 事务发件箱投递入口：轮询 outbox_events 中的待投递事件，发布到 RabbitMQ 并在 Broker 确认后标记已投递
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/internal/dao"
+	"github.com/CCDD2022/seckill-system/internal/dao/mysql"
+	"github.com/CCDD2022/seckill-system/internal/mq"
+	"github.com/CCDD2022/seckill-system/pkg/app"
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+)
+
+const (
+	relayBatch    = 100                    // 每轮最多投递的事件数
+	relayInterval = 500 * time.Millisecond // 轮询间隔
+)
+
+func main() {
+	cfg := app.BootstrapApp()
+	rt := app.NewRuntime(cfg)
+	rt.ServeMetrics(cfg.Metrics.AddrFor("outbox_relay"))
+
+	db, err := mysql.InitDB(&cfg.Database.Mysql)
+	if err != nil {
+		logger.Fatal("连接Mysql数据库失败", "err", err)
+	}
+	outboxDao := dao.NewOutboxDao(db)
+
+	// 复用生产者通道池：mandatory 发布并逐条等待确认，断线由池自动重连
+	mqPool, err := mq.Init(&cfg.MQ)
+	if err != nil {
+		logger.Fatal("init mq pool failed", "err", err)
+	}
+	if err := mqPool.EnsureBaseTopology(); err != nil {
+		logger.Fatal("ensure mq topology failed", "err", err)
+	}
+
+	logger.Info("Outbox Relay started")
+	rt.Go("relay", func(stop context.Context) {
+		relay(stop, outboxDao, mqPool)
+	})
+	rt.OnClose("mq", mqPool.Shutdown)
+	rt.OnClose("mysql", func(context.Context) error { return mysql.Close(db) })
+	rt.Wait()
+}
+
+// relay 定时投递待发送事件直到 stop 结束；正在等待确认的事件处理完后才退出，确认后的标记不会被中断
+// 事件以 mandatory 发布：路由键未绑定队列时 Broker 退回，按投递失败处理，不会被确认后丢弃
+func relay(stop context.Context, outboxDao *dao.OutboxDao, mqPool *mq.Pool) {
+	ctx := context.Background()
+
+	ticker := time.NewTicker(relayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop.Done():
+			return
+		case <-ticker.C:
+		}
+
+		events, err := outboxDao.FetchPending(ctx, relayBatch)
+		if err != nil {
+			logger.Error("查询待投递事件失败", "err", err)
+			continue
+		}
+		for _, evt := range events {
+			// 收到退出信号后不再开始新的投递，剩余事件由下次启动投递
+			if stop.Err() != nil {
+				return
+			}
+			if err := mqPool.PublishAndWait(ctx, evt.Exchange, evt.RoutingKey, []byte(evt.Payload), evt.EventID); err != nil {
+				if errors.Is(err, mq.ErrPublishReturned) {
+					logger.Error("ALARM: 发件箱事件无法路由，路由键未绑定队列", "event_id", evt.EventID,
+						"exchange", evt.Exchange, "routing_key", evt.RoutingKey, "attempts", evt.Attempts+1)
+				} else {
+					logger.Warn("发件箱事件投递失败", "event_id", evt.EventID, "attempts", evt.Attempts+1, "err", err)
+				}
+				_ = outboxDao.MarkAttemptFailed(ctx, evt.ID, err.Error())
+				// 下一轮按顺序重试（Broker不可用时由通道池重连）
+				break
+			}
+			// 已确认但标记失败时事件会被重复投递，消费端按 EventID 幂等
+			if err := outboxDao.MarkSent(ctx, evt.ID); err != nil {
+				logger.Error("标记事件已投递失败", "event_id", evt.EventID, "err", err)
+			}
+		}
+	}
+}
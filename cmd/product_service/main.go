@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 
@@ -10,6 +11,8 @@ import (
 	"github.com/CCDD2022/seckill-system/internal/service"
 	"github.com/CCDD2022/seckill-system/pkg/app"
 	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/CCDD2022/seckill-system/pkg/tracing"
 	"github.com/CCDD2022/seckill-system/proto_output/product"
 
 	"google.golang.org/grpc"
@@ -18,6 +21,9 @@ import (
 
 func main() {
 	cfg := app.BootstrapApp()
+	rt := app.NewRuntime(cfg)
+	rt.ServeMetrics(cfg.Metrics.AddrFor("product_service"))
+	rt.InitTracing(cfg.Tracing, "product_service")
 
 	db, err := mysql.InitDB(&cfg.Database.Mysql)
 	if err != nil {
@@ -31,16 +37,23 @@ func main() {
 	logger.Info("顺利连接数据库")
 
 	ProductDao := dao.NewProductDao(db, redisDB)
+	ActivityDao := dao.NewSeckillActivityDao(db, redisDB)
+	StockLogDao := dao.NewStockLogDao(db)
 	// 创建 Product Service
-	ProductService := service.NewProductService(ProductDao)
+	ProductService := service.NewProductService(ProductDao, ActivityDao, StockLogDao)
 
 	// 创建 gRPC 服务器
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(metrics.UnaryServerInterceptor()), tracing.ServerOption())
 	// 测试的时候会依赖反射调用  生产环境要去掉
 	reflection.Register(grpcServer)
 	// 当收到Product.ProductService/Register的时候  调用ProductService.Register方法
 	product.RegisterProductServiceServer(grpcServer, ProductService)
 
+	// 健康检查：依赖不可用时为 NOT_SERVING
+	hc := app.NewHealth(grpcServer, "product")
+	hc.AddCheck("mysql", func(ctx context.Context) error { return mysql.Ping(ctx, db) })
+	hc.AddCheck("redis", func(ctx context.Context) error { return redisDB.Ping(ctx).Err() })
+
 	// 启动 gRPC 服务器
 	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Services.ProductService.Host, cfg.Services.ProductService.Port))
 	if err != nil {
@@ -48,7 +61,9 @@ func main() {
 	}
 
 	logger.Info("Product gRPC service started on :", cfg.Services.ProductService.Port)
-	if err := grpcServer.Serve(lis); err != nil {
-		logger.Error("Failed to serve: ", "err", err)
-	}
+	rt.ServeGRPC("grpc", grpcServer, lis)
+	rt.Go("health", hc.Run)
+	rt.OnClose("redis", func(context.Context) error { return redisDB.Close() })
+	rt.OnClose("mysql", func(context.Context) error { return mysql.Close(db) })
+	rt.Wait()
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/internal/dao"
+	"github.com/CCDD2022/seckill-system/internal/dao/mysql"
+	redisinit "github.com/CCDD2022/seckill-system/internal/dao/redis"
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"github.com/CCDD2022/seckill-system/pkg/app"
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+)
+
+const sweepBatch = 200 // 每轮最多释放的预占数
+
+// 库存预占清理：ExecuteSeckill 预占库存后，若订单消息丢失或进入死信，
+// 库存与限购额度会一直被占用。这里定时扫描到期未被下单消费者认领的预占，按记录原样归还
+func main() {
+	cfg := app.BootstrapApp()
+	rt := app.NewRuntime(cfg)
+	rt.ServeMetrics(cfg.Metrics.AddrFor("reservation_sweeper"))
+
+	// 预热库存时需要从MySQL加载
+	db, err := mysql.InitDB(&cfg.Database.Mysql)
+	if err != nil {
+		logger.Fatal("连接Mysql数据库失败", "err", err)
+	}
+
+	rdb, err := redisinit.InitRedis(&cfg.Database.Redis)
+	if err != nil {
+		logger.Fatal("连接Redis失败", "err", err)
+	}
+
+	productDao := dao.NewProductDao(db, rdb)
+	activityDao := dao.NewSeckillActivityDao(db, rdb)
+	reservationDao := dao.NewSeckillReservationDao(rdb)
+	resultDao := dao.NewSeckillResultDao(rdb)
+
+	logger.Info("Reservation Sweeper started", "interval_seconds", cfg.Seckill.SweepIntervalSeconds)
+	rt.Go("sweeper", func(stop context.Context) {
+		ctx := context.Background()
+
+		ticker := time.NewTicker(time.Duration(cfg.Seckill.SweepIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop.Done():
+				return
+			case <-ticker.C:
+			}
+			tickets, err := reservationDao.ListExpired(ctx, time.Now().Unix(), sweepBatch)
+			if err != nil {
+				logger.Error("查询到期预占失败", "err", err)
+				continue
+			}
+			// 单个预占的释放不中断，收到退出信号后不再处理剩余预占
+			for _, ticket := range tickets {
+				if stop.Err() != nil {
+					return
+				}
+				sweep(ctx, productDao, activityDao, reservationDao, resultDao, ticket)
+			}
+		}
+	})
+	rt.OnClose("redis", func(context.Context) error { return rdb.Close() })
+	rt.OnClose("mysql", func(context.Context) error { return mysql.Close(db) })
+	rt.Wait()
+}
+
+// sweep 释放单个到期预占：归还库存与限购额度，并把秒杀结果标记为失败
+// 释放脚本本身幂等且会跳过已被认领的预占，多实例并发执行也是安全的
+func sweep(ctx context.Context, productDao *dao.ProductDao, activityDao *dao.SeckillActivityDao,
+	reservationDao *dao.SeckillReservationDao, resultDao *dao.SeckillResultDao, ticket string) {
+	r, err := reservationDao.GetReservation(ctx, ticket)
+	if errors.Is(err, dao.ErrReservationNotFound) {
+		// 记录已过期删除，清理台账残留
+		_ = reservationDao.RemoveFromLedger(ctx, ticket)
+		return
+	}
+	if err != nil {
+		logger.Error("读取预占记录失败", "ticket", ticket, "err", err)
+		return
+	}
+
+	op := dao.StockOp{Reason: model.StockReasonReservationRelease, Actor: model.SystemActor("reservation_sweeper"), Ref: ticket}
+	if r.ActivityID > 0 {
+		err = activityDao.ReleaseReservation(ctx, r.ActivityID, ticket, op)
+	} else {
+		err = productDao.ReleaseReservation(ctx, r.ProductID, ticket, op)
+	}
+	switch {
+	case err == nil:
+		logger.Info("到期预占已释放", "ticket", ticket, "product_id", r.ProductID, "activity_id", r.ActivityID, "qty", r.Quantity)
+		if err := resultDao.MarkFailed(ctx, ticket, "下单超时，库存已释放"); err != nil {
+			logger.Warn("记录秒杀结果失败", "ticket", ticket, "err", err)
+		}
+	case errors.Is(err, dao.ErrReservationClaimed), errors.Is(err, dao.ErrReservationNotFound):
+		// 下单消费者已认领或已被其他实例释放
+	default:
+		logger.Error("释放到期预占失败", "ticket", ticket, "err", err)
+	}
+}
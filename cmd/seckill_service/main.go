@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"time"
@@ -11,7 +12,10 @@ import (
 	"github.com/CCDD2022/seckill-system/internal/mq"
 	"github.com/CCDD2022/seckill-system/internal/service"
 	"github.com/CCDD2022/seckill-system/pkg/app"
+	"github.com/CCDD2022/seckill-system/pkg/idgen"
 	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/CCDD2022/seckill-system/pkg/tracing"
 	"github.com/CCDD2022/seckill-system/proto_output/seckill"
 
 	"google.golang.org/grpc"
@@ -20,6 +24,9 @@ import (
 
 func main() {
 	cfg := app.BootstrapApp()
+	rt := app.NewRuntime(cfg)
+	rt.ServeMetrics(cfg.Metrics.AddrFor("seckill_service"))
+	rt.InitTracing(cfg.Tracing, "seckill_service")
 
 	// 连接数据库
 	db, err := mysql.InitDB(&cfg.Database.Mysql)
@@ -46,7 +53,6 @@ func main() {
 	if err != nil {
 		logger.Fatal("init mq failed", "err", err)
 	}
-	defer mqPool.Close()
 	if err := mqPool.EnsureBaseTopology(); err != nil {
 		logger.Fatal("ensure base topology failed", "err", err)
 	}
@@ -55,8 +61,32 @@ func main() {
 	// 创建ProductDao
 	productDao := dao.NewProductDao(db, redisDB)
 
-	// 创建 Seckill Service（传入生产者池）
-	seckillService := service.NewSeckillService(productDao, redisDB, mqPool)
+	// 秒杀活动与秒杀结果（ticket -> 下单状态）
+	activityDao := dao.NewSeckillActivityDao(db, redisDB)
+	resultDao := dao.NewSeckillResultDao(redisDB)
+
+	// 本地溢写日志（可选）：MQ不可用时订单消息先落盘，后台按原 MessageId 重放
+	var spill *mq.SpillLog
+	if cfg.Seckill.Spill.Enabled {
+		spill, err = mq.OpenSpillLog(cfg.Seckill.Spill.Path, cfg.Seckill.Spill.MaxBytes, cfg.Seckill.Spill.MaxReplayAttempts)
+		if err != nil {
+			logger.Fatal("open spill log failed", "err", err)
+		}
+		rt.Go("spill replayer", func(ctx context.Context) {
+			spill.RunReplayer(ctx, mqPool, time.Duration(cfg.Seckill.Spill.ReplayIntervalMs)*time.Millisecond)
+		})
+		logger.Info("MQ spill log enabled", "path", cfg.Seckill.Spill.Path, "depth", spill.Depth())
+	}
+
+	// 订单ID生成器：workerID 由配置指定或通过 Redis 租用
+	idGen, err := idgen.NewFromConfig(&cfg.IDGen, redisDB)
+	if err != nil {
+		logger.Fatal("init id generator failed", "err", err)
+	}
+	logger.Info("Order ID generator ready", "mode", cfg.IDGen.Mode, "worker_id", idGen.WorkerID())
+
+	// 创建 Seckill Service（传入生产者池、溢写日志、订单ID生成器与限购配置）
+	seckillService := service.NewSeckillService(productDao, activityDao, resultDao, redisDB, mqPool, spill, idGen, cfg.Seckill)
 
 	// 创建 gRPC 服务器
 	grpcServer := grpc.NewServer(
@@ -65,10 +95,20 @@ func main() {
 		grpc.InitialWindowSize(1 << 24), // 16MB
         grpc.InitialConnWindowSize(1 << 24),
 		grpc.ConnectionTimeout(10*time.Second),
+		grpc.UnaryInterceptor(metrics.UnaryServerInterceptor()),
+		tracing.ServerOption(),
 	)
 	reflection.Register(grpcServer)
 	seckill.RegisterSeckillServiceServer(grpcServer, seckillService)
 
+	// 健康检查：依赖不可用时为 NOT_SERVING
+	hc := app.NewHealth(grpcServer, "seckill")
+	hc.AddCheck("mysql", func(ctx context.Context) error { return mysql.Ping(ctx, db) })
+	hc.AddCheck("redis", func(ctx context.Context) error { return redisDB.Ping(ctx).Err() })
+	hc.AddCheck("mq", func(context.Context) error { return mqPool.Ping() })
+	// workerID 租约丢失期间无法生成订单ID，重新租用成功后恢复
+	hc.AddCheck("idgen", func(context.Context) error { return idGen.Ping() })
+
 	// 启动 gRPC 服务器
 	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Services.SeckillService.Host, cfg.Services.SeckillService.Port))
 	if err != nil {
@@ -76,7 +116,16 @@ func main() {
 	}
 
 	logger.Info("Seckill gRPC service started on :", cfg.Services.SeckillService.Port)
-	if err := grpcServer.Serve(lis); err != nil {
-		logger.Error("Failed to serve: ", "err", err)
+	rt.ServeGRPC("grpc", grpcServer, lis)
+	rt.Go("health", hc.Run)
+	// 按注册顺序关闭：MQ 关闭时等待发布失败回调执行完（回滚预占、标记结果、写溢写日志），
+	// 溢写日志与 workerID 租约释放都在 Redis/MySQL 关闭之前
+	rt.OnClose("mq", mqPool.Shutdown)
+	if spill != nil {
+		rt.OnClose("spill log", func(context.Context) error { return spill.Close() })
 	}
+	rt.OnClose("idgen", func(context.Context) error { idGen.Close(); return nil })
+	rt.OnClose("redis", func(context.Context) error { return redisDB.Close() })
+	rt.OnClose("mysql", func(context.Context) error { return mysql.Close(db) })
+	rt.Wait()
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/internal/dao"
+	"github.com/CCDD2022/seckill-system/internal/dao/mysql"
+	redisinit "github.com/CCDD2022/seckill-system/internal/dao/redis"
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"github.com/CCDD2022/seckill-system/pkg/app"
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	consumerGroup = "stock_log_consumer"
+	readBatch     = 500
+	readBlock     = 2 * time.Second
+	claimInterval = 30 * time.Second
+	claimIdle     = time.Minute // 其他实例读取后超过该时长未确认的条目（实例已退出）由本实例接管
+)
+
+// 库存日志消费：以消费组读取 Redis 库存日志流（stock:log），批量写入 stock_logs 后确认并删除
+// 落库失败时不确认，条目保留在待确认列表中，稍后重试；多实例部署时各自读取不同条目
+func main() {
+	cfg := app.BootstrapApp()
+	rt := app.NewRuntime(cfg)
+	rt.ServeMetrics(cfg.Metrics.AddrFor("stock_log_consumer"))
+
+	db, err := mysql.InitDB(&cfg.Database.Mysql)
+	if err != nil {
+		logger.Fatal("连接Mysql数据库失败", "err", err)
+	}
+	rdb, err := redisinit.InitRedis(&cfg.Database.Redis)
+	if err != nil {
+		logger.Fatal("连接Redis失败", "err", err)
+	}
+	stockLogDao := dao.NewStockLogDao(db)
+
+	ctx := context.Background()
+	if err := rdb.XGroupCreateMkStream(ctx, dao.StockLogStreamKey, consumerGroup, "0").Err(); err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		logger.Fatal("创建库存日志消费组失败", "err", err)
+	}
+	host, _ := os.Hostname()
+	c := &logConsumer{rdb: rdb, dao: stockLogDao, name: fmt.Sprintf("%s-%d", host, os.Getpid())}
+	logger.Info("Stock Log Consumer started", "stream", dao.StockLogStreamKey, "group", consumerGroup, "consumer", c.name)
+
+	// 已读取的一批写入并确认后才退出；阻塞读取最长 readBlock，退出延迟不超过该值
+	rt.Go("consumer", c.run)
+	rt.OnClose("redis", func(context.Context) error { return rdb.Close() })
+	rt.OnClose("mysql", func(context.Context) error { return mysql.Close(db) })
+	rt.Wait()
+}
+
+type logConsumer struct {
+	rdb  redis.UniversalClient
+	dao  *dao.StockLogDao
+	name string
+}
+
+// run 先处理本实例名下未确认的条目（同名实例重启的情况），再读取新条目，直到 stop 结束
+func (c *logConsumer) run(stop context.Context) {
+	ctx := context.Background()
+	pending := true
+	lastClaim := time.Now()
+	for stop.Err() == nil {
+		id := ">"
+		if pending {
+			id = "0"
+		}
+		streams, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    consumerGroup,
+			Consumer: c.name,
+			Streams:  []string{dao.StockLogStreamKey, id},
+			Count:    readBatch,
+			Block:    readBlock,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			logger.Error("读取库存日志失败", "err", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		var entries []redis.XMessage
+		if len(streams) > 0 {
+			entries = streams[0].Messages
+		}
+		if pending && len(entries) == 0 {
+			pending = false
+		}
+		if len(entries) > 0 && !c.persist(ctx, entries) {
+			pending = true // 落库失败，稍后从待确认列表重试
+			time.Sleep(time.Second)
+		}
+
+		if time.Since(lastClaim) >= claimInterval {
+			lastClaim = time.Now()
+			c.claimStale(ctx)
+		}
+	}
+}
+
+// persist 解析并批量写入一批条目，成功后确认并删除；无法解析的条目记录日志后直接确认
+func (c *logConsumer) persist(ctx context.Context, entries []redis.XMessage) bool {
+	logs := make([]*model.StockLog, 0, len(entries))
+	ids := make([]string, 0, len(entries))
+	for _, m := range entries {
+		ids = append(ids, m.ID)
+		msg, err := model.ParseStockLogMessage(m.Values)
+		if err != nil {
+			logger.Error("库存日志格式错误，已丢弃", "id", m.ID, "values", m.Values, "err", err)
+			continue
+		}
+		logs = append(logs, msg.ToStockLog(m.ID))
+	}
+
+	if err := c.dao.CreateStockLogs(ctx, logs); err != nil {
+		logger.Error("保存库存日志失败", "count", len(logs), "err", err)
+		return false
+	}
+
+	// 已落库，确认后删除，日志流只保留未处理的条目
+	_, err := c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, dao.StockLogStreamKey, consumerGroup, ids...)
+		pipe.XDel(ctx, dao.StockLogStreamKey, ids...)
+		return nil
+	})
+	if err != nil {
+		// 未确认的条目会被重新处理，按 event_id 幂等
+		logger.Warn("确认库存日志失败", "count", len(ids), "err", err)
+	}
+	logger.Debug("库存日志已保存", "count", len(logs))
+	return true
+}
+
+// claimStale 接管已退出实例名下长时间未确认的条目
+func (c *logConsumer) claimStale(ctx context.Context) {
+	start := "0-0"
+	for {
+		entries, next, err := c.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   dao.StockLogStreamKey,
+			Group:    consumerGroup,
+			Consumer: c.name,
+			MinIdle:  claimIdle,
+			Start:    start,
+			Count:    readBatch,
+		}).Result()
+		if err != nil {
+			logger.Warn("接管未确认的库存日志失败", "err", err)
+			return
+		}
+		if len(entries) > 0 {
+			logger.Info("接管未确认的库存日志", "count", len(entries))
+			if !c.persist(ctx, entries) {
+				return
+			}
+		}
+		if next == "0-0" || next == "" {
+			return
+		}
+		start = next
+	}
+}
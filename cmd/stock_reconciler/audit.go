@@ -0,0 +1,520 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/config"
+	"github.com/CCDD2022/seckill-system/internal/dao"
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"github.com/CCDD2022/seckill-system/pkg/leader"
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	auditPageSize  = 1000
+	recheckDelay   = 3 * time.Second // 首轮发现偏差后间隔复核，过滤下单途中的瞬时偏差
+	reservationKey = "seckill:reservation:*"
+	reservationLog = "seckill:reservation:ledger"
+)
+
+// 偏差处理结果
+const (
+	actionReportOnly = "report_only" // 未开启自动修复或非主节点
+	actionRepaired   = "repaired"
+	actionEscalated  = "escalated" // 超出容忍度或已超卖，需人工处理
+	actionFailed     = "repair_failed"
+)
+
+// auditTarget 一类需要全量对账的库存
+type auditTarget struct {
+	flushTarget
+	kind        string // product / activity
+	orderColumn string // orders 中归属该库存的列
+	orderFilter string // 区分商品库存订单与活动库存订单
+}
+
+var auditTargets = []auditTarget{
+	{flushTarget: flushTargets[0], kind: "product", orderColumn: "product_id", orderFilter: "activity_id = 0"},
+	{flushTarget: flushTargets[1], kind: "activity", orderColumn: "activity_id", orderFilter: "activity_id > 0"},
+}
+
+// driftEntry 单个商品/活动的对账结果
+// 应有库存 = 基线 - 未取消订单数量 - 预占中数量；Redis 未预热时以 MySQL 库存作为权威库存
+type driftEntry struct {
+	Kind       string `json:"kind"`
+	ID         int64  `json:"id"`
+	RedisStock *int64 `json:"redis_stock"` // nil 表示库存键未预热
+	MySQLStock int64  `json:"mysql_stock"`
+	Baseline   int64  `json:"baseline"`
+	Sold       int64  `json:"sold"`
+	InFlight   int64  `json:"in_flight"`
+	Expected   int64  `json:"expected"`
+	Drift      int64  `json:"drift"`     // 权威库存 - 应有库存
+	MySQLLag   int64  `json:"mysql_lag"` // MySQL - Redis，待回写集合中的对象不计
+	// 历史商品没有库存基线，无法推算应有库存，只比对 Redis 与 MySQL
+	BaselineUnknown bool   `json:"baseline_unknown,omitempty"`
+	Action          string `json:"action"`
+}
+
+func (d *driftEntry) name() string {
+	return fmt.Sprintf("%s:%d", d.Kind, d.ID)
+}
+
+func (d *driftEntry) drifted() bool {
+	return d.Drift != 0 || d.MySQLLag != 0 || d.Expected < 0
+}
+
+// driftReport 一轮全量对账报告
+type driftReport struct {
+	GeneratedAt     time.Time     `json:"generated_at"`
+	Checked         int           `json:"checked"`
+	BaselineUnknown int           `json:"baseline_unknown"` // 历史商品无库存基线，仅比对 Redis 与 MySQL
+	Drifted         int           `json:"drifted"`
+	Repaired        int           `json:"repaired"`
+	Escalated       int           `json:"escalated"`
+	Entries         []*driftEntry `json:"entries"`
+}
+
+// auditor 全量对账：比对、复核、按策略修复并输出报告
+type auditor struct {
+	db      *gorm.DB
+	rdb     redis.UniversalClient
+	cfg     config.ReconcileConfig
+	elector *leader.Elector // 为空（-audit-once）时只报告不修复
+}
+
+// run 执行一轮全量对账
+func (a *auditor) run(ctx context.Context) (*driftReport, error) {
+	report := &driftReport{GeneratedAt: time.Now(), Entries: []*driftEntry{}}
+
+	var candidates []*driftEntry
+	for _, t := range auditTargets {
+		entries, err := a.audit(ctx, t, nil)
+		if err != nil {
+			return nil, fmt.Errorf("audit %s: %w", t.kind, err)
+		}
+		report.Checked += len(entries)
+		for _, e := range entries {
+			if e.BaselineUnknown {
+				report.BaselineUnknown++
+			}
+			if e.drifted() {
+				candidates = append(candidates, e)
+			}
+		}
+	}
+
+	// 复核：下单途中（预占已扣减、订单未落库等）的偏差会在短时间内消失，只处理两次结果一致的偏差
+	if len(candidates) > 0 {
+		time.Sleep(recheckDelay)
+		confirmed, err := a.recheck(ctx, candidates)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range confirmed {
+			a.resolve(ctx, e)
+			switch e.Action {
+			case actionRepaired:
+				report.Repaired++
+			case actionEscalated:
+				report.Escalated++
+			}
+		}
+		report.Entries = confirmed
+	}
+	report.Drifted = len(report.Entries)
+
+	metrics.AuditRuns.Inc()
+	metrics.AuditChecked.Set(float64(report.Checked))
+	metrics.AuditDrifted.Set(float64(report.Drifted))
+	metrics.AuditRepaired.Add(float64(report.Repaired))
+	metrics.AuditEscalated.Add(float64(report.Escalated))
+	metrics.AuditDrift.Reset()
+	for _, e := range report.Entries {
+		metrics.AuditDrift.WithLabelValues(e.Kind, strconv.FormatInt(e.ID, 10)).Set(float64(e.Drift))
+	}
+
+	if err := writeReport(a.cfg.ReportPath, report); err != nil {
+		logger.Error("写入库存偏差报告失败", "path", a.cfg.ReportPath, "err", err)
+	}
+	logger.Info("库存全量对账完成", "checked", report.Checked, "drifted", report.Drifted,
+		"repaired", report.Repaired, "escalated", report.Escalated, "baseline_unknown", report.BaselineUnknown)
+	return report, nil
+}
+
+// recheck 重新计算候选对象，保留偏差值与首轮一致的结果
+func (a *auditor) recheck(ctx context.Context, candidates []*driftEntry) ([]*driftEntry, error) {
+	first := make(map[string]*driftEntry, len(candidates))
+	idsByKind := make(map[string][]int64)
+	for _, e := range candidates {
+		first[e.name()] = e
+		idsByKind[e.Kind] = append(idsByKind[e.Kind], e.ID)
+	}
+
+	var confirmed []*driftEntry
+	for _, t := range auditTargets {
+		ids := idsByKind[t.kind]
+		if len(ids) == 0 {
+			continue
+		}
+		entries, err := a.audit(ctx, t, ids)
+		if err != nil {
+			return nil, fmt.Errorf("recheck %s: %w", t.kind, err)
+		}
+		for _, e := range entries {
+			prev := first[e.name()]
+			if prev != nil && e.drifted() && e.Drift == prev.Drift && e.MySQLLag == prev.MySQLLag {
+				confirmed = append(confirmed, e)
+			}
+		}
+	}
+	return confirmed, nil
+}
+
+// audit 计算一类库存的对账结果，ids 为空时全量
+// 各数据源无法在同一时刻读取，下单途中（预占已扣减、订单未落库或预占未确认）的对象会出现瞬时偏差，由复核过滤
+func (a *auditor) audit(ctx context.Context, t auditTarget, ids []int64) ([]*driftEntry, error) {
+	rows, err := a.loadStocks(ctx, t, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	redisStocks, err := a.loadRedisStocks(ctx, t, rows)
+	if err != nil {
+		return nil, err
+	}
+	inFlight, err := a.loadInFlight(ctx, t.kind)
+	if err != nil {
+		return nil, err
+	}
+	sold, err := a.loadSold(ctx, t, ids)
+	if err != nil {
+		return nil, err
+	}
+	dirty, err := a.loadDirty(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := a.loadPendingBaseline(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*driftEntry, 0, len(rows))
+	for _, r := range rows {
+		e := &driftEntry{
+			Kind:       t.kind,
+			ID:         r.ID,
+			RedisStock: redisStocks[r.ID],
+			MySQLStock: r.Stock,
+			Baseline:   r.Baseline + pending[r.ID], // 尚未回写的基线调整与 Redis 库存同步生效
+			Sold:       sold[r.ID],
+			InFlight:   inFlight[r.ID],
+		}
+		if e.RedisStock != nil && !dirty[r.ID] {
+			e.MySQLLag = e.MySQLStock - *e.RedisStock
+		}
+		if e.Baseline == 0 && (e.Sold > 0 || e.MySQLStock > 0) {
+			e.BaselineUnknown = true
+			e.Expected = e.authoritative()
+		} else {
+			e.Expected = e.Baseline - e.Sold - e.InFlight
+			e.Drift = e.authoritative() - e.Expected
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// authoritative 秒杀扣减以 Redis 为准，未预热时以 MySQL 为准（预热来源）
+func (d *driftEntry) authoritative() int64 {
+	if d.RedisStock != nil {
+		return *d.RedisStock
+	}
+	return d.MySQLStock
+}
+
+// resolve 按策略处理已确认的偏差：超卖或超出容忍度告警升级，容忍度内按配置自动修复
+func (a *auditor) resolve(ctx context.Context, e *driftEntry) {
+	severity := abs(e.Drift)
+	if e.Drift == 0 {
+		severity = abs(e.MySQLLag)
+	}
+	switch {
+	case e.Expected < 0 || severity > int64(a.cfg.Tolerance):
+		e.Action = actionEscalated
+		logger.Error("ALARM: 库存偏差超出容忍度，需人工处理", "target", e.name(), "redis", e.RedisStock, "mysql", e.MySQLStock,
+			"expected", e.Expected, "drift", e.Drift, "mysql_lag", e.MySQLLag, "tolerance", a.cfg.Tolerance)
+		return
+	case !a.cfg.AutoRepair || a.elector == nil:
+		e.Action = actionReportOnly
+		logger.Warn("发现库存偏差（未开启自动修复）", "target", e.name(), "drift", e.Drift, "mysql_lag", e.MySQLLag)
+		return
+	}
+
+	if err := a.repair(ctx, e); err != nil {
+		e.Action = actionFailed
+		logger.Error("库存偏差修复失败", "target", e.name(), "drift", e.Drift, "err", err)
+		return
+	}
+	e.Action = actionRepaired
+	logger.Warn("库存偏差已自动修复", "target", e.name(), "drift", e.Drift, "mysql_lag", e.MySQLLag)
+}
+
+// repair 修正权威库存：Redis 已预热时相对调整（不覆盖并发扣减），再授权并标记待回写由 flush 同步 MySQL；
+// 未预热时直接修正 MySQL（下次预热的来源）
+// 修复前校验任期，MySQL 修正与回写一样受 fence 保护
+func (a *auditor) repair(ctx context.Context, e *driftEntry) error {
+	token, ok := a.elector.Token()
+	if !ok {
+		return errFenced
+	}
+	t := targetOf(e.Kind)
+	if e.Drift != 0 {
+		logMsg := &model.StockLogMessage{Kind: e.Kind, TargetID: e.ID, Delta: int32(-e.Drift),
+			Reason: model.StockReasonAuditRepair, Actor: model.SystemActor("stock_reconciler")}
+		if e.RedisStock == nil {
+			err := fenced(ctx, a.db, token, func(tx *gorm.DB) error {
+				return tx.Exec("UPDATE "+t.table+" SET stock = stock - ?, updated_at = ? WHERE id = ?",
+					e.Drift, time.Now(), e.ID).Error
+			})
+			if err != nil {
+				return err
+			}
+			logMsg.Store, logMsg.StockAfter = model.StockStoreMySQL, e.MySQLStock-e.Drift
+			dao.AppendStockLog(ctx, a.rdb, logMsg)
+			return nil
+		}
+		adjustScript := `
+            if redis.call('exists', KEYS[1]) == 1 then
+                return redis.call('incrby', KEYS[1], ARGV[1])
+            end
+            return nil
+        `
+		stock, err := a.rdb.Eval(ctx, adjustScript, []string{t.stockKey(e.ID)}, -e.Drift).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if err == nil {
+			logMsg.Store, logMsg.StockAfter = model.StockStoreRedis, stock
+			dao.AppendStockLog(ctx, a.rdb, logMsg)
+		}
+	}
+	// 已核实的应有库存高于 MySQL 时授权回写上调，否则 guarded 回写会拒绝
+	if raise := e.Expected - e.MySQLStock; raise > 0 {
+		if err := a.rdb.HIncrBy(ctx, t.creditKey, strconv.FormatInt(e.ID, 10), raise).Err(); err != nil {
+			return err
+		}
+	}
+	return a.rdb.SAdd(ctx, t.dirtySetKey, e.ID).Err()
+}
+
+// stockRow 库存表中参与对账的字段
+type stockRow struct {
+	ID       int64
+	Stock    int64
+	Baseline int64
+}
+
+// loadStocks 按主键分页读取库存与基线
+func (a *auditor) loadStocks(ctx context.Context, t auditTarget, ids []int64) ([]stockRow, error) {
+	var rows []stockRow
+	if len(ids) > 0 {
+		err := a.db.WithContext(ctx).Table(t.table).
+			Select("id, stock, "+t.baselineColumn+" AS baseline").
+			Where("id IN ?", ids).Scan(&rows).Error
+		return rows, err
+	}
+	var lastID int64
+	for {
+		var page []stockRow
+		err := a.db.WithContext(ctx).Table(t.table).
+			Select("id, stock, "+t.baselineColumn+" AS baseline").
+			Where("id > ?", lastID).Order("id").Limit(auditPageSize).Scan(&page).Error
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, page...)
+		if len(page) < auditPageSize {
+			return rows, nil
+		}
+		lastID = page[len(page)-1].ID
+	}
+}
+
+// loadSold 汇总未取消订单的数量
+func (a *auditor) loadSold(ctx context.Context, t auditTarget, ids []int64) (map[int64]int64, error) {
+	var rows []struct {
+		ID  int64
+		Qty int64
+	}
+	q := a.db.WithContext(ctx).Model(&model.Order{}).
+		Select(t.orderColumn+" AS id, SUM(quantity) AS qty").
+		Where(t.orderFilter).
+		Where("status <> ?", model.OrderStatusCancelled)
+	if len(ids) > 0 {
+		q = q.Where(t.orderColumn+" IN ?", ids)
+	}
+	if err := q.Group(t.orderColumn).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	sold := make(map[int64]int64, len(rows))
+	for _, r := range rows {
+		sold[r.ID] = r.Qty
+	}
+	return sold, nil
+}
+
+// loadRedisStocks 批量读取 Redis 库存，未预热的对象不在结果中
+func (a *auditor) loadRedisStocks(ctx context.Context, t auditTarget, rows []stockRow) (map[int64]*int64, error) {
+	stocks := make(map[int64]*int64, len(rows))
+	for start := 0; start < len(rows); start += auditPageSize {
+		end := min(start+auditPageSize, len(rows))
+		cmds := make([]*redis.StringCmd, 0, end-start)
+		_, err := a.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, r := range rows[start:end] {
+				cmds = append(cmds, pipe.Get(ctx, t.stockKey(r.ID)))
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		for i, cmd := range cmds {
+			v, err := cmd.Int64()
+			if err != nil {
+				continue
+			}
+			stocks[rows[start+i].ID] = &v
+		}
+	}
+	return stocks, nil
+}
+
+// loadPendingBaseline 读取尚未回写 MySQL 的基线调整
+func (a *auditor) loadPendingBaseline(ctx context.Context, t auditTarget) (map[int64]int64, error) {
+	vals, err := a.rdb.HGetAll(ctx, t.baselineKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	pending := make(map[int64]int64, len(vals))
+	for k, v := range vals {
+		id, err1 := strconv.ParseInt(k, 10, 64)
+		delta, err2 := strconv.ParseInt(v, 10, 64)
+		if err1 == nil && err2 == nil {
+			pending[id] = delta
+		}
+	}
+	return pending, nil
+}
+
+// loadInFlight 汇总仍存在的库存预占（未认领、已认领待确认或待清理归还）
+func (a *auditor) loadInFlight(ctx context.Context, kind string) (map[int64]int64, error) {
+	var keys []string
+	iter := a.rdb.Scan(ctx, 0, reservationKey, auditPageSize).Iterator()
+	for iter.Next(ctx) {
+		if k := iter.Val(); k != reservationLog {
+			keys = append(keys, k)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	inFlight := make(map[int64]int64)
+	for start := 0; start < len(keys); start += auditPageSize {
+		end := min(start+auditPageSize, len(keys))
+		cmds := make([]*redis.SliceCmd, 0, end-start)
+		_, err := a.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, k := range keys[start:end] {
+				cmds = append(cmds, pipe.HMGet(ctx, k, "product_id", "activity_id", "quantity"))
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		for _, cmd := range cmds {
+			vals, err := cmd.Result()
+			if err != nil || len(vals) != 3 {
+				continue
+			}
+			productID, activityID, quantity := toInt64(vals[0]), toInt64(vals[1]), toInt64(vals[2])
+			switch {
+			case kind == "activity" && activityID > 0:
+				inFlight[activityID] += quantity
+			case kind == "product" && activityID == 0 && productID > 0:
+				inFlight[productID] += quantity
+			}
+		}
+	}
+	return inFlight, nil
+}
+
+// loadDirty 待回写集合中的对象 MySQL 落后属正常情况
+func (a *auditor) loadDirty(ctx context.Context, t auditTarget) (map[int64]bool, error) {
+	members, err := a.rdb.SMembers(ctx, t.dirtySetKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	dirty := make(map[int64]bool, len(members))
+	for _, m := range members {
+		if id, err := strconv.ParseInt(m, 10, 64); err == nil {
+			dirty[id] = true
+		}
+	}
+	return dirty, nil
+}
+
+// writeReport 先写临时文件再重命名，避免读取到半截报告
+func writeReport(path string, report *driftReport) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func targetOf(kind string) auditTarget {
+	for _, t := range auditTargets {
+		if t.kind == kind {
+			return t
+		}
+	}
+	panic("unknown audit target: " + kind)
+}
+
+func toInt64(v interface{}) int64 {
+	s, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/pkg/leader"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// electionName 多副本部署时通过 Redis 租约选出唯一主节点执行回写与全量对账
+const electionName = "stock_reconciler"
+
+// errFenced 当前任期已被新主节点取代，本次写入被拒绝
+var errFenced = errors.New("fenced: leadership lost")
+
+// term 当前任期：租约键与 fencing token
+type term struct {
+	leaderKey string
+	token     int64
+}
+
+// inflightKey 已弹出、尚未完成回写的脏id集合
+func (t flushTarget) inflightKey() string {
+	return t.dirtySetKey + ":inflight"
+}
+
+// popDirtyScript 校验任期后弹出一批脏id并记入在途集合
+// 在途集合中残留的id（上次回写失败、进程崩溃或旧主节点未完成）先放回脏集合，不会丢失
+// KEYS[1]=脏id集合 KEYS[2]=在途集合 KEYS[3]=租约键 ARGV[1]=token ARGV[2]=批量
+var popDirtyScript = redis.NewScript(`
+    if redis.call('get', KEYS[3]) ~= ARGV[1] then
+        return redis.error_reply('FENCED')
+    end
+    if redis.call('exists', KEYS[2]) == 1 then
+        redis.call('sunionstore', KEYS[1], KEYS[1], KEYS[2])
+        redis.call('del', KEYS[2])
+    end
+    local ids = redis.call('spop', KEYS[1], ARGV[2])
+    if #ids > 0 then
+        redis.call('sadd', KEYS[2], unpack(ids))
+    end
+    return ids
+`)
+
+// completeScript 校验任期后将已回写的id移出在途集合；任期已失效时保留，由新主节点重新回写
+// KEYS[1]=在途集合 KEYS[2]=租约键 ARGV[1]=token ARGV[2...]=id
+var completeScript = redis.NewScript(`
+    if redis.call('get', KEYS[2]) ~= ARGV[1] then
+        return 0
+    end
+    for i = 2, #ARGV do
+        redis.call('srem', KEYS[1], ARGV[i])
+    end
+    return 1
+`)
+
+// onElected 当选后推进 MySQL 侧 fence：此后旧任期的回写事务在比对 token 时失败
+// MySQL 中记录的 token 更高（Redis 计数器丢失）时推进计数器并放弃本次任期，下次当选即可恢复
+func onElected(ctx context.Context, db *gorm.DB, elector *leader.Elector, token int64) error {
+	err := db.WithContext(ctx).Exec("INSERT INTO leader_fences (name, token, updated_at) VALUES (?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE token = GREATEST(token, VALUES(token)), updated_at = VALUES(updated_at)",
+		electionName, token, time.Now()).Error
+	if err != nil {
+		return err
+	}
+	var current int64
+	if err := db.WithContext(ctx).Raw("SELECT token FROM leader_fences WHERE name = ?", electionName).Scan(&current).Error; err != nil {
+		return err
+	}
+	if current > token {
+		if err := elector.Advance(ctx, current); err != nil {
+			return err
+		}
+		return fmt.Errorf("token %d behind fence %d", token, current)
+	}
+	return nil
+}
+
+// fenced 在事务内对 fence 记录加共享锁并比对 token 后执行写入
+// 新主节点推进 fence 需等待进行中的写入提交，推进之后旧任期的写入一律失败
+func fenced(ctx context.Context, db *gorm.DB, token int64, fn func(tx *gorm.DB) error) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current int64
+		if err := tx.Raw("SELECT token FROM leader_fences WHERE name = ? LOCK IN SHARE MODE", electionName).Scan(&current).Error; err != nil {
+			return err
+		}
+		if current != token {
+			return errFenced
+		}
+		return fn(tx)
+	})
+}
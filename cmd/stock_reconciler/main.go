@@ -5,30 +5,81 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"math"
 	"strconv"
 	"time"
 
 	"github.com/CCDD2022/seckill-system/internal/dao/mysql"
 	redisinit "github.com/CCDD2022/seckill-system/internal/dao/redis"
 	"github.com/CCDD2022/seckill-system/pkg/app"
+	"github.com/CCDD2022/seckill-system/pkg/leader"
 	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
 )
 
 const (
-	dirtySetKey      = "product:dirty"        // 库存变更的商品id
-	stockKeyTemplate = "stock:%d"             // Redis里的库存Key
-	flushBatch       = 1000                   // 每次最多处理1000个商品
-	flushInterval    = 100 * time.Millisecond // 刷新间隔
+	flushBatch    = 1000                   // 每次最多处理1000个商品
+	flushInterval = 100 * time.Millisecond // 刷新间隔
 )
 
-func stockKey(id int64) string {
-	return fmt.Sprintf(stockKeyTemplate, id)
+// flushTarget 一类需要从Redis回写MySQL的库存
+type flushTarget struct {
+	dirtySetKey      string // 库存变更的id集合
+	creditKey        string // 授权上调额度 hash{id: quantity}
+	baselineKey      string // 待计入基线的调整 hash{id: delta}（管理员增减库存）
+	stockKeyTemplate string // Redis里的库存Key
+	table            string // 回写的MySQL表（stock列）
+	baselineColumn   string // 库存基线列：商品为累计投放量，活动为分配总量
+}
+
+// 商品库存与秒杀活动库存分别对账
+var flushTargets = []flushTarget{
+	{dirtySetKey: "product:dirty", creditKey: "product:stock_credit", baselineKey: "product:stock_baseline",
+		stockKeyTemplate: "stock:%d", table: "products", baselineColumn: "initial_stock"},
+	{dirtySetKey: "activity:dirty", creditKey: "activity:stock_credit", baselineKey: "activity:stock_baseline",
+		stockKeyTemplate: "stock:activity:%d", table: "seckill_activities", baselineColumn: "total_stock"},
+}
+
+// registerDirtySetGauges 抓取时读取各脏id集合（含在途集合）的长度，反映回写积压
+func registerDirtySetGauges(rdb redis.UniversalClient) {
+	for _, t := range flushTargets {
+		t := t
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   metrics.Namespace,
+			Name:        "reconciler_dirty_set_length",
+			Help:        "Ids waiting to be flushed from Redis to MySQL.",
+			ConstLabels: prometheus.Labels{"table": t.table},
+		}, func() float64 {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			pipe := rdb.Pipeline()
+			dirty := pipe.SCard(ctx, t.dirtySetKey)
+			inflight := pipe.SCard(ctx, t.inflightKey())
+			if _, err := pipe.Exec(ctx); err != nil {
+				return math.NaN()
+			}
+			return float64(dirty.Val() + inflight.Val())
+		})
+	}
+}
+
+func (t flushTarget) stockKey(id int64) string {
+	return fmt.Sprintf(t.stockKeyTemplate, id)
 }
 
 // redis库存高频变化 通过批量UPDATE可以降低MySQL压力
+// 另按 reconcile.audit_interval_seconds 周期全量对账，-audit-once 只执行一轮全量对账（只报告不修复）后退出
+// 可部署多个副本，通过 Redis 租约选出主节点，只有主节点回写与对账，主节点失联后数秒内由其他副本接管
 func main() {
+	auditOnce := flag.Bool("audit-once", false, "执行一轮全量对账并输出偏差报告后退出（只报告不修复）")
+	flag.Parse()
+
 	cfg := app.BootstrapApp()
 
 	// DB
@@ -43,127 +94,305 @@ func main() {
 		logger.Fatal("连接Redis失败", "err", err)
 	}
 
-	logger.Info("Stock Reconciler started")
 	ctx := context.Background()
+	if *auditOnce {
+		// 未参与选举，修复交由主节点执行
+		aud := &auditor{db: db, rdb: rdb, cfg: cfg.Reconcile}
+		if _, err := aud.run(ctx); err != nil {
+			logger.Fatal("库存全量对账失败", "err", err)
+		}
+		logger.Info("偏差报告已写入", "path", cfg.Reconcile.ReportPath)
+		return
+	}
+
+	rt := app.NewRuntime(cfg)
+	// 选举最后停止：回写与对账退出后才释放租约，其他副本随即接管
+	elector := leader.NewElector(rdb, electionName, time.Duration(cfg.Reconcile.LeaderLeaseSeconds)*time.Second)
+	electCtx, stopElect := context.WithCancel(ctx)
+	electDone := make(chan struct{})
+	go func() {
+		defer close(electDone)
+		elector.Run(electCtx, func(ctx context.Context, token int64) error {
+			return onElected(ctx, db, elector, token)
+		})
+	}()
+	rt.OnStop("elector", func(ctx context.Context) error {
+		stopElect()
+		select {
+		case <-electDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	aud := &auditor{db: db, rdb: rdb, cfg: cfg.Reconcile, elector: elector}
+
+	metricsAddr := cfg.Metrics.AddrFor("stock_reconciler")
+	if cfg.Reconcile.MetricsAddr != "" {
+		metricsAddr = cfg.Reconcile.MetricsAddr
+	}
+	rt.ServeMetrics(metricsAddr)
+	registerDirtySetGauges(rdb)
+	if cfg.Reconcile.AuditEnabled {
+		rt.Go("audit", func(stop context.Context) {
+			runAudits(stop, aud, time.Duration(cfg.Reconcile.AuditIntervalSeconds)*time.Second)
+		})
+	}
+
+	guarded := cfg.Reconcile.FlushMode != "trust"
+	logger.Info("Stock Reconciler started", "flush_mode", cfg.Reconcile.FlushMode, "audit", cfg.Reconcile.AuditEnabled,
+		"auto_repair", cfg.Reconcile.AutoRepair, "leader_lease_seconds", cfg.Reconcile.LeaderLeaseSeconds)
+
+	// 定时器驱动；进行中的一轮回写完成后才退出，避免已弹出的id滞留在途集合
+	rt.Go("flush", func(stop context.Context) {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
 
-	// 定时器驱动
-	ticker := time.NewTicker(flushInterval)
+		for {
+			select {
+			case <-stop.Done():
+				return
+			case <-ticker.C:
+			}
+			token, ok := elector.Token()
+			if !ok {
+				continue // 非主节点待命
+			}
+			tm := term{leaderKey: elector.Key(), token: token}
+			for _, t := range flushTargets {
+				flush(ctx, db, rdb, t, guarded, tm)
+			}
+		}
+	})
+	rt.OnClose("redis", func(context.Context) error { return rdb.Close() })
+	rt.OnClose("mysql", func(context.Context) error { return mysql.Close(db) })
+	rt.Wait()
+}
+
+// runAudits 启动后立即执行一轮全量对账，之后按周期执行
+func runAudits(ctx context.Context, aud *auditor, interval time.Duration) {
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	for {
+		// 只有主节点执行，避免多个副本重复修复
+		if _, ok := aud.elector.Token(); ok {
+			if _, err := aud.run(ctx); err != nil {
+				logger.Error("库存全量对账失败", "err", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
 
-	for range ticker.C {
-		// 批量弹出一批商品ID
-		ids, err := popDirty(ctx, rdb, flushBatch)
-		if err != nil {
-			logger.Error("pop dirty failed", "err", err)
-			continue
+// flush 弹出一批脏id，批量读取Redis库存并合并为单条SQL回写MySQL
+// guarded 模式下只无条件应用下调，上调不得超过期间累计的授权额度（归还/补偿/追加分配），
+// 超出部分视为 Redis 数据异常（丢失后从旧快照恢复、错误预热等）拒绝写入并告警
+// 弹出与回写均校验任期：失去主节点身份后弹出被拒绝，进行中的回写在 MySQL 事务内被 fence 拒绝，
+// 未完成回写的id留在在途集合，下次弹出时放回脏集合
+func flush(ctx context.Context, db *gorm.DB, rdb redis.UniversalClient, t flushTarget, guarded bool, tm term) {
+	// 批量弹出一批商品ID
+	ids, err := popDirty(ctx, rdb, t, tm, flushBatch)
+	if err != nil {
+		logger.Error("pop dirty failed", "set", t.dirtySetKey, "err", err)
+		return
+	}
+
+	// 无数据跳过
+	if len(ids) == 0 {
+		return
+	}
+	metrics.ReconcileBatchSize.WithLabelValues(t.table).Observe(float64(len(ids)))
+
+	// Pipeline 批量读取库存并取走授权额度与基线调整（单个脚本内完成，与库存快照对应）
+	// 原理TCP管道 批量命令打包发送
+	cmds := make([]*redis.Cmd, 0, len(ids))
+	_, _ = rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			// 管道内无法按 NOSCRIPT 回退，直接发送脚本内容
+			cmds = append(cmds, takeStockScript.Eval(ctx, pipe, []string{t.stockKey(id), t.creditKey, t.baselineKey}, id))
 		}
+		return nil
+	})
 
-		// 无数据跳过
-		if len(ids) == 0 {
+	pairs := make([]stockPair, 0, len(cmds))
+	done := make([]int64, 0, len(cmds)) // 可移出在途集合的id；读取失败的留在在途集合下次重试
+	for i, cmd := range cmds {
+		vals, err := cmd.Int64Slice()
+		if err != nil {
+			logger.Error("redis get stock failed", "table", t.table, "id", ids[i], "err", err)
 			continue
 		}
+		done = append(done, ids[i])
+		if vals[0] < 0 {
+			continue // 库存键不存在
+		}
+		pairs = append(pairs, stockPair{id: ids[i], stock: vals[0], credit: vals[1], baseline: vals[2]})
+	}
 
-		// Pipeline读取Redis库存
-		type kv struct {
-			id  int64
-			cmd *redis.StringCmd
+	if len(pairs) == 0 {
+		completeDirty(ctx, rdb, t, tm, done)
+		return
+	}
+
+	if guarded {
+		reportRejected(ctx, db, t, pairs)
+	}
+
+	// 构造单条 SQL 批量更新
+	// trust:   UPDATE products SET stock = CASE id WHEN ? THEN ? ... END, updated_at = ? WHERE id IN (...)
+	// guarded: UPDATE products SET stock = LEAST(CASE id WHEN ? THEN <redis> ... END, stock + CASE id WHEN ? THEN <credit> ... END) ...
+	// 上限在同一条语句内按当前 MySQL 库存计算，不受读取与写入之间的其他更新影响
+	// 取走的基线调整在同一语句内计入基线列：..., initial_stock = initial_stock + CASE id WHEN ? THEN <delta> ... END
+	target := "CASE id"
+	args := make([]interface{}, 0, len(pairs)*7+1)
+	for _, p := range pairs {
+		target += " WHEN ? THEN ?"
+		args = append(args, p.id, p.stock)
+	}
+	target += " END"
+	if guarded {
+		limit := "stock + CASE id"
+		for _, p := range pairs {
+			limit += " WHEN ? THEN ?"
+			args = append(args, p.id, p.credit)
 		}
-		// 创建一个kv切片 保存id和对应的查询库存的命令
-		kvcmds := make([]kv, 0, len(ids))
+		limit += " END"
+		target = "LEAST(" + target + ", " + limit + ")"
+	}
+	sql := "UPDATE " + t.table + " SET stock = " + target
+	if hasBaseline(pairs) {
+		sql += ", " + t.baselineColumn + " = " + t.baselineColumn + " + CASE id"
+		for _, p := range pairs {
+			sql += " WHEN ? THEN ?"
+			args = append(args, p.id, p.baseline)
+		}
+		sql += " END"
+	}
+	sql += ", updated_at = ? WHERE id IN ("
+	args = append(args, time.Now())
+	for i, p := range pairs {
+		if i > 0 {
+			sql += ","
+		}
+		sql += "?"
+		args = append(args, p.id)
+	}
+	sql += ")"
 
-		// Pipeline的作用  批量发送len(ids)个GET请求 减少网络传输时间
-		// 原理TCP管道 批量命令打包发送
+	err = fenced(ctx, db, tm.token, func(tx *gorm.DB) error {
+		return tx.Exec(sql, args...).Error
+	})
+	if err != nil {
+		if errors.Is(err, errFenced) {
+			logger.Warn("任期已失效，放弃本批回写", "table", t.table, "token", tm.token, "count", len(pairs))
+		} else {
+			logger.Error("mysql batch update stock failed", "err", err)
+		}
+		// 在途id下次弹出时放回脏集合；归还取走的授权额度与基线调整
 		_, _ = rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
-			for _, id := range ids {
-				// 创建获取库存的redis命令 批量加入kvcmds
-				cmd := pipe.Get(ctx, stockKey(id))
-				kvcmds = append(kvcmds, kv{id: id, cmd: cmd})
+			for _, p := range pairs {
+				if p.credit > 0 {
+					pipe.HIncrBy(ctx, t.creditKey, strconv.FormatInt(p.id, 10), p.credit)
+				}
+				if p.baseline != 0 {
+					pipe.HIncrBy(ctx, t.baselineKey, strconv.FormatInt(p.id, 10), p.baseline)
+				}
 			}
 			return nil
 		})
+		return
+	}
+	completeDirty(ctx, rdb, t, tm, done)
+	logger.Debug("batch stock reconciled", "table", t.table, "count", len(pairs), "guarded", guarded)
+}
 
-		// 组装批量更新 创建一个pairs结构体切片 保存id和查询命令执行后得到的stock
-		pairs := make([]struct {
-			id    int64
-			stock int
-		}, 0, len(kvcmds))
-		for _, kv := range kvcmds {
-			// 执行结果的redis命令后的结果->val
-			val, err := kv.cmd.Result()
-			if err != nil {
-				if errors.Is(err, redis.Nil) {
-					continue
-				}
-				logger.Error("redis get stock failed", "product_id", kv.id, "err", err)
-				continue
-			}
-			st, err := strconv.Atoi(val)
-			if err != nil {
-				logger.Error("invalid stock value", "product_id", kv.id, "val", val)
-				continue
-			}
-			pairs = append(pairs, struct {
-				id    int64
-				stock int
-			}{id: kv.id, stock: st})
+// completeDirty 将已处理的id移出在途集合
+func completeDirty(ctx context.Context, rdb redis.UniversalClient, t flushTarget, tm term, ids []int64) {
+	if len(ids) == 0 {
+		return
+	}
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, tm.token)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	if err := completeScript.Run(ctx, rdb, []string{t.inflightKey(), tm.leaderKey}, args...).Err(); err != nil {
+		// 留在在途集合，下次弹出时重新回写（回写幂等）
+		logger.Warn("移出在途集合失败", "set", t.inflightKey(), "err", err)
+	}
+}
+
+// stockPair 一个待回写的库存：Redis 库存与取走的授权上调额度、基线调整
+type stockPair struct {
+	id       int64
+	stock    int64
+	credit   int64
+	baseline int64
+}
+
+func hasBaseline(pairs []stockPair) bool {
+	for _, p := range pairs {
+		if p.baseline != 0 {
+			return true
 		}
+	}
+	return false
+}
 
-		if len(pairs) == 0 {
+// takeStockScript 读取库存并取走授权上调额度与基线调整
+// KEYS[1]=库存键 KEYS[2]=授权上调额度hash KEYS[3]=基线调整hash ARGV[1]=库存桶ID
+// 库存键不存在时返回 {-1, 0, 0} 且不取走额度与基线调整
+var takeStockScript = redis.NewScript(`
+    local stock = redis.call('get', KEYS[1])
+    if not stock then
+        return {-1, 0, 0}
+    end
+    local credit = tonumber(redis.call('hget', KEYS[2], ARGV[1]) or '0')
+    local baseline = tonumber(redis.call('hget', KEYS[3], ARGV[1]) or '0')
+    redis.call('hdel', KEYS[2], ARGV[1])
+    redis.call('hdel', KEYS[3], ARGV[1])
+    return {tonumber(stock), credit, baseline}
+`)
+
+// reportRejected 读取当前 MySQL 库存，报告超出授权额度而被拒绝的上调
+func reportRejected(ctx context.Context, db *gorm.DB, t flushTarget, pairs []stockPair) {
+	ids := make([]int64, len(pairs))
+	for i, p := range pairs {
+		ids[i] = p.id
+	}
+	var rows []struct {
+		ID    int64
+		Stock int64
+	}
+	if err := db.WithContext(ctx).Table(t.table).Select("id, stock").Where("id IN ?", ids).Scan(&rows).Error; err != nil {
+		logger.Warn("读取MySQL库存失败，跳过上调检查报告", "table", t.table, "err", err)
+		return
+	}
+	current := make(map[int64]int64, len(rows))
+	for _, r := range rows {
+		current[r.ID] = r.Stock
+	}
+	for _, p := range pairs {
+		mysqlStock, ok := current[p.id]
+		if !ok {
 			continue
 		}
-
-		// 安全保障策略：仅当 Redis库存 < MySQL库存 时才更新
-		// 防止 Redis 数据丢失（变大）导致错误覆盖 MySQL
-		// 注意：这里为了性能，我们假设大部分情况下 Redis 是准的。
-		// 真正的安全做法是：UPDATE products SET stock = ? WHERE id = ? AND stock > ?
-		// 但为了批量更新的性能，我们这里采用 CASE WHEN 语法，并在 SQL 里加上条件判断比较困难
-		// 所以我们在激进派模式下，选择相信 Redis，但加上一个简单的兜底：
-		// 如果 Redis 库存突然变大（比如重启），Reconciler 可能会把 MySQL 改错。
-		// 改进方案：在 SQL 中加入 LEAST() 函数或者 WHERE stock > new_stock (复杂SQL)
-		// 这里演示最直接的同步逻辑，但在生产环境建议加上 "stock > ?" 的判断
-
-		// 构造单条 SQL 批量更新
-		// UPDATE products SET stock = CASE id WHEN ? THEN ? ... END, updated_at = ? WHERE id IN (...)
-		sql := "UPDATE products SET stock = CASE id"
-		args := make([]interface{}, 0, len(pairs)*2+len(pairs)+1)
-		idsWhere := make([]interface{}, 0, len(pairs))
-		now := time.Now()
-
-		// 一系列的when then语句  批量更新数据库表  当id为p.id的时候 更新p.stock等于多少
-		for _, p := range pairs {
-			sql += " WHEN ? THEN ?"
-			args = append(args, p.id, p.stock)
-			idsWhere = append(idsWhere, p.id)
-		}
-		sql += " END, updated_at = ? WHERE id IN ("
-		args = append(args, now)
-		// id的范围加入where条件
-		for i := range idsWhere {
-			if i > 0 {
-				sql += ","
-			}
-			sql += "?"
-			args = append(args, idsWhere[i])
-		}
-		// 关键修改：增加 AND stock > CASE id ... END 条件，防止 Redis 库存比 MySQL 还大（数据回滚风险）
-		// 但 MySQL 语法不支持在 WHERE 子句中直接引用 CASE 的结果进行比较（比较复杂）
-		// 所以在激进派模式下，我们通常假定 Redis 是权威源。
-		// 如果要绝对安全，应该先查 MySQL 再对比，但这会失去性能优势。
-		// 妥协方案：直接更新。
-		sql += ")"
-
-		if res := db.Exec(sql, args...); res.Error != nil {
-			logger.Error("mysql batch update stock failed", "err", res.Error)
-			rdb.SAdd(ctx, dirtySetKey, ids) // 回滚待对账集合
-		} else {
-			logger.Debug("batch stock reconciled", "count", len(pairs))
+		if rejected := p.stock - (mysqlStock + p.credit); rejected > 0 {
+			metrics.ReconcileFlushRejected.WithLabelValues(t.table).Inc()
+			metrics.ReconcileFlushRejectedQuantity.WithLabelValues(t.table).Add(float64(rejected))
+			logger.Error("ALARM: 拒绝未授权的库存上调", "table", t.table, "id", p.id,
+				"mysql", mysqlStock, "redis", p.stock, "credit", p.credit, "rejected", rejected)
 		}
 	}
 }
 
-func popDirty(ctx context.Context, rdb redis.UniversalClient, n int) ([]int64, error) {
-	// 使用 SPOP 批量弹出一批待对账商品ID，避免重复处理
-	members, err := rdb.SPopN(ctx, dirtySetKey, int64(n)).Result()
+func popDirty(ctx context.Context, rdb redis.UniversalClient, t flushTarget, tm term, n int) ([]int64, error) {
+	// 使用 SPOP 批量弹出一批待对账商品ID，避免重复处理；同时记入在途集合，回写完成前不会丢失
+	members, err := popDirtyScript.Run(ctx, rdb, []string{t.dirtySetKey, t.inflightKey(), tm.leaderKey}, tm.token, n).StringSlice()
 	if err != nil {
 		return nil, err
 	}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/CCDD2022/seckill-system/pkg/tracing"
 
 	"net"
 
@@ -19,6 +22,9 @@ import (
 
 func main() {
 	cfg := app.BootstrapApp()
+	rt := app.NewRuntime(cfg)
+	rt.ServeMetrics(cfg.Metrics.AddrFor("user_service"))
+	rt.InitTracing(cfg.Tracing, "user_service")
 
 	// 连接数据库
 	db, err := mysql.InitDB(&cfg.Database.Mysql)
@@ -32,12 +38,16 @@ func main() {
 	userService := service.NewUserService(userDao)
 
 	// 创建 gRPC 服务器
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(metrics.UnaryServerInterceptor()), tracing.ServerOption())
 	// 测试的时候会依赖反射调用  生产环境要去掉
 	reflection.Register(grpcServer)
 	// 当收到user.UserService/Register的时候  调用userService.Register方法
 	user.RegisterUserServiceServer(grpcServer, userService)
 
+	// 健康检查：依赖不可用时为 NOT_SERVING
+	hc := app.NewHealth(grpcServer, "user")
+	hc.AddCheck("mysql", func(ctx context.Context) error { return mysql.Ping(ctx, db) })
+
 	// 启动 gRPC 服务器
 	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Services.UserService.Host, cfg.Services.UserService.Port))
 	if err != nil {
@@ -45,7 +55,8 @@ func main() {
 	}
 
 	logger.Info("User gRPC service started on :", "port", cfg.Services.UserService.Port)
-	if err := grpcServer.Serve(lis); err != nil {
-		logger.Error("Failed to serve: ", "err", err)
-	}
+	rt.ServeGRPC("grpc", grpcServer, lis)
+	rt.Go("health", hc.Run)
+	rt.OnClose("mysql", func(context.Context) error { return mysql.Close(db) })
+	rt.Wait()
 }
@@ -14,6 +14,7 @@ type ServicesConfig struct {
 	SeckillService Service `yaml:"seckill_service" mapstructure:"seckill_service"`
 	OrderService   Service `yaml:"order_service" mapstructure:"order_service"`
 	AuthService    Service `yaml:"auth_service" mapstructure:"auth_service"`
+	DLQService     Service `yaml:"dlq_service" mapstructure:"dlq_service"` // 死信管理（运维内部接口）
 }
 
 type Service struct {
@@ -36,6 +37,8 @@ type ServerConfig struct {
 	Mode         string `yaml:"mode"`
 	ReadTimeout  int    `yaml:"read_timeout" mapstructure:"read_timeout"` // ✅ 改为大写
 	WriteTimeout int    `yaml:"write_timeout" mapstructure:"write_timeout"`
+	// 收到 SIGINT/SIGTERM 后等待处理中的请求与消息完成的最长时间，超时后强制关闭
+	ShutdownTimeoutSeconds int `yaml:"shutdown_timeout_seconds" mapstructure:"shutdown_timeout_seconds"`
 }
 
 // MySQLConfig 数据库配置
@@ -76,6 +79,15 @@ type MQConfig struct {
 	Password         string `yaml:"password"`
 	ChannelPoolSize  int    `yaml:"channel_pool_size" mapstructure:"channel_pool_size"`
 	ConsumerPrefetch int    `yaml:"consumer_prefetch" mapstructure:"consumer_prefetch"`
+	ConfirmMode      string `yaml:"confirm_mode" mapstructure:"confirm_mode"`             // 发布确认模式：async（后台回调）/ sync（等待确认）
+	ConfirmTimeoutMs int    `yaml:"confirm_timeout_ms" mapstructure:"confirm_timeout_ms"` // 同步确认最长等待时间
+	AcquireTimeoutMs int    `yaml:"acquire_timeout_ms" mapstructure:"acquire_timeout_ms"` // 断线重连期间发布方等待可用通道的最长时间，超时快速失败
+	// 下单消费者批量落库：攒够批大小或超过时间窗口即写入
+	OrderBatchSize       int `yaml:"order_batch_size" mapstructure:"order_batch_size"`
+	OrderBatchIntervalMs int `yaml:"order_batch_interval_ms" mapstructure:"order_batch_interval_ms"`
+	// 消费失败重试：最多投递次数（含首次），第n次重试延迟 retry_base_delay_ms*2^(n-1)
+	RetryMaxAttempts int `yaml:"retry_max_attempts" mapstructure:"retry_max_attempts"`
+	RetryBaseDelayMs int `yaml:"retry_base_delay_ms" mapstructure:"retry_base_delay_ms"`
 }
 
 // Config 总配置结构体，嵌套所有子配置
@@ -87,6 +99,81 @@ type Config struct {
 	Logger     Logger           `yaml:"log" mapstructure:"log"`
 	MQ         MQConfig         `yaml:"mq"`
 	RateLimits RateLimitsConfig `yaml:"rate_limits" mapstructure:"rate_limits"`
+	Seckill    SeckillConfig    `yaml:"seckill"`
+	Order      OrderConfig      `yaml:"order"`
+	IDGen      IDGenConfig      `yaml:"idgen" mapstructure:"idgen"`
+	Reconcile  ReconcileConfig  `yaml:"reconcile" mapstructure:"reconcile"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+}
+
+// ReconcileConfig 库存全量对账：逐个商品/活动比对 Redis 库存、MySQL 库存与 基线-已售-预占中 推算的应有库存
+type ReconcileConfig struct {
+	FlushMode            string `yaml:"flush_mode" mapstructure:"flush_mode"` // guarded：回写MySQL时上调不得超过授权额度（默认）；trust：完全信任Redis
+	AuditEnabled         bool   `yaml:"audit_enabled" mapstructure:"audit_enabled"`
+	AuditIntervalSeconds int    `yaml:"audit_interval_seconds" mapstructure:"audit_interval_seconds"`
+	ReportPath           string `yaml:"report_path" mapstructure:"report_path"`   // 偏差报告（JSON），每轮覆盖写入
+	Tolerance            int32  `yaml:"tolerance" mapstructure:"tolerance"`       // 偏差绝对值不超过该值时允许自动修复，超过则告警升级、不自动修复
+	AutoRepair           bool   `yaml:"auto_repair" mapstructure:"auto_repair"`   // 关闭时只报告不修复
+	MetricsAddr          string `yaml:"metrics_addr" mapstructure:"metrics_addr"` // 兼容旧配置：非空时覆盖 metrics 中本进程的监听地址
+	// 多副本主节点租约有效期，主节点失联后约 1.3 倍该时长内完成切换
+	LeaderLeaseSeconds int `yaml:"leader_lease_seconds" mapstructure:"leader_lease_seconds"`
+}
+
+// MetricsConfig Prometheus 指标：网关在服务端口暴露 /metrics，其余进程单独监听 /metrics
+type MetricsConfig struct {
+	Addr  string            `yaml:"addr"`  // 默认监听地址，为空不监听；容器内各进程独立，可共用同一端口
+	Addrs map[string]string `yaml:"addrs"` // 按进程名（cmd 目录名）覆盖，本机同时运行多个进程时避免端口冲突
+}
+
+// AddrFor 进程的指标监听地址
+func (m MetricsConfig) AddrFor(name string) string {
+	if addr, ok := m.Addrs[name]; ok {
+		return addr
+	}
+	return m.Addr
+}
+
+// TracingConfig OpenTelemetry 链路追踪：网关、gRPC 服务与 MQ 消费者共用，服务名取进程名
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter"`                                   // none（默认，不采集）/ stdout / file / otlp
+	FilePath     string  `yaml:"file_path" mapstructure:"file_path"`         // file 导出器的输出文件（每行一个 span 的 JSON）
+	OTLPEndpoint string  `yaml:"otlp_endpoint" mapstructure:"otlp_endpoint"` // OTLP/gRPC 采集端地址，为空时使用 OTEL_EXPORTER_OTLP_ENDPOINT 环境变量或 localhost:4317
+	OTLPInsecure bool    `yaml:"otlp_insecure" mapstructure:"otlp_insecure"` // 不使用 TLS 连接采集端
+	SampleRatio  float64 `yaml:"sample_ratio" mapstructure:"sample_ratio"`   // 根 span 采样比例（0~1]，下游跟随上游的采样决定
+}
+
+// IDGenConfig 订单ID生成（Snowflake）：各实例的 workerID 必须唯一
+type IDGenConfig struct {
+	Mode            string `yaml:"mode" mapstructure:"mode"`                           // lease：通过 Redis 租用 workerID（默认）；static：使用 worker_id
+	WorkerID        int    `yaml:"worker_id" mapstructure:"worker_id"`                 // static 模式的 workerID，0~1023
+	LeaseTTLSeconds int    `yaml:"lease_ttl_seconds" mapstructure:"lease_ttl_seconds"` // 租约有效期，实例退出后 workerID 至少间隔该时长才会被复用
+}
+
+// OrderConfig 订单业务参数
+type OrderConfig struct {
+	PaymentTimeoutSeconds int `yaml:"payment_timeout_seconds" mapstructure:"payment_timeout_seconds"` // 待支付订单超时自动取消
+	// 秒杀订单每人每活动（或商品）只允许一单，由数据库唯一索引兜底；仅在限购为1时开启
+	UniqueSeckillOrder bool `yaml:"unique_seckill_order" mapstructure:"unique_seckill_order"`
+}
+
+// SeckillConfig 秒杀业务参数
+type SeckillConfig struct {
+	MaxQuantityPerRequest int32       `yaml:"max_quantity_per_request" mapstructure:"max_quantity_per_request"` // 单次请求最多购买数量
+	DefaultPerUserLimit   int32       `yaml:"default_per_user_limit" mapstructure:"default_per_user_limit"`     // 每人对同一商品/活动的默认限购数量，活动可单独配置覆盖
+	ReservationTTLSeconds int         `yaml:"reservation_ttl_seconds" mapstructure:"reservation_ttl_seconds"`   // 库存预占有效期，超时未生成订单则释放
+	SweepIntervalSeconds  int         `yaml:"sweep_interval_seconds" mapstructure:"sweep_interval_seconds"`     // 预占清理进程扫描间隔
+	Spill                 SpillConfig `yaml:"spill" mapstructure:"spill"`
+}
+
+// SpillConfig 本地溢写日志：MQ不可用时订单消息追加写入本地文件，恢复后按原 MessageId 重放
+type SpillConfig struct {
+	Enabled          bool   `yaml:"enabled" mapstructure:"enabled"`
+	Path             string `yaml:"path" mapstructure:"path"`
+	MaxBytes         int64  `yaml:"max_bytes" mapstructure:"max_bytes"`                   // 文件大小上限，写满后不再溢写（请求按失败处理）
+	ReplayIntervalMs int    `yaml:"replay_interval_ms" mapstructure:"replay_interval_ms"` // 重放检查间隔
+	// 同一条消息被 Broker 拒绝（Nack/不可路由退回）的重放次数上限，达到后移入 <path>.dead
+	MaxReplayAttempts int `yaml:"max_replay_attempts" mapstructure:"max_replay_attempts"`
 }
 
 // RateLimitRule 单个限流规则
@@ -162,4 +249,86 @@ func applyRateLimitDefaults(cfg *Config) {
 	if cfg.MQ.ConsumerPrefetch <= 0 {
 		cfg.MQ.ConsumerPrefetch = 1
 	}
+	if cfg.MQ.ConfirmMode == "" {
+		cfg.MQ.ConfirmMode = "async"
+	}
+	if cfg.MQ.ConfirmTimeoutMs <= 0 {
+		cfg.MQ.ConfirmTimeoutMs = 2000
+	}
+	if cfg.MQ.AcquireTimeoutMs <= 0 {
+		cfg.MQ.AcquireTimeoutMs = 200
+	}
+	if cfg.MQ.OrderBatchSize <= 0 {
+		cfg.MQ.OrderBatchSize = 100
+	}
+	if cfg.MQ.OrderBatchIntervalMs <= 0 {
+		cfg.MQ.OrderBatchIntervalMs = 50
+	}
+	if cfg.MQ.RetryMaxAttempts <= 0 {
+		cfg.MQ.RetryMaxAttempts = 5
+	}
+	if cfg.MQ.RetryBaseDelayMs <= 0 {
+		cfg.MQ.RetryBaseDelayMs = 1000
+	}
+	if cfg.Seckill.MaxQuantityPerRequest <= 0 {
+		cfg.Seckill.MaxQuantityPerRequest = 5
+	}
+	if cfg.Seckill.Spill.Path == "" {
+		cfg.Seckill.Spill.Path = "data/seckill_spill.log"
+	}
+	if cfg.Seckill.Spill.MaxBytes <= 0 {
+		cfg.Seckill.Spill.MaxBytes = 256 << 20
+	}
+	if cfg.Seckill.Spill.ReplayIntervalMs <= 0 {
+		cfg.Seckill.Spill.ReplayIntervalMs = 1000
+	}
+	if cfg.Seckill.Spill.MaxReplayAttempts <= 0 {
+		cfg.Seckill.Spill.MaxReplayAttempts = 5
+	}
+	if cfg.Seckill.DefaultPerUserLimit <= 0 {
+		cfg.Seckill.DefaultPerUserLimit = 1
+	}
+	if cfg.Seckill.ReservationTTLSeconds <= 0 {
+		cfg.Seckill.ReservationTTLSeconds = 600
+	}
+	if cfg.Seckill.SweepIntervalSeconds <= 0 {
+		cfg.Seckill.SweepIntervalSeconds = 5
+	}
+	if cfg.IDGen.Mode == "" {
+		cfg.IDGen.Mode = "lease"
+	}
+	if cfg.IDGen.LeaseTTLSeconds <= 0 {
+		cfg.IDGen.LeaseTTLSeconds = 30
+	}
+	if cfg.Reconcile.FlushMode == "" {
+		cfg.Reconcile.FlushMode = "guarded"
+	}
+	if cfg.Reconcile.AuditIntervalSeconds <= 0 {
+		cfg.Reconcile.AuditIntervalSeconds = 300
+	}
+	if cfg.Reconcile.ReportPath == "" {
+		cfg.Reconcile.ReportPath = "data/stock_drift.json"
+	}
+	// 仅在未配置时取默认值：显式配置为 0 表示严格模式，任何偏差都告警升级、不自动修复
+	if !viper.IsSet("reconcile.tolerance") {
+		cfg.Reconcile.Tolerance = 10
+	}
+	if cfg.Reconcile.LeaderLeaseSeconds <= 0 {
+		cfg.Reconcile.LeaderLeaseSeconds = 3
+	}
+	if cfg.Server.ShutdownTimeoutSeconds <= 0 {
+		cfg.Server.ShutdownTimeoutSeconds = 8
+	}
+	if cfg.Order.PaymentTimeoutSeconds <= 0 {
+		cfg.Order.PaymentTimeoutSeconds = 900
+	}
+	if cfg.Tracing.Exporter == "" {
+		cfg.Tracing.Exporter = "none"
+	}
+	if cfg.Tracing.FilePath == "" {
+		cfg.Tracing.FilePath = "logs/traces.jsonl"
+	}
+	if cfg.Tracing.SampleRatio <= 0 || cfg.Tracing.SampleRatio > 1 {
+		cfg.Tracing.SampleRatio = 1
+	}
 }
@@ -8,6 +8,7 @@ import (
 
 	"github.com/CCDD2022/seckill-system/config"
 	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/tracing"
 	"github.com/CCDD2022/seckill-system/proto_output/auth"
 	"github.com/CCDD2022/seckill-system/proto_output/order"
 	"github.com/CCDD2022/seckill-system/proto_output/product"
@@ -133,6 +134,8 @@ func createConnection(serviceName string, host string, port int) (*grpc.ClientCo
 				MaxDelay:   2 * time.Second,
 			},
 		}),
+		// 链路追踪：把网关请求的链路注入 metadata 传给下游服务
+		tracing.DialOption(),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect %s at %s: %w", serviceName, addr, err)
@@ -0,0 +1,89 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// dependencyNames 下游服务以依赖名注册的健康状态，整体不可用时逐个查询以给出原因
+var dependencyNames = []string{"mysql", "redis", "mq"}
+
+// ServiceHealth 单个下游服务的健康状态
+type ServiceHealth struct {
+	Service string   `json:"service"`
+	Ready   bool     `json:"ready"`
+	State   string   `json:"state"`             // 连接状态
+	Status  string   `json:"status"`            // 健康检查结果
+	Reasons []string `json:"reasons,omitempty"` // 不可用原因
+}
+
+// CheckHealth 并发查询所有下游服务的健康状态（grpc.health.v1），ctx 控制整体超时
+func (c *Clients) CheckHealth(ctx context.Context) []ServiceHealth {
+	conns := []struct {
+		name string
+		conn *grpc.ClientConn
+	}{
+		{"auth", c.authConn},
+		{"user", c.userConn},
+		{"product", c.productConn},
+		{"seckill", c.seckillConn},
+		{"order", c.orderConn},
+	}
+
+	results := make([]ServiceHealth, len(conns))
+	var wg sync.WaitGroup
+	for i, sc := range conns {
+		wg.Add(1)
+		go func(i int, name string, conn *grpc.ClientConn) {
+			defer wg.Done()
+			results[i] = checkService(ctx, name, conn)
+		}(i, sc.name, sc.conn)
+	}
+	wg.Wait()
+	return results
+}
+
+// checkService 查询服务整体状态；不可用时补充连接状态与失败的依赖
+func checkService(ctx context.Context, name string, conn *grpc.ClientConn) ServiceHealth {
+	h := ServiceHealth{Service: name}
+	if conn == nil {
+		h.State = connectivity.Shutdown.String()
+		h.Reasons = append(h.Reasons, "client not initialized")
+		return h
+	}
+	h.State = conn.GetState().String()
+
+	client := grpc_health_v1.NewHealthClient(conn)
+	resp, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: name})
+	if err != nil {
+		h.Status = status.Code(err).String()
+		h.Reasons = append(h.Reasons, fmt.Sprintf("health check failed: %s (connection %s)", status.Convert(err).Message(), h.State))
+		return h
+	}
+	h.Status = resp.GetStatus().String()
+	if resp.GetStatus() == grpc_health_v1.HealthCheckResponse_SERVING {
+		h.Ready = true
+		return h
+	}
+
+	for _, dep := range dependencyNames {
+		dresp, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: dep})
+		if err != nil {
+			continue // NOT_FOUND：服务未使用该依赖
+		}
+		if dresp.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
+			h.Reasons = append(h.Reasons, fmt.Sprintf("%s %s", dep, dresp.GetStatus()))
+		}
+	}
+	if len(h.Reasons) == 0 {
+		// 依赖均正常：服务正在退出或首轮检查尚未完成
+		h.Reasons = append(h.Reasons, "service "+h.Status)
+	}
+	return h
+}
@@ -0,0 +1,138 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeadLetterDao 死信持久化与处理状态维护
+type DeadLetterDao struct {
+	db *gorm.DB
+}
+
+func NewDeadLetterDao(db *gorm.DB) *DeadLetterDao {
+	return &DeadLetterDao{db: db}
+}
+
+// DeadLetterFilter 死信查询条件，零值字段不参与过滤（Status 为负数表示全部状态）
+type DeadLetterFilter struct {
+	Status     int32
+	RoutingKey string
+	Queue      string
+	Reason     string
+	MessageID  string
+}
+
+func (f DeadLetterFilter) apply(q *gorm.DB) *gorm.DB {
+	if f.Status >= 0 {
+		q = q.Where("status = ?", f.Status)
+	}
+	if f.RoutingKey != "" {
+		q = q.Where("routing_key = ?", f.RoutingKey)
+	}
+	if f.Queue != "" {
+		q = q.Where("queue = ?", f.Queue)
+	}
+	if f.Reason != "" {
+		q = q.Where("reason = ?", f.Reason)
+	}
+	if f.MessageID != "" {
+		q = q.Where("message_id = ?", f.MessageID)
+	}
+	return q
+}
+
+// CreateDeadLetter 保存一条死信，返回是否新建
+// 同一来源队列的同一消息已有待处理记录时（确认失败后重新投递）不再重复保存，dl.ID 置为已有记录的ID；
+// 已重放或已丢弃的记录不参与去重，重放后再次进入死信会新建记录。没有 MessageId 的消息无法识别，总是新建
+func (d *DeadLetterDao) CreateDeadLetter(ctx context.Context, dl *model.DeadLetter) (bool, error) {
+	if dl.MessageID == "" {
+		return true, d.db.WithContext(ctx).Create(dl).Error
+	}
+	created := false
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing model.DeadLetter
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("message_id = ? AND queue = ? AND status = ?", dl.MessageID, dl.Queue, model.DeadLetterStatusPending).
+			Take(&existing).Error
+		if err == nil {
+			dl.ID = existing.ID
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		created = true
+		return tx.Create(dl).Error
+	})
+	return created && err == nil, err
+}
+
+// ListDeadLetters 分页查询死信（按入库时间倒序，不加载消息头与消息体）
+func (d *DeadLetterDao) ListDeadLetters(ctx context.Context, f DeadLetterFilter, page, pageSize int32) ([]*model.DeadLetter, int64, error) {
+	var list []*model.DeadLetter
+	var total int64
+	offset := (page - 1) * pageSize
+
+	if err := f.apply(d.db.WithContext(ctx).Model(&model.DeadLetter{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := f.apply(d.db.WithContext(ctx)).
+		Omit("headers", "body").
+		Order("id DESC").
+		Limit(int(pageSize)).
+		Offset(int(offset)).
+		Find(&list).Error
+	return list, total, err
+}
+
+// FindDeadLetters 按条件查询待批量处理的死信（按入库顺序，最多 limit 条）
+func (d *DeadLetterDao) FindDeadLetters(ctx context.Context, f DeadLetterFilter, limit int) ([]*model.DeadLetter, error) {
+	var list []*model.DeadLetter
+	err := f.apply(d.db.WithContext(ctx)).
+		Order("id ASC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+// GetDeadLettersByIDs 按ID批量查询
+func (d *DeadLetterDao) GetDeadLettersByIDs(ctx context.Context, ids []int64) ([]*model.DeadLetter, error) {
+	var list []*model.DeadLetter
+	err := d.db.WithContext(ctx).Where("id IN ?", ids).Order("id ASC").Find(&list).Error
+	return list, err
+}
+
+// GetDeadLetterByID 查询单条死信
+func (d *DeadLetterDao) GetDeadLetterByID(ctx context.Context, id int64) (*model.DeadLetter, error) {
+	var dl model.DeadLetter
+	if err := d.db.WithContext(ctx).Where("id = ?", id).First(&dl).Error; err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+// MarkReplayed 标记已重放（已丢弃的不会被改回）
+func (d *DeadLetterDao) MarkReplayed(ctx context.Context, id int64) error {
+	now := time.Now()
+	return d.db.WithContext(ctx).Model(&model.DeadLetter{}).
+		Where("id = ? AND status <> ?", id, model.DeadLetterStatusDiscarded).
+		Updates(map[string]interface{}{
+			"status":       model.DeadLetterStatusReplayed,
+			"replay_count": gorm.Expr("replay_count + 1"),
+			"replayed_at":  &now,
+		}).Error
+}
+
+// DiscardDeadLetters 将待处理的死信标记为已丢弃，返回实际丢弃条数
+func (d *DeadLetterDao) DiscardDeadLetters(ctx context.Context, ids []int64) (int64, error) {
+	res := d.db.WithContext(ctx).Model(&model.DeadLetter{}).
+		Where("id IN ? AND status = ?", ids, model.DeadLetterStatusPending).
+		Update("status", model.DeadLetterStatusDiscarded)
+	return res.RowsAffected, res.Error
+}
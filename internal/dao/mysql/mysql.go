@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -46,6 +47,11 @@ func InitDB(cfg *config.MySQLConfig) (*gorm.DB, error) {
 		&model.User{},
 		&model.Product{},
 		&model.Order{},
+		&model.SeckillActivity{},
+		&model.OutboxEvent{},
+		&model.DeadLetter{},
+		&model.LeaderFence{},
+		&model.StockLog{},
 	)
 	return db, nil
 }
@@ -53,3 +59,21 @@ func InitDB(cfg *config.MySQLConfig) (*gorm.DB, error) {
 func GetDB() *gorm.DB {
 	return db
 }
+
+// Ping 检查数据库连通性，供健康检查使用
+func Ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Close 关闭底层连接池
+func Close(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -3,8 +3,10 @@ package dao
 import (
 	"context"
 	"errors"
+	"strings"
 
 	"github.com/CCDD2022/seckill-system/internal/model"
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"gorm.io/gorm"
 )
 
@@ -18,12 +20,37 @@ func NewOrderDao(db *gorm.DB) *OrderDao {
 	}
 }
 
-var ErrOrderStatusChanged = errors.New("订单状态已变更")
+var (
+	ErrOrderStatusChanged = errors.New("订单状态已变更")
+	// ErrDuplicateOrderMessage 同一消息已生成过订单（message_id 唯一索引或预分配主键冲突）
+	ErrDuplicateOrderMessage = errors.New("该消息已生成订单")
+	// ErrDuplicateSeckillOrder 用户已有该活动/商品的秒杀订单（seckill_key 唯一索引冲突）
+	ErrDuplicateSeckillOrder = errors.New("已存在该活动的秒杀订单")
+)
+
+// MySQL 唯一键冲突错误码
+const mysqlErrDuplicateEntry = 1062
+
+// translateDuplicate 将订单表唯一索引冲突转换为对应的哨兵错误，其他错误原样返回
+func translateDuplicate(err error) error {
+	var me *mysqldriver.MySQLError
+	if !errors.As(err, &me) || me.Number != mysqlErrDuplicateEntry {
+		return err
+	}
+	switch {
+	// 订单ID由消息预分配，主键冲突同样意味着该消息已落库
+	case strings.Contains(me.Message, "uk_orders_message_id"), strings.Contains(me.Message, "PRIMARY"):
+		return ErrDuplicateOrderMessage
+	case strings.Contains(me.Message, "uk_orders_seckill_key"):
+		return ErrDuplicateSeckillOrder
+	}
+	return err
+}
 
-// CreateOrder 创建订单
+// CreateOrder 创建订单，唯一索引冲突时返回 ErrDuplicateOrderMessage / ErrDuplicateSeckillOrder
 func (d *OrderDao) CreateOrder(ctx context.Context, order *model.Order) error {
 
-	return d.db.WithContext(ctx).Create(order).Error
+	return translateDuplicate(d.db.WithContext(ctx).Create(order).Error)
 }
 
 // CreateOrdersBatch 批量创建订单（单事务）
@@ -33,12 +60,22 @@ func (d *OrderDao) CreateOrdersBatch(ctx context.Context, orders []*model.Order)
 	}
 	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		if err := tx.WithContext(ctx).CreateInBatches(orders, len(orders)).Error; err != nil {
-			return err
+			return translateDuplicate(err)
 		}
 		return nil
 	})
 }
 
+// GetOrderByMessageID 根据来源消息ID获取订单
+func (d *OrderDao) GetOrderByMessageID(ctx context.Context, messageID string) (*model.Order, error) {
+	var order model.Order
+	err := d.db.WithContext(ctx).Where("message_id = ?", messageID).First(&order).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
 // GetOrderByID 根据ID获取订单
 func (d *OrderDao) GetOrderByID(ctx context.Context, orderID int64) (*model.Order, error) {
 	var order model.Order
@@ -86,9 +123,26 @@ func (d *OrderDao) UpdateOrderStatus(ctx context.Context, orderID int64, fromSta
 	return nil
 }
 
-// CancelOrder 取消订单
-func (d *OrderDao) CancelOrder(ctx context.Context, orderID int64) error {
-	return d.UpdateOrderStatus(ctx, orderID, model.OrderStatusPending, model.OrderStatusCancelled)
+// UpdateOrderStatusWithEvent 条件更新订单状态，并在同一事务内写入发件箱事件
+// 状态未变更（已被其他请求处理）时不写事件，返回 ErrOrderStatusChanged
+func (d *OrderDao) UpdateOrderStatusWithEvent(ctx context.Context, orderID int64, fromStatus, toStatus int32, evt *model.OutboxEvent) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Order{}).
+			Where("id = ? AND status = ?", orderID, fromStatus).
+			Update("status", toStatus)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrderStatusChanged
+		}
+		return tx.Create(evt).Error
+	})
+}
+
+// CancelOrder 取消订单，取消事件随状态变更写入发件箱
+func (d *OrderDao) CancelOrder(ctx context.Context, orderID int64, evt *model.OutboxEvent) error {
+	return d.UpdateOrderStatusWithEvent(ctx, orderID, model.OrderStatusPending, model.OrderStatusCancelled, evt)
 }
 
 // PayOrder 支付订单（仅允许待支付 -> 已支付）
@@ -0,0 +1,54 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"gorm.io/gorm"
+)
+
+// OutboxDao 事务发件箱的读取与投递状态维护（写入由业务DAO在各自事务内完成）
+type OutboxDao struct {
+	db *gorm.DB
+}
+
+func NewOutboxDao(db *gorm.DB) *OutboxDao {
+	return &OutboxDao{db: db}
+}
+
+// FetchPending 按写入顺序获取待投递事件
+func (d *OutboxDao) FetchPending(ctx context.Context, limit int) ([]*model.OutboxEvent, error) {
+	var events []*model.OutboxEvent
+	err := d.db.WithContext(ctx).
+		Where("status = ?", model.OutboxStatusPending).
+		Order("id ASC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// MarkSent 标记事件已投递
+func (d *OutboxDao) MarkSent(ctx context.Context, id int64) error {
+	now := time.Now()
+	return d.db.WithContext(ctx).Model(&model.OutboxEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":   model.OutboxStatusSent,
+			"sent_at":  &now,
+			"attempts": gorm.Expr("attempts + 1"),
+		}).Error
+}
+
+// MarkAttemptFailed 记录一次投递失败，事件保持待投递，下一轮重试
+func (d *OutboxDao) MarkAttemptFailed(ctx context.Context, id int64, reason string) error {
+	if r := []rune(reason); len(r) > 255 {
+		reason = string(r[:255])
+	}
+	return d.db.WithContext(ctx).Model(&model.OutboxEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": reason,
+		}).Error
+}
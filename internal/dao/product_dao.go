@@ -28,11 +28,28 @@ func NewProductDao(db *gorm.DB, redis redis.UniversalClient) *ProductDao {
 
 // 缓存相关常量
 const (
-	productStockKeyTemplate = "stock:%d"
-	productCacheKeyTemplate = "product:%d"
-	productPriceKeyTemplate = "product_price:%d"
-	cacheExpiration         = 30 * time.Minute
-	productDirtySetKey      = "product:dirty"
+	productStockKeyTemplate  = "stock:%d"
+	productWindowKeyTemplate = "stock_window:%d" // 秒杀时间窗口 hash{start,end}，与库存键并列，供Lua原子校验
+	productCacheKeyTemplate  = "product:%d"
+	productPriceKeyTemplate  = "product_price:%d"
+	cacheExpiration          = 30 * time.Minute
+	productDirtySetKey       = "product:dirty"
+	productCreditKey         = "product:stock_credit"      // 授权上调额度 hash{id: quantity}
+	productBaselineKey       = "product:stock_baseline"    // 待计入 initial_stock 的基线调整 hash{id: delta}
+	productBoughtKeyTemplate = "seckill:bought:product:%d" // 用户已购数量 hash{user_id: quantity}
+)
+
+// 库存扣减业务错误（Lua脚本状态码映射）
+var (
+	ErrStockNotEnough    = errors.New("库存不足")
+	ErrSeckillNotStarted = errors.New("秒杀尚未开始")
+	ErrSeckillEnded      = errors.New("秒杀已结束")
+	// ErrExceedPurchaseLimit 用户累计购买数量超出每人限购
+	ErrExceedPurchaseLimit = errors.New("超出每人限购数量")
+	// ErrReservationNotFound 预占记录不存在（已补偿或已过期）
+	ErrReservationNotFound = errors.New("预占记录不存在")
+	// ErrReservationClaimed 预占已被下单消费者认领，不能释放
+	ErrReservationClaimed = errors.New("预占已被认领")
 )
 
 // getProductCacheKey 生成单个商品缓存键
@@ -45,6 +62,11 @@ func getProductStockKey(id int64) string {
 	return fmt.Sprintf(productStockKeyTemplate, id)
 }
 
+// getProductWindowKey 生成秒杀时间窗口缓存键
+func getProductWindowKey(id int64) string {
+	return fmt.Sprintf(productWindowKeyTemplate, id)
+}
+
 // getProductPriceKey 生成价格缓存键
 func getProductPriceKey(id int64) string {
 	return fmt.Sprintf(productPriceKeyTemplate, id)
@@ -104,8 +126,9 @@ func (dao *ProductDao) GetProductByID(ctx context.Context, id int64) (*model.Pro
 	return &product, nil
 }
 
-// CreateProduct 创建商品
+// CreateProduct 创建商品（库存基线等于初始库存）
 func (dao *ProductDao) CreateProduct(ctx context.Context, product *model.Product) (int64, error) {
+	product.InitialStock = product.Stock
 	err := dao.db.WithContext(ctx).Create(product).Error
 	if err != nil {
 		return 0, err
@@ -116,13 +139,33 @@ func (dao *ProductDao) CreateProduct(ctx context.Context, product *model.Product
 // DeleteProductByID 删除商品
 func (dao *ProductDao) DeleteProductByID(ctx context.Context, id int64) error {
 	dao.ClearProductCache(ctx, id)
+	dao.redis.Del(ctx, getProductWindowKey(id), fmt.Sprintf(productBoughtKeyTemplate, id))
 	return dao.db.WithContext(ctx).Delete(&model.Product{}, id).Error
 }
 
 // UpdateProduct 更新商品
-func (dao *ProductDao) UpdateProduct(ctx context.Context, id int64, updates map[string]interface{}) error {
+// updates 含 stock 时把剩余库存设置为该值：在Redis中按当前库存计算差值并原子调整，差值同步计入库存基线，
+// MySQL 库存与基线由对账服务回写，其余字段直接写入 MySQL
+func (dao *ProductDao) UpdateProduct(ctx context.Context, id int64, updates map[string]interface{}, op StockOp) error {
 	dao.ClearProductCache(ctx, id)
-	return dao.db.WithContext(ctx).Model(&model.Product{}).Where("id = ?", id).Updates(updates).Error
+	if stock, ok := updates["stock"]; ok {
+		delete(updates, "stock")
+		if _, _, err := adjustBucket(ctx, dao.redis, dao.productBucket(id), stock.(int32), true, op); err != nil {
+			return fmt.Errorf("调整商品库存失败: %w", err)
+		}
+	}
+	if len(updates) > 0 {
+		if err := dao.db.WithContext(ctx).Model(&model.Product{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	// 秒杀时间变更后删除窗口缓存，下次扣减时按MySQL重新预热
+	_, startChanged := updates["seckill_start_time"]
+	_, endChanged := updates["seckill_end_time"]
+	if startChanged || endChanged {
+		dao.redis.Del(ctx, getProductWindowKey(id))
+	}
+	return nil
 }
 
 // ListProductsFromDBWithStatus 从数据库分页查询商品，支持状态筛选（-1 表示全部）
@@ -192,51 +235,74 @@ func (dao *ProductDao) GetProductPrice(ctx context.Context, id int64) (float64,
 	return p.Price, nil
 }
 
-// DeductStock 优化 - Lua脚本返回状态码，避免额外Redis调用
-func (dao *ProductDao) DeductStock(ctx context.Context, productID int64, quantity int32) error {
-	if quantity <= 0 {
-		return errors.New("扣减数量必须大于0")
+// productBucket 商品库存桶（stock:%d + stock_window:%d）
+func (dao *ProductDao) productBucket(productID int64) *stockBucket {
+	return &stockBucket{
+		name:        fmt.Sprintf("product:%d", productID),
+		kind:        model.StockKindProduct,
+		id:          productID,
+		stockKey:    getProductStockKey(productID),
+		windowKey:   getProductWindowKey(productID),
+		dirtyKey:    productDirtySetKey,
+		creditKey:   productCreditKey,
+		baselineKey: productBaselineKey,
+		boughtKey:   fmt.Sprintf(productBoughtKeyTemplate, productID),
+		lockKey:     fmt.Sprintf("lock:init:stock:%d", productID),
+		load: func(ctx context.Context) (*bucketSnapshot, error) {
+			var product model.Product
+			if err := dao.db.WithContext(ctx).First(&product, productID).Error; err != nil {
+				return nil, err
+			}
+			// 0 表示不限制（非秒杀商品）
+			snap := &bucketSnapshot{stock: product.Stock}
+			if product.SeckillStartTime != nil {
+				snap.startAt = product.SeckillStartTime.Unix()
+			}
+			if product.SeckillEndTime != nil {
+				snap.endAt = product.SeckillEndTime.Unix()
+			}
+			return snap, nil
+		},
 	}
+}
 
-	redisKey := getProductStockKey(productID)
-
-	luaScript := `
-        local stock = redis.call('get', KEYS[1])
-        if not stock then
-            return -1  -- 键不存在
-        end
-        
-        local stockNum = tonumber(stock)
-        local quantity = tonumber(ARGV[1])
-        
-        if stockNum < quantity then
-            return -2  -- 库存不足
-        end
-        
-        redis.call('decrby', KEYS[1], quantity)
-        return stockNum - quantity  -- 成功，返回新库存值
-    `
-
-	result, err := dao.redis.Eval(ctx, luaScript, []string{redisKey}, quantity).Result()
-	if err != nil {
-		return fmt.Errorf("redis执行失败: %w", err)
+// ReserveStock 秒杀预占：去重、时间窗口、每人限购、库存扣减与预占记录在同一Lua脚本内原子完成
+func (dao *ProductDao) ReserveStock(ctx context.Context, r *model.SeckillReservation, perUserLimit int32) error {
+	if _, err := reserveBucket(ctx, dao.redis, dao.productBucket(r.ProductID), r, perUserLimit); err != nil {
+		return err
 	}
 
-	stockResult := result.(int64)
-	switch stockResult {
-	case -1:
-		// 键不存在，安全预热后重试
-		logger.Warn("库存键不存在，尝试预热", "product_id", productID)
-		return dao.safeInitStockAndDeduct(ctx, productID, quantity)
-	case -2:
-		return errors.New("库存不足")
+	// 延迟双删，与扣减路径一致
+	dao.ClearProductCache(ctx, r.ProductID)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		dao.ClearProductCache(context.Background(), r.ProductID)
+	}()
+
+	return nil
+}
+
+// ReleaseReservation 补偿预占：按预占记录归还库存与限购额度（可重复调用）
+func (dao *ProductDao) ReleaseReservation(ctx context.Context, productID int64, ticket string, op StockOp) error {
+	if _, err := releaseBucketReservation(ctx, dao.redis, dao.productBucket(productID), ticket, op); err != nil {
+		return err
 	}
 
-	// 成功：stockResult是新库存值
-	logger.Debug("库存扣减成功", "product_id", productID, "quantity", quantity, "new_stock", stockResult)
+	dao.ClearProductCache(ctx, productID)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		dao.ClearProductCache(context.Background(), productID)
+	}()
+
+	return nil
+}
 
-	// 标记该商品库存已变更，交由对账批处理服务合并更新MySQL
-	_ = dao.redis.SAdd(ctx, productDirtySetKey, strconv.FormatInt(productID, 10)).Err()
+// AdjustStock 管理员增减库存（补货/下架/盘亏）：不受秒杀时间窗口与限购约束，
+// 库存基线在同一脚本内同步调整（订单取消等归还库存走 ReturnStockForUser，不调整基线）
+func (dao *ProductDao) AdjustStock(ctx context.Context, productID int64, delta int32, op StockOp) error {
+	if _, _, err := adjustBucket(ctx, dao.redis, dao.productBucket(productID), delta, false, op); err != nil {
+		return err
+	}
 
 	// 延迟双删缓存
 	// 为什么这样做?
@@ -257,97 +323,12 @@ func (dao *ProductDao) DeductStock(ctx context.Context, productID int64, quantit
 	return nil
 }
 
-// safeInitStockAndDeduct 带分布式锁的安全预热与重试
-func (dao *ProductDao) safeInitStockAndDeduct(ctx context.Context, productID int64, quantity int32) error {
-	lockKey := fmt.Sprintf("lock:init:stock:%d", productID)
-
-	// 获取分布式锁（10秒过期，防止死锁）
-	// 这里锁的意义 防止多人从mysql里加载 然后扣减导致超卖
-	// setNX 只有该键不存在的时候才能被设置
-	acquired, err := dao.redis.SetNX(ctx, lockKey, 1, 30*time.Second).Result()
-	if err != nil {
-		return errors.New("系统繁忙")
-	}
-
-	if !acquired {
-		// 未获取到锁，说明已有线程在加载，等待一段时间后重试扣减
-		time.Sleep(200 * time.Millisecond)
-		return dao.DeductStock(ctx, productID, quantity)
-	}
-
-	defer dao.redis.Del(ctx, lockKey) // 确保释放锁
-
-	// 双重检查（DCL模式）
-	// 万一当我拿到锁的时候 别人就已经加载好了
-	redisKey := getProductStockKey(productID)
-	if exists, _ := dao.redis.Exists(ctx, redisKey).Result(); exists == 0 {
-		if err := dao.initStockFromMySQL(ctx, productID); err != nil {
-			logger.Error("库存预热失败", "product_id", productID, "err", err)
-			return fmt.Errorf("系统初始化中: %w", err)
-		}
-		logger.Info("库存预热成功", "product_id", productID)
-	}
-
-	// 重试扣减
-	return dao.DeductStock(ctx, productID, quantity)
-}
-
-// initStockFromMySQL 从MySQL加载库存（不adjust）
-func (dao *ProductDao) initStockFromMySQL(ctx context.Context, productID int64) error {
-	var product model.Product
-	if err := dao.db.WithContext(ctx).First(&product, productID).Error; err != nil {
+// ReturnStockForUser 归还库存并释放该用户的限购额度（userID<=0 时仅归还库存）
+func (dao *ProductDao) ReturnStockForUser(ctx context.Context, productID, userID int64, quantity int32, op StockOp) error {
+	if _, err := returnBucket(ctx, dao.redis, dao.productBucket(productID), userID, quantity, op); err != nil {
 		return err
 	}
-	redisKey := getProductStockKey(productID)
-	return dao.redis.Set(ctx, redisKey, product.Stock, 0).Err()
-}
-
-// ReturnStock 归还库存（Redis优化版）- Lua返回状态码
-func (dao *ProductDao) ReturnStock(ctx context.Context, productID int64, quantity int32) error {
-	if quantity <= 0 {
-		return errors.New("归还数量必须大于0")
-	}
-
-	redisKey := getProductStockKey(productID)
-
-	luaScript := `
-        local stock = redis.call('get', KEYS[1])
-        if not stock then
-            return -1  -- 键不存在
-        end
-        
-        local stockNum = tonumber(stock)
-        local quantity = tonumber(ARGV[1])
-        local newStock = stockNum + quantity
-        
-        -- 优化点：上限保护（防止库存膨胀攻击）
-        if newStock > 1000000 then
-            return -2  -- 超过上限
-        end
-        
-        redis.call('incrby', KEYS[1], quantity)
-        return newStock  -- 成功，返回新库存值
-    `
-
-	result, err := dao.redis.Eval(ctx, luaScript, []string{redisKey}, quantity).Result()
-	if err != nil {
-		return fmt.Errorf("redis执行失败: %w", err)
-	}
-
-	returnValue := result.(int64)
-	switch returnValue {
-	case -1:
-		// 激进派策略：Redis是唯一真理。如果键不存在，说明数据丢失或未预热，不能贸然从MySQL加载（因为MySQL是归档，可能滞后）
-		// 此时应报错，进入死信队列，由人工确认处理
-		return errors.New("库存键不存在(Redis数据丢失)，无法归还，请人工介入")
-	case -2:
-		return errors.New("库存超过上限，异常")
-	}
-
-	logger.Debug("库存归还成功", "product_id", productID, "new_stock", returnValue)
 
-	// 标记该商品库存已变更，交由对账批处理服务合并更新MySQL
-	_ = dao.redis.SAdd(ctx, productDirtySetKey, strconv.FormatInt(productID, 10)).Err()
 	// 延迟双删，保持与扣减路径一致，降低脏读概率
 	dao.ClearProductCache(ctx, productID)
 	go func() {
@@ -7,6 +7,8 @@ import (
 
 	"github.com/CCDD2022/seckill-system/config"
 	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/CCDD2022/seckill-system/pkg/tracing"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -35,6 +37,8 @@ func InitRedis(cfg *config.RedisConfig) (redis.UniversalClient, error) {
 	}
 	client := redis.NewClient(opts)
 	redisDB = client
+	metrics.RegisterRedisPool(client)
+	tracing.InstrumentRedis(client)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if _, err := client.Ping(ctx).Result(); err != nil {
@@ -0,0 +1,301 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SeckillActivityDao struct {
+	db    *gorm.DB
+	redis redis.UniversalClient
+}
+
+func NewSeckillActivityDao(db *gorm.DB, redis redis.UniversalClient) *SeckillActivityDao {
+	return &SeckillActivityDao{
+		db:    db,
+		redis: redis,
+	}
+}
+
+// 活动缓存相关常量（库存键与商品库存键并列，互不干扰）
+const (
+	activityStockKeyTemplate  = "stock:activity:%d"
+	activityWindowKeyTemplate = "stock_window:activity:%d"
+	activityCacheKeyTemplate  = "seckill_activity:%d"
+	activityDirtySetKey       = "activity:dirty"
+	activityCreditKey         = "activity:stock_credit"      // 授权上调额度 hash{id: quantity}
+	activityBaselineKey       = "activity:stock_baseline"    // 待计入 total_stock 的基线调整 hash{id: delta}
+	activityBoughtKeyTemplate = "seckill:bought:activity:%d" // 用户已购数量 hash{user_id: quantity}
+)
+
+// getActivityStockKey 生成活动库存键
+func getActivityStockKey(id int64) string {
+	return fmt.Sprintf(activityStockKeyTemplate, id)
+}
+
+// getActivityWindowKey 生成活动时间窗口键
+func getActivityWindowKey(id int64) string {
+	return fmt.Sprintf(activityWindowKeyTemplate, id)
+}
+
+// getActivityCacheKey 生成活动详情缓存键
+func getActivityCacheKey(id int64) string {
+	return fmt.Sprintf(activityCacheKeyTemplate, id)
+}
+
+// activityBucket 活动库存桶（stock:activity:%d + stock_window:activity:%d）
+func (dao *SeckillActivityDao) activityBucket(activityID int64) *stockBucket {
+	return &stockBucket{
+		name:        fmt.Sprintf("activity:%d", activityID),
+		kind:        model.StockKindActivity,
+		id:          activityID,
+		stockKey:    getActivityStockKey(activityID),
+		windowKey:   getActivityWindowKey(activityID),
+		dirtyKey:    activityDirtySetKey,
+		creditKey:   activityCreditKey,
+		baselineKey: activityBaselineKey,
+		boughtKey:   fmt.Sprintf(activityBoughtKeyTemplate, activityID),
+		lockKey:     fmt.Sprintf("lock:init:stock:activity:%d", activityID),
+		load: func(ctx context.Context) (*bucketSnapshot, error) {
+			var act model.SeckillActivity
+			if err := dao.db.WithContext(ctx).First(&act, activityID).Error; err != nil {
+				return nil, err
+			}
+			return &bucketSnapshot{
+				stock:   act.Stock,
+				startAt: act.StartTime.Unix(),
+				endAt:   act.EndTime.Unix(),
+			}, nil
+		},
+	}
+}
+
+// CreateActivity 创建活动，并直接预热Redis库存与时间窗口
+func (dao *SeckillActivityDao) CreateActivity(ctx context.Context, act *model.SeckillActivity) (int64, error) {
+	act.Stock = act.TotalStock
+	if err := dao.db.WithContext(ctx).Create(act).Error; err != nil {
+		return 0, err
+	}
+	if err := warmBucket(ctx, dao.redis, dao.activityBucket(act.ID), true, true); err != nil {
+		// 预热失败不影响创建，首次扣减时会加锁重新预热
+		logger.Warn("活动库存预热失败", "activity_id", act.ID, "err", err)
+	}
+	return act.ID, nil
+}
+
+// GetActivityByID 根据ID查询活动（带缓存，空值也缓存防穿透）
+func (dao *SeckillActivityDao) GetActivityByID(ctx context.Context, id int64) (*model.SeckillActivity, error) {
+	cacheKey := getActivityCacheKey(id)
+
+	cachedData, err := dao.redis.Get(ctx, cacheKey).Result()
+	if err == nil {
+		var act model.SeckillActivity
+		if err := json.Unmarshal([]byte(cachedData), &act); err == nil {
+			if act.ID == 0 {
+				return nil, gorm.ErrRecordNotFound
+			}
+			return &act, nil
+		}
+		// 解析失败删除缓存，走数据库
+		dao.redis.Del(ctx, cacheKey)
+	} else if !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	var act model.SeckillActivity
+	err = dao.db.WithContext(ctx).First(&act, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		emptyValue, _ := json.Marshal(&model.SeckillActivity{ID: 0})
+		if err := dao.redis.Set(ctx, cacheKey, emptyValue, 5*time.Minute).Err(); err != nil {
+			logger.Error("缓存写入失败", "key", cacheKey, "err", err)
+		}
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	if actJSON, marshalErr := json.Marshal(act); marshalErr == nil {
+		dao.redis.Set(ctx, cacheKey, actJSON, cacheExpiration)
+	}
+	return &act, nil
+}
+
+// adjustActivityStockScript 追加/缩减活动分配后调整已预热的库存键，仅当库存键已存在时调整
+// 追加分配的库存计入授权上调额度，避免对账回写时被当作异常上调拒绝；缩减后剩余库存不能为负（不能低于已售出/已预占数量）
+// KEYS[1]=库存键 KEYS[2]=授权上调额度hash KEYS[3]=库存日志流 ARGV[1]=差值 ARGV[2]=活动ID ARGV[3...]=日志参数
+// 返回 {状态, 新库存}：0 成功，-1 库存键不存在，-2 剩余库存不足以缩减
+var adjustActivityStockScript = redis.NewScript(stockLogLua + `
+    local current = redis.call('get', KEYS[1])
+    if not current then
+        return {-1, 0}
+    end
+    local delta = tonumber(ARGV[1])
+    if tonumber(current) + delta < 0 then
+        return {-2, tonumber(current)}
+    end
+    if delta > 0 then
+        redis.call('hincrby', KEYS[2], ARGV[2], delta)
+    end
+    local newStock = redis.call('incrby', KEYS[1], delta)
+    stocklog(KEYS[3], 3, ARGV[1], newStock)
+    return {0, newStock}
+`)
+
+// UpdateActivity 更新活动
+// 调整分配库存时按差值同步调整剩余库存（MySQL与已预热的Redis键），任一侧剩余库存不足以缩减时返回 ErrStockNotEnough 且不做修改；
+// 时间变更则重置窗口缓存
+func (dao *SeckillActivityDao) UpdateActivity(ctx context.Context, id int64, updates map[string]interface{}, op StockOp) error {
+	dao.redis.Del(ctx, getActivityCacheKey(id))
+
+	var stockDelta int32
+	var mysqlStock int32
+	var warmed bool
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if total, ok := updates["total_stock"]; ok {
+			var act model.SeckillActivity
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "total_stock", "stock").First(&act, id).Error; err != nil {
+				return err
+			}
+			stockDelta = total.(int32) - act.TotalStock
+			if act.Stock+stockDelta < 0 {
+				return ErrStockNotEnough
+			}
+			if stockDelta != 0 {
+				updates["stock"] = gorm.Expr("stock + ?", stockDelta)
+			}
+		}
+		if err := tx.Model(&model.SeckillActivity{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return err
+		}
+		if stockDelta == 0 {
+			return nil
+		}
+		// Redis 调整放在事务最后：Redis 侧剩余库存不足（已被秒杀预占）时回滚 MySQL 的修改
+		b := dao.activityBucket(id)
+		args := append([]interface{}{stockDelta, id}, b.logArgs(op)...)
+		res, err := adjustActivityStockScript.Run(ctx, dao.redis, []string{b.stockKey, b.creditKey, StockLogStreamKey}, args...).Int64Slice()
+		if err != nil {
+			return fmt.Errorf("调整活动库存失败: %w", err)
+		}
+		switch res[0] {
+		case -2:
+			return ErrStockNotEnough
+		case -1:
+			// 库存键不存在：等待下次按MySQL预热，库存日志记录MySQL侧的变更
+			return tx.Model(&model.SeckillActivity{}).Select("stock").Where("id = ?", id).Scan(&mysqlStock).Error
+		}
+		warmed = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if stockDelta != 0 && !warmed {
+		AppendStockLog(ctx, dao.redis, &model.StockLogMessage{
+			Kind: model.StockKindActivity, TargetID: id, Delta: stockDelta, StockAfter: int64(mysqlStock),
+			Store: model.StockStoreMySQL, Reason: op.Reason, Actor: op.Actor, Ref: op.Ref,
+		})
+	}
+
+	_, startChanged := updates["start_time"]
+	_, endChanged := updates["end_time"]
+	if startChanged || endChanged {
+		dao.redis.Del(ctx, getActivityWindowKey(id))
+	}
+	return nil
+}
+
+// DeleteActivity 删除活动及其Redis库存键
+func (dao *SeckillActivityDao) DeleteActivity(ctx context.Context, id int64) error {
+	if err := dao.db.WithContext(ctx).Delete(&model.SeckillActivity{}, id).Error; err != nil {
+		return err
+	}
+	dao.redis.Del(ctx, getActivityCacheKey(id), getActivityStockKey(id), getActivityWindowKey(id), fmt.Sprintf(activityBoughtKeyTemplate, id))
+	return nil
+}
+
+// ListActivities 分页查询活动，可按商品筛选（productID<=0 表示全部）
+func (dao *SeckillActivityDao) ListActivities(ctx context.Context, productID int64, offset, limit int32) ([]*model.SeckillActivity, int64, error) {
+	var activities []*model.SeckillActivity
+	query := dao.db.WithContext(ctx).Model(&model.SeckillActivity{})
+	if productID > 0 {
+		query = query.Where("product_id = ?", productID)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := query.Order("start_time DESC").Offset(int(offset)).Limit(int(limit)).Find(&activities).Error; err != nil {
+		return nil, 0, err
+	}
+	return activities, total, nil
+}
+
+// ListActiveActivities 分页查询正在进行且仍有库存的活动
+func (dao *SeckillActivityDao) ListActiveActivities(ctx context.Context, offset, limit int32) ([]*model.SeckillActivity, int64, error) {
+	var activities []*model.SeckillActivity
+	now := time.Now().Format(time.DateTime)
+	query := dao.db.WithContext(ctx).Model(&model.SeckillActivity{}).
+		Where("start_time <= ? AND end_time >= ? AND stock > 0", now, now)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := query.Order("end_time ASC").Offset(int(offset)).Limit(int(limit)).Find(&activities).Error; err != nil {
+		return nil, 0, err
+	}
+	return activities, total, nil
+}
+
+// GetLiveStock 读取Redis中的实时剩余库存（未预热时返回false）
+func (dao *SeckillActivityDao) GetLiveStock(ctx context.Context, id int64) (int32, bool) {
+	val, err := dao.redis.Get(ctx, getActivityStockKey(id)).Result()
+	if err != nil {
+		return 0, false
+	}
+	stock, err := strconv.ParseInt(val, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int32(stock), true
+}
+
+// DeductStock 扣减活动库存（时间窗口 + 库存原子校验）
+func (dao *SeckillActivityDao) DeductStock(ctx context.Context, activityID int64, quantity int32, op StockOp) error {
+	_, err := deductBucket(ctx, dao.redis, dao.activityBucket(activityID), quantity, op)
+	return err
+}
+
+// ReserveStock 秒杀预占活动库存（去重 + 时间窗口 + 每人限购 + 扣减 + 预占记录，单脚本原子完成）
+func (dao *SeckillActivityDao) ReserveStock(ctx context.Context, r *model.SeckillReservation, perUserLimit int32) error {
+	_, err := reserveBucket(ctx, dao.redis, dao.activityBucket(r.ActivityID), r, perUserLimit)
+	return err
+}
+
+// ReleaseReservation 补偿活动库存预占（可重复调用）
+func (dao *SeckillActivityDao) ReleaseReservation(ctx context.Context, activityID int64, ticket string, op StockOp) error {
+	_, err := releaseBucketReservation(ctx, dao.redis, dao.activityBucket(activityID), ticket, op)
+	return err
+}
+
+// ReturnStock 归还活动库存
+func (dao *SeckillActivityDao) ReturnStock(ctx context.Context, activityID int64, quantity int32, op StockOp) error {
+	return dao.ReturnStockForUser(ctx, activityID, 0, quantity, op)
+}
+
+// ReturnStockForUser 归还活动库存并释放该用户的限购额度（userID<=0 时仅归还库存）
+func (dao *SeckillActivityDao) ReturnStockForUser(ctx context.Context, activityID, userID int64, quantity int32, op StockOp) error {
+	_, err := returnBucket(ctx, dao.redis, dao.activityBucket(activityID), userID, quantity, op)
+	return err
+}
@@ -0,0 +1,66 @@
+package dao
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// 缩减活动分配不能使剩余库存为负：总量100剩10时改为50（差值-50）被拒绝且不做修改
+func TestAdjustActivityStockScript(t *testing.T) {
+	tests := []struct {
+		name       string
+		stock      string // 空表示库存键未预热
+		delta      int32
+		wantStatus int64
+		wantStock  string
+		wantCredit string
+	}{
+		{name: "shrink below sold", stock: "10", delta: -50, wantStatus: -2, wantStock: "10"},
+		{name: "shrink to zero", stock: "10", delta: -10, wantStatus: 0, wantStock: "0"},
+		{name: "grow", stock: "10", delta: 20, wantStatus: 0, wantStock: "30", wantCredit: "20"},
+		{name: "not warmed", delta: -5, wantStatus: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { _ = rdb.Close() })
+			d := NewSeckillActivityDao(nil, rdb)
+			const id = 7
+			if tt.stock != "" {
+				if err := mr.Set(getActivityStockKey(id), tt.stock); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			b := d.activityBucket(id)
+			args := append([]interface{}{tt.delta, id}, b.logArgs(StockOp{Reason: model.StockReasonAdminEdit})...)
+			res, err := adjustActivityStockScript.Run(context.Background(), rdb, []string{b.stockKey, b.creditKey, StockLogStreamKey}, args...).Int64Slice()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res[0] != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", res[0], tt.wantStatus)
+			}
+			if tt.stock == "" {
+				if mr.Exists(getActivityStockKey(id)) {
+					t.Fatal("stock key created for unwarmed activity")
+				}
+				return
+			}
+			if got, _ := mr.Get(getActivityStockKey(id)); got != tt.wantStock {
+				t.Fatalf("stock = %s, want %s", got, tt.wantStock)
+			}
+			if got := mr.HGet(b.creditKey, "7"); got != tt.wantCredit {
+				t.Fatalf("credit = %q, want %q", got, tt.wantCredit)
+			}
+			if logged := mr.Exists(StockLogStreamKey); logged != (tt.wantStatus == 0) {
+				t.Fatalf("stock log written = %v, want %v", logged, tt.wantStatus == 0)
+			}
+		})
+	}
+}
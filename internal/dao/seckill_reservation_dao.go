@@ -0,0 +1,140 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// SeckillReservationDao 秒杀库存预占台账
+// 预占记录由 ReserveStock 写入并登记到期时间，下单消费者认领后确认/放弃，
+// 超时未认领的预占由清理进程通过 ReleaseReservation 归还库存与限购额度；
+// 下单消息进入死信队列时预占保持认领（HoldReservation），重放后继续下单，丢弃时放弃认领
+type SeckillReservationDao struct {
+	redis redis.UniversalClient
+}
+
+func NewSeckillReservationDao(redis redis.UniversalClient) *SeckillReservationDao {
+	return &SeckillReservationDao{redis: redis}
+}
+
+const (
+	// reservationKeyTemplate 库存预占记录 hash，按ticket索引
+	reservationKeyTemplate = "seckill:reservation:%s"
+	// reservationLedgerKey 待确认的预占台账 zset{ticket: 到期unix秒}
+	reservationLedgerKey = "seckill:reservation:ledger"
+	// reservationRetention 预占记录在到期之后继续保留的时长（秒），留给清理进程读取
+	reservationRetention = 3600
+)
+
+// getReservationKey 生成预占记录键
+func getReservationKey(ticket string) string {
+	return fmt.Sprintf(reservationKeyTemplate, ticket)
+}
+
+// claimReservationScript 认领预占：记录存在则移出台账（清理进程不再处理）、标记已认领并取消过期，
+// 认领后由确认/放弃决定去向，重试延迟再长记录也不会过期丢失（否则库存与限购额度无人归还）
+// KEYS[1]=预占记录键 KEYS[2]=台账 ARGV[1]=ticket
+var claimReservationScript = redis.NewScript(`
+    if redis.call('exists', KEYS[1]) == 0 then
+        return 0  -- 已过期释放或从未预占
+    end
+    redis.call('zrem', KEYS[2], ARGV[1])
+    redis.call('hset', KEYS[1], 'claimed', 1)
+    redis.call('persist', KEYS[1])
+    return 1
+`)
+
+// abandonReservationScript 放弃认领：重新登记到台账并立即到期，由清理进程归还库存
+// KEYS[1]=预占记录键 KEYS[2]=台账 ARGV[1]=ticket ARGV[2]=当前unix秒
+var abandonReservationScript = redis.NewScript(`
+    if redis.call('exists', KEYS[1]) == 0 then
+        return 0
+    end
+    redis.call('hset', KEYS[1], 'claimed', 0)
+    redis.call('zadd', KEYS[2], ARGV[2], ARGV[1])
+    return 1
+`)
+
+// holdReservationScript 保留预占：标记已认领（清理进程不再释放）并取消过期，消息在死信队列中等待处理期间库存保持预占
+// KEYS[1]=预占记录键 KEYS[2]=台账 ARGV[1]=ticket
+var holdReservationScript = redis.NewScript(`
+    if redis.call('exists', KEYS[1]) == 0 then
+        return 0
+    end
+    redis.call('zrem', KEYS[2], ARGV[1])
+    redis.call('hset', KEYS[1], 'claimed', 1)
+    redis.call('persist', KEYS[1])
+    return 1
+`)
+
+// ClaimReservation 下单前认领预占，返回false表示预占已被释放，不应再创建订单
+func (d *SeckillReservationDao) ClaimReservation(ctx context.Context, ticket string) (bool, error) {
+	n, err := claimReservationScript.Run(ctx, d.redis, []string{getReservationKey(ticket), reservationLedgerKey}, ticket).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ConfirmReservation 订单落库后确认预占，删除记录（库存与已购数量保持扣减状态）
+func (d *SeckillReservationDao) ConfirmReservation(ctx context.Context, ticket string) error {
+	_, err := d.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, getReservationKey(ticket))
+		pipe.ZRem(ctx, reservationLedgerKey, ticket)
+		return nil
+	})
+	return err
+}
+
+// AbandonReservation 订单创建失败时放弃认领，交由清理进程立即归还
+func (d *SeckillReservationDao) AbandonReservation(ctx context.Context, ticket string, now int64) error {
+	return abandonReservationScript.Run(ctx, d.redis, []string{getReservationKey(ticket), reservationLedgerKey}, ticket, now).Err()
+}
+
+// HoldReservation 下单消息进入死信队列时保留预占，重放后消费者可再次认领并下单；
+// 丢弃死信时调用 AbandonReservation 交由清理进程归还。返回false表示预占已不存在
+func (d *SeckillReservationDao) HoldReservation(ctx context.Context, ticket string) (bool, error) {
+	n, err := holdReservationScript.Run(ctx, d.redis, []string{getReservationKey(ticket), reservationLedgerKey}, ticket).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ListExpired 查询到期未确认的预占ticket
+func (d *SeckillReservationDao) ListExpired(ctx context.Context, now int64, limit int64) ([]string, error) {
+	return d.redis.ZRangeByScore(ctx, reservationLedgerKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now, 10),
+		Count: limit,
+	}).Result()
+}
+
+// GetReservation 读取预占记录，不存在返回 ErrReservationNotFound
+func (d *SeckillReservationDao) GetReservation(ctx context.Context, ticket string) (*model.SeckillReservation, error) {
+	vals, err := d.redis.HGetAll(ctx, getReservationKey(ticket)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, ErrReservationNotFound
+	}
+	r := &model.SeckillReservation{Ticket: ticket}
+	r.UserID, _ = strconv.ParseInt(vals["user_id"], 10, 64)
+	r.ProductID, _ = strconv.ParseInt(vals["product_id"], 10, 64)
+	r.ActivityID, _ = strconv.ParseInt(vals["activity_id"], 10, 64)
+	r.CreatedAt, _ = strconv.ParseInt(vals["created_at"], 10, 64)
+	r.ExpireAt, _ = strconv.ParseInt(vals["expire_at"], 10, 64)
+	quantity, _ := strconv.ParseInt(vals["quantity"], 10, 32)
+	r.Quantity = int32(quantity)
+	return r, nil
+}
+
+// RemoveFromLedger 从台账移除（预占记录已不存在时清理残留）
+func (d *SeckillReservationDao) RemoveFromLedger(ctx context.Context, ticket string) error {
+	return d.redis.ZRem(ctx, reservationLedgerKey, ticket).Err()
+}
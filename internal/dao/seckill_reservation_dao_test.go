@@ -0,0 +1,43 @@
+package dao
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// 认领后的预占不再过期：重试延迟超过原有效期时仍可再次认领
+func TestClaimReservationPersists(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	d := NewSeckillReservationDao(rdb)
+	ctx := context.Background()
+
+	const ticket = "t1"
+	key := getReservationKey(ticket)
+	mr.HSet(key, "user_id", "1", "product_id", "2", "quantity", "1")
+	mr.SetTTL(key, time.Minute)
+	if _, err := mr.ZAdd(reservationLedgerKey, 100, ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := d.ClaimReservation(ctx, ticket)
+	if err != nil || !ok {
+		t.Fatalf("claim = (%v, %v), want (true, nil)", ok, err)
+	}
+	if ttl := mr.TTL(key); ttl != 0 {
+		t.Fatalf("ttl after claim = %v, want no expiry", ttl)
+	}
+	if mr.Exists(reservationLedgerKey) {
+		t.Fatal("claimed ticket still in ledger")
+	}
+
+	mr.FastForward(2 * time.Hour)
+	if ok, err := d.ClaimReservation(ctx, ticket); err != nil || !ok {
+		t.Fatalf("re-claim after retry delay = (%v, %v), want (true, nil)", ok, err)
+	}
+}
@@ -0,0 +1,93 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// SeckillResultDao 记录秒杀凭证(ticket)对应的异步下单结果
+// 秒杀服务写入处理中，下单消费者写入成功/失败，网关按ticket轮询
+type SeckillResultDao struct {
+	redis redis.UniversalClient
+}
+
+func NewSeckillResultDao(redis redis.UniversalClient) *SeckillResultDao {
+	return &SeckillResultDao{redis: redis}
+}
+
+const (
+	seckillResultKeyTemplate = "seckill:result:%s"
+	seckillResultExpiration  = 24 * time.Hour
+)
+
+var ErrSeckillResultNotFound = errors.New("秒杀凭证不存在或已过期")
+
+// getSeckillResultKey 生成秒杀结果键
+func getSeckillResultKey(ticket string) string {
+	return fmt.Sprintf(seckillResultKeyTemplate, ticket)
+}
+
+// MarkPending 记录处理中状态（在投递下单消息之前调用）
+func (d *SeckillResultDao) MarkPending(ctx context.Context, ticket string, userID, productID int64) error {
+	return d.save(ctx, ticket, map[string]interface{}{
+		"user_id":    userID,
+		"product_id": productID,
+		"status":     model.SeckillResultPending,
+	})
+}
+
+// MarkCreated 记录下单成功及真实订单ID
+func (d *SeckillResultDao) MarkCreated(ctx context.Context, ticket string, orderID int64) error {
+	return d.save(ctx, ticket, map[string]interface{}{
+		"status":   model.SeckillResultCreated,
+		"order_id": orderID,
+	})
+}
+
+// MarkFailed 记录下单失败及原因
+func (d *SeckillResultDao) MarkFailed(ctx context.Context, ticket string, reason string) error {
+	return d.save(ctx, ticket, map[string]interface{}{
+		"status": model.SeckillResultFailed,
+		"reason": reason,
+	})
+}
+
+// save 写入字段并刷新过期时间（Pipeline一次往返）
+func (d *SeckillResultDao) save(ctx context.Context, ticket string, fields map[string]interface{}) error {
+	if ticket == "" {
+		return errors.New("ticket不能为空")
+	}
+	key := getSeckillResultKey(ticket)
+	fields["updated_at"] = time.Now().Unix()
+	_, err := d.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, fields)
+		pipe.Expire(ctx, key, seckillResultExpiration)
+		return nil
+	})
+	return err
+}
+
+// GetResult 查询秒杀结果
+func (d *SeckillResultDao) GetResult(ctx context.Context, ticket string) (*model.SeckillResult, error) {
+	vals, err := d.redis.HGetAll(ctx, getSeckillResultKey(ticket)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, ErrSeckillResultNotFound
+	}
+	res := &model.SeckillResult{Ticket: ticket, Reason: vals["reason"]}
+	res.UserID, _ = strconv.ParseInt(vals["user_id"], 10, 64)
+	res.ProductID, _ = strconv.ParseInt(vals["product_id"], 10, 64)
+	res.OrderID, _ = strconv.ParseInt(vals["order_id"], 10, 64)
+	res.UpdatedAt, _ = strconv.ParseInt(vals["updated_at"], 10, 64)
+	status, _ := strconv.ParseInt(vals["status"], 10, 32)
+	res.Status = int32(status)
+	return res, nil
+}
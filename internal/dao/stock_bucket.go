@@ -0,0 +1,495 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+// stockBucket 一个可被秒杀扣减的Redis库存桶（商品库存或活动分配库存）
+// 两者共用同一套Lua脚本（时间窗口 + 库存原子校验），只是键名与预热来源不同
+type stockBucket struct {
+	name      string // 日志标识，如 product:1 / activity:2
+	kind      string // 库存类型，写入库存日志：product / activity
+	id        int64
+	stockKey  string
+	windowKey string
+	dirtyKey  string // 库存变更后加入的待对账集合
+	creditKey string // 授权上调额度 hash{id: quantity}：归还/补偿类操作累加，对账回写 MySQL 时取走，未授权的上调会被拒绝
+	// 待计入的库存基线调整 hash{id: delta}：管理员增减库存时与库存在同一脚本内累加，
+	// 对账回写时与库存在同一 MySQL 语句内计入基线列，基线与库存不会只改其一
+	baselineKey string
+	boughtKey   string // 用户已购数量 hash{user_id: quantity}，用于每人限购
+	lockKey     string // 预热分布式锁
+	load        func(ctx context.Context) (*bucketSnapshot, error)
+}
+
+// bucketSnapshot 从MySQL加载的库存桶快照，用于Redis预热
+type bucketSnapshot struct {
+	stock   int32
+	startAt int64 // unix秒，0 表示不限制
+	endAt   int64 // unix秒，0 表示不限制
+}
+
+// boughtFallbackTTL 不限时的库存桶，已购记录的保留时长
+const boughtFallbackTTL = 7 * 24 * time.Hour
+
+// stockLogLua 各库存脚本共用：库存变更日志与变更在同一脚本内写入日志流，不会遗漏也不会多记
+// 日志参数由 logArgs 追加在 ARGV 中以 base 开始的 7 个位置：流长度上限、库存类型、库存桶ID、原因、操作者、关联单号、毫秒时间戳
+const stockLogLua = `
+    local function stocklog(stream, base, delta, stock)
+        redis.call('xadd', stream, 'MAXLEN', '~', ARGV[base], '*',
+            'kind', ARGV[base + 1], 'id', ARGV[base + 2], 'delta', delta, 'stock', stock, 'store', 'redis',
+            'reason', ARGV[base + 3], 'actor', ARGV[base + 4], 'ref', ARGV[base + 5], 'ts', ARGV[base + 6])
+    end
+`
+
+// logArgs 库存日志参数，追加在脚本 ARGV 末尾（见 stockLogLua）
+func (b *stockBucket) logArgs(op StockOp) []interface{} {
+	return []interface{}{stockLogMaxLen, b.kind, b.id, op.Reason, op.Actor, op.Ref, time.Now().UnixMilli()}
+}
+
+// deductStockScript 扣减库存：先校验秒杀时间窗口，再校验并扣减库存
+// KEYS[1]=库存键 KEYS[2]=时间窗口键 KEYS[3]=库存日志流 ARGV[1]=数量 ARGV[2]=当前unix秒 ARGV[3...]=日志参数
+var deductStockScript = redis.NewScript(stockLogLua + `
+    local stock = redis.call('get', KEYS[1])
+    if not stock then
+        return -1  -- 键不存在
+    end
+
+    local window = redis.call('hmget', KEYS[2], 'start', 'end')
+    if not window[1] then
+        return -1  -- 时间窗口未缓存，同样走预热
+    end
+
+    local now = tonumber(ARGV[2])
+    local startAt = tonumber(window[1])
+    local endAt = tonumber(window[2])
+    if startAt > 0 and now < startAt then
+        return -3  -- 秒杀未开始
+    end
+    if endAt > 0 and now > endAt then
+        return -4  -- 秒杀已结束
+    end
+
+    local stockNum = tonumber(stock)
+    local quantity = tonumber(ARGV[1])
+
+    if stockNum < quantity then
+        return -2  -- 库存不足
+    end
+
+    redis.call('decrby', KEYS[1], quantity)
+    stocklog(KEYS[3], 3, -quantity, stockNum - quantity)
+    return stockNum - quantity  -- 成功，返回新库存值
+`)
+
+// reserveStockScript 秒杀预占：一次往返内完成时间窗口、限购、库存校验，
+// 扣减库存、累加用户已购数量、写入预占记录并登记到期台账，任一校验失败都不产生副作用
+// KEYS[1]=库存键 KEYS[2]=时间窗口键 KEYS[3]=已购hash KEYS[4]=预占记录键 KEYS[5]=预占台账 KEYS[6]=库存日志流
+// ARGV[1]=数量 ARGV[2]=当前unix秒 ARGV[3]=用户ID ARGV[4]=每人限购
+// ARGV[5]=不限时窗口的已购记录保留秒数 ARGV[6]=预占记录保留秒数
+// ARGV[7]=ticket ARGV[8]=商品ID ARGV[9]=活动ID ARGV[10]=预占到期unix秒 ARGV[11...]=日志参数
+var reserveStockScript = redis.NewScript(stockLogLua + `
+    local stock = redis.call('get', KEYS[1])
+    if not stock then
+        return -1  -- 键不存在
+    end
+
+    local window = redis.call('hmget', KEYS[2], 'start', 'end')
+    if not window[1] then
+        return -1  -- 时间窗口未缓存，同样走预热
+    end
+
+    local now = tonumber(ARGV[2])
+    local startAt = tonumber(window[1])
+    local endAt = tonumber(window[2])
+    if startAt > 0 and now < startAt then
+        return -3  -- 秒杀未开始
+    end
+    if endAt > 0 and now > endAt then
+        return -4  -- 秒杀已结束
+    end
+
+    local stockNum = tonumber(stock)
+    local quantity = tonumber(ARGV[1])
+
+    local bought = tonumber(redis.call('hget', KEYS[3], ARGV[3]) or '0')
+    if bought + quantity > tonumber(ARGV[4]) then
+        return -5  -- 超出每人限购
+    end
+
+    if stockNum < quantity then
+        return -2  -- 库存不足
+    end
+
+    redis.call('decrby', KEYS[1], quantity)
+
+    redis.call('hincrby', KEYS[3], ARGV[3], quantity)
+    -- 已购记录保留到秒杀结束后一天，不限时则按固定时长保留
+    if redis.call('ttl', KEYS[3]) < 0 then
+        if endAt > 0 then
+            redis.call('expireat', KEYS[3], endAt + 86400)
+        else
+            redis.call('expire', KEYS[3], ARGV[5])
+        end
+    end
+
+    redis.call('hset', KEYS[4],
+        'ticket', ARGV[7], 'user_id', ARGV[3], 'product_id', ARGV[8],
+        'activity_id', ARGV[9], 'quantity', quantity, 'created_at', now,
+        'expire_at', ARGV[10], 'claimed', 0)
+    redis.call('expire', KEYS[4], ARGV[6])
+    redis.call('zadd', KEYS[5], ARGV[10], ARGV[7])
+    stocklog(KEYS[6], 11, -quantity, stockNum - quantity)
+    return stockNum - quantity  -- 成功，返回新库存值
+`)
+
+// releaseReservationScript 预占补偿：按预占记录原样归还库存与限购额度，删除记录并移出台账
+// 记录不存在说明已补偿过（或从未预占），直接返回，保证重复调用安全
+// 已被下单消费者认领的预占不能释放，避免订单落库后库存又被归还
+// KEYS[1]=库存键 KEYS[2]=已购hash KEYS[3]=预占记录键 KEYS[4]=预占台账 KEYS[5]=授权上调额度hash KEYS[6]=库存日志流
+// ARGV[1]=ticket ARGV[2]=库存桶ID ARGV[3...]=日志参数
+var releaseReservationScript = redis.NewScript(stockLogLua + `
+    local r = redis.call('hmget', KEYS[3], 'user_id', 'quantity', 'claimed')
+    if not r[1] then
+        redis.call('zrem', KEYS[4], ARGV[1])
+        return -1  -- 预占记录不存在
+    end
+    if r[3] == '1' then
+        return -3  -- 已被认领
+    end
+
+    if redis.call('exists', KEYS[1]) == 0 then
+        return -2  -- 库存键丢失，保留记录等待人工处理
+    end
+
+    local quantity = tonumber(r[2])
+    local newStock = redis.call('incrby', KEYS[1], quantity)
+    redis.call('hincrby', KEYS[5], ARGV[2], quantity)
+
+    local left = redis.call('hincrby', KEYS[2], r[1], -quantity)
+    if left <= 0 then
+        redis.call('hdel', KEYS[2], r[1])
+    end
+
+    redis.call('del', KEYS[3])
+    redis.call('zrem', KEYS[4], ARGV[1])
+    stocklog(KEYS[6], 3, quantity, newStock)
+    return newStock  -- 成功，返回新库存值
+`)
+
+// returnStockScript 归还库存，同时累加授权上调额度
+// KEYS[1]=库存键 KEYS[2]=授权上调额度hash KEYS[3]=库存日志流 ARGV[1]=数量 ARGV[2]=库存桶ID ARGV[3]=用户ID ARGV[4...]=日志参数
+// 可选释放限购额度：KEYS[4]=已购hash
+var returnStockScript = redis.NewScript(stockLogLua + `
+    local stock = redis.call('get', KEYS[1])
+    if not stock then
+        return -1  -- 键不存在
+    end
+
+    local stockNum = tonumber(stock)
+    local quantity = tonumber(ARGV[1])
+    local newStock = stockNum + quantity
+
+    -- 优化点：上限保护（防止库存膨胀攻击）
+    if newStock > 1000000 then
+        return -2  -- 超过上限
+    end
+
+    redis.call('incrby', KEYS[1], quantity)
+    redis.call('hincrby', KEYS[2], ARGV[2], quantity)
+
+    if KEYS[4] then
+        local left = redis.call('hincrby', KEYS[4], ARGV[3], -quantity)
+        if left <= 0 then
+            redis.call('hdel', KEYS[4], ARGV[3])
+        end
+    end
+    stocklog(KEYS[3], 4, quantity, newStock)
+    return newStock  -- 成功，返回新库存值
+`)
+
+// adjustStockScript 管理员调整库存：不校验秒杀时间窗口与限购，库存、授权上调额度与待计入的基线调整在同一脚本内完成
+// 按目标值设置时差值以脚本内读到的当前库存计算，不受并发扣减影响；差值为0时不做任何修改，也不记库存日志
+// KEYS[1]=库存键 KEYS[2]=授权上调额度hash KEYS[3]=基线调整hash KEYS[4]=库存日志流
+// ARGV[1]=变更量（ARGV[3]=1 时为目标库存） ARGV[2]=库存桶ID ARGV[3]=是否按目标值设置 ARGV[4...]=日志参数
+// 返回 {状态, 变更量, 新库存}：状态 -1 库存键不存在，-2 库存不足，-3 超过上限
+var adjustStockScript = redis.NewScript(stockLogLua + `
+    local stock = redis.call('get', KEYS[1])
+    if not stock then
+        return {-1, 0, 0}
+    end
+
+    local stockNum = tonumber(stock)
+    local delta = tonumber(ARGV[1])
+    if ARGV[3] == '1' then
+        delta = delta - stockNum
+    end
+    if delta == 0 then
+        return {0, 0, stockNum}
+    end
+
+    local newStock = stockNum + delta
+    if newStock < 0 then
+        return {-2, 0, stockNum}
+    end
+    if newStock > 1000000 then
+        return {-3, 0, stockNum}
+    end
+
+    redis.call('incrby', KEYS[1], delta)
+    if delta > 0 then
+        redis.call('hincrby', KEYS[2], ARGV[2], delta)
+    end
+    redis.call('hincrby', KEYS[3], ARGV[2], delta)
+    stocklog(KEYS[4], 4, delta, newStock)
+    return {0, delta, newStock}
+`)
+
+// deductResultErr 将扣减/预占脚本的业务状态码映射为错误（-1 由调用方负责预热）
+func deductResultErr(code int64) error {
+	switch code {
+	case -2:
+		return ErrStockNotEnough
+	case -3:
+		return ErrSeckillNotStarted
+	case -4:
+		return ErrSeckillEnded
+	case -5:
+		return ErrExceedPurchaseLimit
+	}
+	return nil
+}
+
+// deductBucket 原子扣减库存桶，返回扣减后的库存
+func deductBucket(ctx context.Context, rdb redis.UniversalClient, b *stockBucket, quantity int32, op StockOp) (int64, error) {
+	if quantity <= 0 {
+		return 0, errors.New("扣减数量必须大于0")
+	}
+
+	args := append([]interface{}{quantity, time.Now().Unix()}, b.logArgs(op)...)
+	stockResult, err := deductStockScript.Run(ctx, rdb, []string{b.stockKey, b.windowKey, StockLogStreamKey}, args...).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("redis执行失败: %w", err)
+	}
+
+	if stockResult == -1 {
+		// 键不存在，安全预热后重试
+		logger.Warn("库存键不存在，尝试预热", "bucket", b.name)
+		return safeInitBucketAndRetry(ctx, rdb, b, func() (int64, error) {
+			return deductBucket(ctx, rdb, b, quantity, op)
+		})
+	}
+	if err := deductResultErr(stockResult); err != nil {
+		return 0, err
+	}
+
+	// 成功：stockResult是新库存值
+	logger.Debug("库存扣减成功", "bucket", b.name, "quantity", quantity, "new_stock", stockResult)
+
+	// 标记该库存桶已变更，交由对账批处理服务合并更新MySQL
+	_ = rdb.SAdd(ctx, b.dirtyKey, strconv.FormatInt(b.id, 10)).Err()
+	return stockResult, nil
+}
+
+// reserveBucket 秒杀预占库存桶（时间窗口 + 限购 + 扣减 + 预占记录，单脚本原子完成），返回扣减后的库存
+func reserveBucket(ctx context.Context, rdb redis.UniversalClient, b *stockBucket, r *model.SeckillReservation, perUserLimit int32) (int64, error) {
+	if r.Quantity <= 0 {
+		return 0, errors.New("扣减数量必须大于0")
+	}
+	if r.Ticket == "" {
+		return 0, errors.New("ticket不能为空")
+	}
+	if r.ExpireAt <= r.CreatedAt {
+		return 0, errors.New("预占到期时间非法")
+	}
+
+	keys := []string{b.stockKey, b.windowKey, b.boughtKey, getReservationKey(r.Ticket), reservationLedgerKey, StockLogStreamKey}
+	args := []interface{}{
+		r.Quantity, r.CreatedAt, r.UserID, perUserLimit,
+		int64(boughtFallbackTTL.Seconds()), r.ExpireAt - r.CreatedAt + reservationRetention,
+		r.Ticket, r.ProductID, r.ActivityID, r.ExpireAt,
+	}
+	args = append(args, b.logArgs(StockOp{Reason: model.StockReasonSeckillReserve, Actor: model.UserActor(r.UserID), Ref: r.Ticket})...)
+	stockResult, err := reserveStockScript.Run(ctx, rdb, keys, args...).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("redis执行失败: %w", err)
+	}
+
+	if stockResult == -1 {
+		logger.Warn("库存键不存在，尝试预热", "bucket", b.name)
+		return safeInitBucketAndRetry(ctx, rdb, b, func() (int64, error) {
+			return reserveBucket(ctx, rdb, b, r, perUserLimit)
+		})
+	}
+	if err := deductResultErr(stockResult); err != nil {
+		return 0, err
+	}
+
+	logger.Debug("库存预占成功", "bucket", b.name, "ticket", r.Ticket, "quantity", r.Quantity, "new_stock", stockResult)
+
+	// 标记该库存桶已变更，交由对账批处理服务合并更新MySQL
+	_ = rdb.SAdd(ctx, b.dirtyKey, strconv.FormatInt(b.id, 10)).Err()
+	return stockResult, nil
+}
+
+// releaseBucketReservation 补偿一次预占，返回归还后的库存
+// 记录不存在时返回 ErrReservationNotFound，已被认领时返回 ErrReservationClaimed
+func releaseBucketReservation(ctx context.Context, rdb redis.UniversalClient, b *stockBucket, ticket string, op StockOp) (int64, error) {
+	if op.Ref == "" {
+		op.Ref = ticket
+	}
+	keys := []string{b.stockKey, b.boughtKey, getReservationKey(ticket), reservationLedgerKey, b.creditKey, StockLogStreamKey}
+	args := append([]interface{}{ticket, b.id}, b.logArgs(op)...)
+	result, err := releaseReservationScript.Run(ctx, rdb, keys, args...).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("redis执行失败: %w", err)
+	}
+
+	switch result {
+	case -1:
+		return 0, ErrReservationNotFound
+	case -2:
+		return 0, errors.New("库存键不存在(Redis数据丢失)，无法归还，请人工介入")
+	case -3:
+		return 0, ErrReservationClaimed
+	}
+
+	logger.Debug("预占已补偿", "bucket", b.name, "ticket", ticket, "new_stock", result)
+
+	_ = rdb.SAdd(ctx, b.dirtyKey, strconv.FormatInt(b.id, 10)).Err()
+	return result, nil
+}
+
+// safeInitBucketAndRetry 带分布式锁的安全预热，预热后执行 retry 重新扣减
+func safeInitBucketAndRetry(ctx context.Context, rdb redis.UniversalClient, b *stockBucket, retry func() (int64, error)) (int64, error) {
+	// 获取分布式锁（30秒过期，防止死锁）
+	// 这里锁的意义 防止多人从mysql里加载 然后扣减导致超卖
+	// setNX 只有该键不存在的时候才能被设置
+	acquired, err := rdb.SetNX(ctx, b.lockKey, 1, 30*time.Second).Result()
+	if err != nil {
+		return 0, errors.New("系统繁忙")
+	}
+
+	if !acquired {
+		// 未获取到锁，说明已有线程在加载，等待一段时间后重试扣减
+		time.Sleep(200 * time.Millisecond)
+		return retry()
+	}
+
+	defer rdb.Del(ctx, b.lockKey) // 确保释放锁
+
+	// 双重检查（DCL模式）
+	// 万一当我拿到锁的时候 别人就已经加载好了
+	// 库存与时间窗口分别检查：已有的库存键不能被MySQL旧值覆盖
+	stockExists, _ := rdb.Exists(ctx, b.stockKey).Result()
+	windowExists, _ := rdb.Exists(ctx, b.windowKey).Result()
+	if stockExists == 0 || windowExists == 0 {
+		if err := warmBucket(ctx, rdb, b, stockExists == 0, windowExists == 0); err != nil {
+			logger.Error("库存预热失败", "bucket", b.name, "err", err)
+			return 0, fmt.Errorf("系统初始化中: %w", err)
+		}
+		logger.Info("库存预热成功", "bucket", b.name)
+	}
+
+	// 重试扣减
+	return retry()
+}
+
+// warmBucket 从MySQL加载库存与秒杀时间窗口（不adjust）
+func warmBucket(ctx context.Context, rdb redis.UniversalClient, b *stockBucket, withStock, withWindow bool) error {
+	snap, err := b.load(ctx)
+	if err != nil {
+		return err
+	}
+	if withStock {
+		if err := rdb.Set(ctx, b.stockKey, snap.stock, 0).Err(); err != nil {
+			return err
+		}
+	}
+	if withWindow {
+		if err := rdb.HSet(ctx, b.windowKey, "start", snap.startAt, "end", snap.endAt).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returnBucket 归还库存桶，返回归还后的库存
+// userID>0 时同时释放该用户的限购额度
+func returnBucket(ctx context.Context, rdb redis.UniversalClient, b *stockBucket, userID int64, quantity int32, op StockOp) (int64, error) {
+	if quantity <= 0 {
+		return 0, errors.New("归还数量必须大于0")
+	}
+
+	keys := []string{b.stockKey, b.creditKey, StockLogStreamKey}
+	args := append([]interface{}{quantity, b.id, userID}, b.logArgs(op)...)
+	if userID > 0 {
+		keys = append(keys, b.boughtKey)
+	}
+
+	returnValue, err := returnStockScript.Run(ctx, rdb, keys, args...).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("redis执行失败: %w", err)
+	}
+
+	switch returnValue {
+	case -1:
+		// 激进派策略：Redis是唯一真理。如果键不存在，说明数据丢失或未预热，不能贸然从MySQL加载（因为MySQL是归档，可能滞后）
+		// 此时应报错，进入死信队列，由人工确认处理
+		return 0, errors.New("库存键不存在(Redis数据丢失)，无法归还，请人工介入")
+	case -2:
+		return 0, errors.New("库存超过上限，异常")
+	}
+
+	logger.Debug("库存归还成功", "bucket", b.name, "new_stock", returnValue)
+
+	// 标记该库存桶已变更，交由对账批处理服务合并更新MySQL
+	_ = rdb.SAdd(ctx, b.dirtyKey, strconv.FormatInt(b.id, 10)).Err()
+	return returnValue, nil
+}
+
+// adjustBucket 管理员调整库存桶并同步调整库存基线，absolute 为 true 时把库存设置为 value，否则增减 value
+// 库存键不存在时先预热；返回实际变更量与调整后的库存
+func adjustBucket(ctx context.Context, rdb redis.UniversalClient, b *stockBucket, value int32, absolute bool, op StockOp) (int64, int64, error) {
+	mode := 0
+	if absolute {
+		mode = 1
+	}
+	keys := []string{b.stockKey, b.creditKey, b.baselineKey, StockLogStreamKey}
+	args := append([]interface{}{value, b.id, mode}, b.logArgs(op)...)
+	res, err := adjustStockScript.Run(ctx, rdb, keys, args...).Int64Slice()
+	if err != nil {
+		return 0, 0, fmt.Errorf("redis执行失败: %w", err)
+	}
+
+	switch res[0] {
+	case -1:
+		logger.Warn("库存键不存在，尝试预热", "bucket", b.name)
+		var delta int64
+		stock, err := safeInitBucketAndRetry(ctx, rdb, b, func() (int64, error) {
+			d, stock, err := adjustBucket(ctx, rdb, b, value, absolute, op)
+			delta = d
+			return stock, err
+		})
+		return delta, stock, err
+	case -2:
+		return 0, 0, ErrStockNotEnough
+	case -3:
+		return 0, 0, errors.New("库存超过上限，异常")
+	}
+
+	delta, stock := res[1], res[2]
+	if delta != 0 {
+		logger.Debug("库存调整成功", "bucket", b.name, "delta", delta, "new_stock", stock)
+		_ = rdb.SAdd(ctx, b.dirtyKey, strconv.FormatInt(b.id, 10)).Err()
+	}
+	return delta, stock, nil
+}
@@ -0,0 +1,92 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestProductDao(t *testing.T) (*ProductDao, *miniredis.Miniredis, redis.UniversalClient) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return NewProductDao(nil, rdb), mr, rdb
+}
+
+// warmProduct 预热商品库存与秒杀时间窗口
+func warmProduct(t *testing.T, mr *miniredis.Miniredis, id int64, stock int, startAt, endAt int64) {
+	t.Helper()
+	if err := mr.Set(getProductStockKey(id), strconv.Itoa(stock)); err != nil {
+		t.Fatal(err)
+	}
+	mr.HSet(getProductWindowKey(id), "start", strconv.FormatInt(startAt, 10), "end", strconv.FormatInt(endAt, 10))
+}
+
+// 管理员扣减/补货不受秒杀时间窗口约束，秒杀扣减在窗口外被拒绝
+func TestAdjustStockIgnoresSeckillWindow(t *testing.T) {
+	now := time.Now().Unix()
+	windows := []struct {
+		name    string
+		startAt int64
+		endAt   int64
+		seckill error
+	}{
+		{name: "not started", startAt: now + 3600, endAt: now + 7200, seckill: ErrSeckillNotStarted},
+		{name: "ended", startAt: now - 7200, endAt: now - 3600, seckill: ErrSeckillEnded},
+		{name: "in window", startAt: now - 3600, endAt: now + 3600},
+	}
+	for _, w := range windows {
+		t.Run(w.name, func(t *testing.T) {
+			d, mr, rdb := newTestProductDao(t)
+			ctx := context.Background()
+			const id = 1
+			warmProduct(t, mr, id, 10, w.startAt, w.endAt)
+
+			_, err := deductBucket(ctx, rdb, d.productBucket(id), 1, StockOp{Reason: model.StockReasonSeckillReserve})
+			if !errors.Is(err, w.seckill) {
+				t.Fatalf("seckill deduct: got %v, want %v", err, w.seckill)
+			}
+			mr.Set(getProductStockKey(id), "10")
+
+			op := StockOp{Reason: model.StockReasonAdminDeduct, Actor: "admin:1"}
+			if err := d.AdjustStock(ctx, id, -3, op); err != nil {
+				t.Fatalf("admin deduct: %v", err)
+			}
+			if err := d.AdjustStock(ctx, id, 2, StockOp{Reason: model.StockReasonAdminReturn, Actor: "admin:1"}); err != nil {
+				t.Fatalf("admin return: %v", err)
+			}
+			if got, _ := mr.Get(getProductStockKey(id)); got != "9" {
+				t.Fatalf("stock = %s, want 9", got)
+			}
+			if got := mr.HGet(productBaselineKey, "1"); got != "-1" {
+				t.Fatalf("baseline delta = %s, want -1", got)
+			}
+			if got := mr.HGet(productCreditKey, "1"); got != "2" {
+				t.Fatalf("credit = %s, want 2", got)
+			}
+		})
+	}
+}
+
+func TestAdjustStockNotEnough(t *testing.T) {
+	d, mr, _ := newTestProductDao(t)
+	warmProduct(t, mr, 1, 2, 0, 0)
+
+	err := d.AdjustStock(context.Background(), 1, -3, StockOp{Reason: model.StockReasonAdminDeduct})
+	if !errors.Is(err, ErrStockNotEnough) {
+		t.Fatalf("got %v, want ErrStockNotEnough", err)
+	}
+	if got, _ := mr.Get(getProductStockKey(1)); got != "2" {
+		t.Fatalf("stock = %s, want 2", got)
+	}
+	if mr.Exists(productBaselineKey) || mr.Exists(StockLogStreamKey) {
+		t.Fatal("rejected deduct must not touch baseline or stock log")
+	}
+}
@@ -0,0 +1,71 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 库存变更日志流：库存脚本写入，stock_log_consumer 以消费组读取后落库
+const (
+	StockLogStreamKey = "stock:log"
+	// stockLogMaxLen 日志流近似上限：消费者长时间停止时丢弃最旧的条目，避免占满 Redis 内存
+	stockLogMaxLen = 200000
+)
+
+// StockOp 一次库存变更的来源，随库存日志记录
+type StockOp struct {
+	Reason string
+	Actor  string
+	Ref    string // 预占 ticket / 订单号等
+}
+
+// AppendStockLog 写入一条库存日志（MySQL 侧变更等无法在库存脚本内记录的场景），失败只记录日志
+func AppendStockLog(ctx context.Context, rdb redis.UniversalClient, msg *model.StockLogMessage) {
+	if msg.TimeMilli == 0 {
+		msg.TimeMilli = time.Now().UnixMilli()
+	}
+	err := rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: StockLogStreamKey,
+		MaxLen: stockLogMaxLen,
+		Approx: true,
+		Values: msg.Values(),
+	}).Err()
+	if err != nil {
+		logger.Warn("写入库存日志失败", "kind", msg.Kind, "id", msg.TargetID, "reason", msg.Reason, "delta", msg.Delta, "err", err)
+	}
+}
+
+// StockLogDao 库存流水持久化与查询
+type StockLogDao struct {
+	db *gorm.DB
+}
+
+func NewStockLogDao(db *gorm.DB) *StockLogDao {
+	return &StockLogDao{db: db}
+}
+
+// CreateStockLogs 批量保存流水，已存在的日志流条目（重复消费）跳过
+func (d *StockLogDao) CreateStockLogs(ctx context.Context, logs []*model.StockLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	return d.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(logs, 500).Error
+}
+
+// ListStockLogs 分页查询一个商品或活动的库存流水（按发生时间倒序）
+func (d *StockLogDao) ListStockLogs(ctx context.Context, kind string, targetID int64, page, pageSize int32) ([]*model.StockLog, int64, error) {
+	var list []*model.StockLog
+	var total int64
+	q := d.db.WithContext(ctx).Model(&model.StockLog{}).Where("kind = ? AND target_id = ?", kind, targetID)
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := q.Order("occurred_at DESC, id DESC").Offset(int((page - 1) * pageSize)).Limit(int(pageSize)).Find(&list).Error
+	return list, total, err
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// DeadLetter 死信消息：dlq_consumer 从死信队列持久化，支持查询、按原路由键重放或丢弃
+type DeadLetter struct {
+	ID          int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	MessageID   string     `gorm:"size:128;index:idx_dead_letters_message,priority:1" json:"message_id"` // 重放时保持不变，消费端按其幂等
+	Exchange    string     `gorm:"size:64;not null" json:"exchange"`                                     // 原交换机（取自 x-death）
+	RoutingKey  string     `gorm:"size:64;not null;index" json:"routing_key"`
+	Queue       string     `gorm:"size:64;index:idx_dead_letters_message,priority:2" json:"queue"` // 死信来源队列
+	Reason      string     `gorm:"size:32" json:"reason"`                                          // rejected / expired / maxlen
+	Headers     string     `gorm:"type:text" json:"headers"`
+	Body        string     `gorm:"type:mediumtext;not null" json:"body"`
+	Status      int32      `gorm:"not null;default:0;index" json:"status"`
+	ReplayCount int32      `gorm:"not null;default:0" json:"replay_count"`
+	ReplayedAt  *time.Time `json:"replayed_at"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (*DeadLetter) TableName() string {
+	return "dead_letters"
+}
+
+// Dead letter status constants
+const (
+	DeadLetterStatusPending   = 0 // 待处理
+	DeadLetterStatusReplayed  = 1 // 已重放
+	DeadLetterStatusDiscarded = 2 // 已丢弃
+)
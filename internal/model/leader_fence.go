@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// LeaderFence 主节点选举在 MySQL 侧的 fencing 记录：新主节点当选时推进 Token，
+// 写入方在同一事务内加共享锁比对 Token，旧任期的写入会被拒绝
+type LeaderFence struct {
+	Name      string    `gorm:"primaryKey;size:64" json:"name"`
+	Token     int64     `gorm:"not null;default:0" json:"token"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (*LeaderFence) TableName() string {
+	return "leader_fences"
+}
@@ -1,17 +1,33 @@
 package model
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // Order 订单模型
 type Order struct {
 	ID         int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
 	UserID     int64     `gorm:"column:user_id;not null;index" json:"user_id"`
 	ProductID  int64     `gorm:"column:product_id;not null;index" json:"product_id"`
+	ActivityID int64     `gorm:"column:activity_id;not null;default:0;index" json:"activity_id"` // 秒杀活动ID，非活动订单为0
 	Quantity   int32     `gorm:"column:quantity;not null" json:"quantity"`
 	TotalPrice float64   `gorm:"column:total_price;not null" json:"total_price"`
 	Status     int32     `gorm:"column:status;default:0" json:"status"` // 0:待支付 1:已支付 2:已取消 3:已完成
 	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
 	UpdatedAt  time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+	// MessageID 来源消息ID（即秒杀ticket，create:<用户ID>:<商品ID>:<纳秒时间戳> 最长约66字符），唯一索引保证同一消息重复投递/死信重放只生成一个订单；非秒杀订单为NULL
+	MessageID *string `gorm:"column:message_id;type:varchar(128);uniqueIndex:uk_orders_message_id" json:"message_id,omitempty"`
+	// SeckillKey 每人每活动（或商品）唯一键，开启 order.unique_seckill_order 时写入；未开启或非秒杀订单为NULL
+	SeckillKey *string `gorm:"column:seckill_key;type:varchar(64);uniqueIndex:uk_orders_seckill_key" json:"-"`
+}
+
+// SeckillOrderKey 秒杀订单的每人唯一键：按活动下单时为 a:<活动ID>:<用户ID>，否则为 p:<商品ID>:<用户ID>
+func SeckillOrderKey(userID, productID, activityID int64) string {
+	if activityID > 0 {
+		return fmt.Sprintf("a:%d:%d", activityID, userID)
+	}
+	return fmt.Sprintf("p:%d:%d", productID, userID)
 }
 
 // TableName 指定表名
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxEvent 事务发件箱：与业务状态变更写在同一事务内，由 outbox_relay 投递到 RabbitMQ
+// 保证业务提交后事件至少投递一次（消费端按 EventID 幂等）
+type OutboxEvent struct {
+	ID         int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	EventID    string     `gorm:"size:128;not null;uniqueIndex" json:"event_id"` // 作为 AMQP MessageId
+	Exchange   string     `gorm:"size:64;not null" json:"exchange"`
+	RoutingKey string     `gorm:"size:64;not null" json:"routing_key"`
+	Payload    string     `gorm:"type:text;not null" json:"payload"`
+	Status     int32      `gorm:"not null;default:0;index" json:"status"`
+	Attempts   int32      `gorm:"not null;default:0" json:"attempts"`
+	LastError  string     `gorm:"size:255" json:"last_error"`
+	SentAt     *time.Time `json:"sent_at"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (*OutboxEvent) TableName() string {
+	return "outbox_events"
+}
+
+// Outbox event status constants
+const (
+	OutboxStatusPending = 0 // 待投递
+	OutboxStatusSent    = 1 // 已投递（Broker已确认）
+)
+
+// NewOutboxEvent 将事件载荷序列化为发件箱记录
+func NewOutboxEvent(eventID, exchange, routingKey string, payload interface{}) (*OutboxEvent, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxEvent{
+		EventID:    eventID,
+		Exchange:   exchange,
+		RoutingKey: routingKey,
+		Payload:    string(body),
+		Status:     OutboxStatusPending,
+	}, nil
+}
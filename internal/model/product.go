@@ -19,6 +19,7 @@ type Product struct {
 	Description       string     `gorm:"type:text" json:"description"`
 	Price             float64    `gorm:"type:decimal(10,2);not null" json:"price"`
 	Stock             int32      `gorm:"not null;default:0" json:"stock"`
+	InitialStock      int32      `gorm:"not null;default:0" json:"-"` // 库存基线：累计投放量（创建时库存 + 管理员调整），对账时用于推算应有库存
 	ImageURL          string     `gorm:"size:255" json:"image_url"`
 	SeckillStartTime  *time.Time `gorm:"index" json:"seckill_start_time"`
 	SeckillEndTime    *time.Time `gorm:"index" json:"seckill_end_time"`
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// SeckillActivity 秒杀活动：把商品与独立的时间窗口、秒杀价、分配库存、限购数量关联起来
+// 同一商品可以多次开展秒杀活动，活动库存与商品库存相互独立
+type SeckillActivity struct {
+	ID           int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID    int64     `gorm:"not null;index" json:"product_id"`
+	Name         string    `gorm:"size:100;not null" json:"name"`
+	SeckillPrice float64   `gorm:"type:decimal(10,2);not null" json:"seckill_price"`
+	TotalStock   int32     `gorm:"not null" json:"total_stock"`              // 活动分配的库存总量
+	Stock        int32     `gorm:"not null;default:0" json:"stock"`          // 剩余库存（Redis为准，由Reconciler回写）
+	PerUserLimit int32     `gorm:"not null;default:1" json:"per_user_limit"` // 每个用户限购数量
+	StartTime    time.Time `gorm:"not null;index" json:"start_time"`
+	EndTime      time.Time `gorm:"not null;index" json:"end_time"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (*SeckillActivity) TableName() string {
+	return "seckill_activities"
+}
+
+// IsActive 判断活动在给定时间是否处于秒杀窗口内
+func (a *SeckillActivity) IsActive(now time.Time) bool {
+	return !now.Before(a.StartTime) && !now.After(a.EndTime)
+}
@@ -0,0 +1,13 @@
+package model
+
+// SeckillReservation 秒杀库存预占记录（存储于Redis，按ticket索引）
+// 与库存扣减、限购累加在同一Lua脚本内写入，回滚时由补偿脚本按记录原样归还
+type SeckillReservation struct {
+	Ticket     string `json:"ticket"`
+	UserID     int64  `json:"user_id"`
+	ProductID  int64  `json:"product_id"`
+	ActivityID int64  `json:"activity_id"`
+	Quantity   int32  `json:"quantity"`
+	CreatedAt  int64  `json:"created_at"` // unix秒
+	ExpireAt   int64  `json:"expire_at"`  // unix秒，到期仍未下单则由清理进程释放
+}
@@ -0,0 +1,19 @@
+package model
+
+// SeckillResult 秒杀异步下单结果（存储于Redis，按ticket查询）
+type SeckillResult struct {
+	Ticket    string `json:"ticket"`
+	UserID    int64  `json:"user_id"`
+	ProductID int64  `json:"product_id"`
+	Status    int32  `json:"status"`
+	OrderID   int64  `json:"order_id"`
+	Reason    string `json:"reason"`
+	UpdatedAt int64  `json:"updated_at"` // unix秒
+}
+
+// Seckill result status constants
+const (
+	SeckillResultPending = 0 // 处理中
+	SeckillResultCreated = 1 // 下单成功
+	SeckillResultFailed  = 2 // 下单失败
+)
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// StockLog 库存变更流水：库存变更时写入 Redis 日志流（与变更在同一 Lua 脚本内），stock_log_consumer 批量落库
+// 用于回答“某商品库存为何从 100 变成 37”
+type StockLog struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	EventID    string    `gorm:"size:32;not null;uniqueIndex" json:"event_id"` // 日志流条目ID，重复消费时幂等
+	Kind       string    `gorm:"size:16;not null;index:idx_stock_logs_target,priority:1" json:"kind"`
+	TargetID   int64     `gorm:"not null;index:idx_stock_logs_target,priority:2" json:"target_id"` // 商品ID或活动ID
+	Delta      int32     `gorm:"not null" json:"delta"`
+	StockAfter int64     `gorm:"not null" json:"stock_after"`
+	Store      string    `gorm:"size:8;not null" json:"store"` // 发生变更的存储：redis / mysql
+	Reason     string    `gorm:"size:32;not null;index" json:"reason"`
+	Actor      string    `gorm:"size:64" json:"actor"`
+	Ref        string    `gorm:"size:128;index" json:"ref"` // 预占 ticket / 订单号等
+	OccurredAt time.Time `gorm:"type:datetime(3);not null;index:idx_stock_logs_target,priority:3" json:"occurred_at"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (*StockLog) TableName() string {
+	return "stock_logs"
+}
+
+// 库存类型
+const (
+	StockKindProduct  = "product"
+	StockKindActivity = "activity"
+)
+
+// 库存存储
+const (
+	StockStoreRedis = "redis"
+	StockStoreMySQL = "mysql"
+)
+
+// 库存变更原因
+const (
+	StockReasonSeckillReserve     = "seckill_reserve"     // 秒杀预占扣减
+	StockReasonReservationRelease = "reservation_release" // 预占补偿归还（投递失败、下单失败或超时未认领）
+	StockReasonOrderCancel        = "order_cancel"        // 订单取消归还
+	StockReasonAdminDeduct        = "admin_deduct"        // 管理员扣减
+	StockReasonAdminReturn        = "admin_return"        // 管理员补货
+	StockReasonAdminEdit          = "admin_edit"          // 管理员修改商品库存 / 活动分配
+	StockReasonAuditRepair        = "audit_repair"        // 全量对账自动修复
+)
+
+// UserActor 用户操作者标识
+func UserActor(userID int64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// SystemActor 后台组件操作者标识
+func SystemActor(component string) string {
+	return "system:" + component
+}
+
+// StockLogMessage 库存变更日志消息（日志流条目的字段）
+type StockLogMessage struct {
+	Kind       string `json:"kind"`
+	TargetID   int64  `json:"id"`
+	Delta      int32  `json:"delta"`
+	StockAfter int64  `json:"stock"`
+	Store      string `json:"store"`
+	Reason     string `json:"reason"`
+	Actor      string `json:"actor"`
+	Ref        string `json:"ref"`
+	TimeMilli  int64  `json:"ts"`
+}
+
+// Values 日志流条目字段，与库存脚本写入的字段一致
+func (m *StockLogMessage) Values() []interface{} {
+	return []interface{}{
+		"kind", m.Kind, "id", m.TargetID, "delta", m.Delta, "stock", m.StockAfter, "store", m.Store,
+		"reason", m.Reason, "actor", m.Actor, "ref", m.Ref, "ts", m.TimeMilli,
+	}
+}
+
+// ParseStockLogMessage 解析日志流条目
+func ParseStockLogMessage(values map[string]interface{}) (*StockLogMessage, error) {
+	str := func(k string) string {
+		s, _ := values[k].(string)
+		return s
+	}
+	num := func(k string) (int64, error) {
+		n, err := strconv.ParseInt(str(k), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("stock log field %s: %w", k, err)
+		}
+		return n, nil
+	}
+
+	m := &StockLogMessage{Kind: str("kind"), Store: str("store"), Reason: str("reason"), Actor: str("actor"), Ref: str("ref")}
+	var err error
+	if m.TargetID, err = num("id"); err != nil {
+		return nil, err
+	}
+	delta, err := num("delta")
+	if err != nil {
+		return nil, err
+	}
+	m.Delta = int32(delta)
+	if m.StockAfter, err = num("stock"); err != nil {
+		return nil, err
+	}
+	if m.TimeMilli, err = num("ts"); err != nil {
+		return nil, err
+	}
+	if m.Kind == "" || m.Reason == "" {
+		return nil, fmt.Errorf("stock log missing kind or reason")
+	}
+	return m, nil
+}
+
+// ToStockLog 转换为流水记录
+func (m *StockLogMessage) ToStockLog(eventID string) *StockLog {
+	return &StockLog{
+		EventID:    eventID,
+		Kind:       m.Kind,
+		TargetID:   m.TargetID,
+		Delta:      m.Delta,
+		StockAfter: m.StockAfter,
+		Store:      m.Store,
+		Reason:     m.Reason,
+		Actor:      m.Actor,
+		Ref:        m.Ref,
+		OccurredAt: time.UnixMilli(m.TimeMilli),
+	}
+}
@@ -0,0 +1,322 @@
+package mq
+
+// 发布确认跟踪：
+// - Confirm 模式下每个通道的 delivery tag 从1开始递增，发布时登记 tag -> MessageId
+// - mandatory 消息不可路由时 Broker 先发 basic.return 再发 ack，退回的消息按 MessageId 标记
+// - 确认到达时判定结果：Nack / 已退回 视为失败，同步模式唤醒等待方，异步模式把失败回调交给池的回调协程执行
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/CCDD2022/seckill-system/pkg/tracing"
+	"github.com/streadway/amqp"
+)
+
+// PublishFailureFunc 发布失败回调（Broker Nack、消息不可路由被退回、通道关闭未收到确认）
+type PublishFailureFunc func(messageID string, err error)
+
+var (
+	ErrPublishNacked   = errors.New("publish nacked by broker")
+	ErrPublishReturned = errors.New("publish returned: no queue bound for routing key")
+	ErrConfirmLost     = errors.New("channel closed before confirm")
+	ErrConfirmTimeout  = errors.New("wait publish confirm timeout")
+)
+
+// pendingConfirm 一条等待Broker确认的发布
+type pendingConfirm struct {
+	messageID string
+	returned  bool
+	taken     bool // 已从登记表取出，结果即将送达
+	onFail    PublishFailureFunc
+	done      chan error // 同步确认时等待结果；为nil表示异步
+}
+
+// publish 登记确认记录后发布（调用方独占该通道，tag 顺序与发布顺序一致）；ctx 中的链路写入消息头
+func (cw *ChannelWrapper) publish(ctx context.Context, exchange, key string, mandatory bool, pc *pendingConfirm, msg amqp.Publishing) error {
+	span := startPublishSpan(ctx, exchange, key, &msg)
+	defer span.End()
+
+	cw.mu.Lock()
+	cw.nextTag++
+	tag := cw.nextTag
+	cw.pending[tag] = pc
+	if pc.messageID != "" {
+		cw.byMsgID[pc.messageID] = tag
+	}
+	cw.mu.Unlock()
+
+	if err := cw.ch.Publish(exchange, key, mandatory, false, msg); err != nil {
+		// 发送失败时客户端不递增确认序号，回退 tag，否则之后的确认都会错位一条
+		cw.mu.Lock()
+		cw.take(tag)
+		cw.nextTag--
+		cw.mu.Unlock()
+		metrics.MQPublished.WithLabelValues(exchange, key, "error").Inc()
+		tracing.RecordError(span, err)
+		return err
+	}
+	metrics.MQPublished.WithLabelValues(exchange, key, "ok").Inc()
+	return nil
+}
+
+// take 取出并删除确认记录（需持有 cw.mu）
+func (cw *ChannelWrapper) take(tag uint64) *pendingConfirm {
+	pc, ok := cw.pending[tag]
+	if !ok {
+		return nil
+	}
+	delete(cw.pending, tag)
+	pc.taken = true
+	if pc.messageID != "" && cw.byMsgID[pc.messageID] == tag {
+		delete(cw.byMsgID, pc.messageID)
+	}
+	return pc
+}
+
+// handleConfirms 后台处理退回与确认，通道关闭时所有未确认的发布按失败处理
+func (cw *ChannelWrapper) handleConfirms() {
+	returns := cw.returns
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			cw.markReturned(r)
+		case cf, ok := <-cw.confirms:
+			if !ok {
+				// 通道已关闭：标记失效，未确认的发布按失败处理，并通知池补齐通道
+				cw.closed.Store(true)
+				cw.failAll()
+				if cw.onClose != nil {
+					cw.onClose(cw)
+				}
+				return
+			}
+			// 退回先于确认送达，但两个通道可能被同时选中，先处理已到达的退回
+			cw.drainReturns(returns)
+			cw.resolve(cf)
+		}
+	}
+}
+
+func (cw *ChannelWrapper) drainReturns(returns <-chan amqp.Return) {
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				return
+			}
+			cw.markReturned(r)
+		default:
+			return
+		}
+	}
+}
+
+func (cw *ChannelWrapper) markReturned(r amqp.Return) {
+	logger.Warn("publish returned", "message_id", r.MessageId, "routing_key", r.RoutingKey, "reply", r.ReplyText)
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if tag, ok := cw.byMsgID[r.MessageId]; ok {
+		cw.pending[tag].returned = true
+	}
+}
+
+// resolve 根据确认结果通知发布方
+func (cw *ChannelWrapper) resolve(cf amqp.Confirmation) {
+	cw.mu.Lock()
+	pc := cw.take(cf.DeliveryTag)
+	var done chan error
+	if pc != nil {
+		done = pc.done
+	}
+	cw.mu.Unlock()
+	if pc == nil {
+		return
+	}
+
+	var err error
+	result := "ack"
+	switch {
+	case !cf.Ack:
+		err, result = ErrPublishNacked, "nack"
+	case pc.returned:
+		err, result = ErrPublishReturned, "returned"
+	}
+	metrics.MQConfirms.WithLabelValues(result).Inc()
+	cw.finish(pc, done, err)
+}
+
+// failAll 通道关闭，未确认的发布结果未知，按失败通知发布方
+func (cw *ChannelWrapper) failAll() {
+	cw.mu.Lock()
+	pending := make([]*pendingConfirm, 0, len(cw.pending))
+	dones := make([]chan error, 0, len(cw.pending))
+	for tag := range cw.pending {
+		pc := cw.take(tag)
+		pending = append(pending, pc)
+		dones = append(dones, pc.done)
+	}
+	cw.mu.Unlock()
+	metrics.MQConfirms.WithLabelValues("lost").Add(float64(len(pending)))
+	for i, pc := range pending {
+		cw.finish(pc, dones[i], ErrConfirmLost)
+	}
+}
+
+// finish 同步模式唤醒等待方，异步模式在失败时把回调交给回调协程（done 需在持有 cw.mu 时读取）
+func (cw *ChannelWrapper) finish(pc *pendingConfirm, done chan error, err error) {
+	if done != nil {
+		done <- err
+		return
+	}
+	if err != nil {
+		logger.Warn("publish not confirmed", "message_id", pc.messageID, "err", err)
+		if pc.onFail != nil {
+			cw.failures.push(pc, err)
+		}
+	}
+}
+
+// failedPublish 一条待执行失败回调的异步发布
+type failedPublish struct {
+	pc  *pendingConfirm
+	err error
+}
+
+// failureQueue 异步发布的失败回调队列
+// 回调（回滚 Redis 预占、落盘 spill 等）由独立协程串行执行，不占用确认处理协程，
+// 慢回调不会阻塞同一通道上后续的确认与退回处理；队列满时确认处理协程等待入队
+type failureQueue struct {
+	ch chan failedPublish
+	wg sync.WaitGroup // 运行中的确认处理协程 + 未执行完的回调，关闭时据此等待回调全部完成
+}
+
+func newFailureQueue(size int) *failureQueue {
+	q := &failureQueue{ch: make(chan failedPublish, size)}
+	go q.run()
+	return q
+}
+
+func (q *failureQueue) run() {
+	for f := range q.ch {
+		f.pc.onFail(f.pc.messageID, f.err)
+		q.wg.Done()
+	}
+}
+
+func (q *failureQueue) push(pc *pendingConfirm, err error) {
+	q.wg.Add(1)
+	q.ch <- failedPublish{pc: pc, err: err}
+}
+
+// wait 等待所有确认处理协程退出、已入队的回调执行完毕，或 ctx 到期
+func (q *failureQueue) wait(ctx context.Context) error {
+	idle := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PublishWithConfirm 发布持久化消息（mandatory）并跟踪Broker确认
+// 同步确认模式：等待确认后返回，失败通过返回值告知，不调用 onFail；
+// 等待超时则转为异步，之后若确认失败再调用 onFail
+// 异步确认模式：发布后立即返回，Nack/退回/通道关闭时在后台调用 onFail
+func (p *Pool) PublishWithConfirm(ctx context.Context, exchange, key string, body []byte, messageID string, onFail PublishFailureFunc) error {
+	pc := &pendingConfirm{messageID: messageID, onFail: onFail}
+	if !p.syncConfirm {
+		_, err := p.publishTracked(ctx, exchange, key, body, nil, pc)
+		return err
+	}
+
+	err := p.publishAndWait(ctx, exchange, key, body, nil, pc)
+	if errors.Is(err, ErrConfirmTimeout) {
+		// 结果未知时不能让调用方回滚（消息可能已入队），已转为异步回调
+		logger.Warn("wait publish confirm timeout, fallback to async callback", "message_id", messageID)
+		return nil
+	}
+	return err
+}
+
+// PublishAndWait 发布持久化消息（mandatory）并等待Broker确认，不受确认模式配置影响
+// 等待超时返回 ErrConfirmTimeout：消息可能已入队，调用方重发时消费端需按 MessageId 幂等
+func (p *Pool) PublishAndWait(ctx context.Context, exchange, key string, body []byte, messageID string) error {
+	return p.publishAndWait(ctx, exchange, key, body, nil, &pendingConfirm{messageID: messageID})
+}
+
+// PublishAndWaitWithHeaders 与 PublishAndWait 相同，并携带消息头（如死信重放时保留原消息头）
+func (p *Pool) PublishAndWaitWithHeaders(ctx context.Context, exchange, key string, body []byte, messageID string, headers amqp.Table) error {
+	return p.publishAndWait(ctx, exchange, key, body, headers, &pendingConfirm{messageID: messageID})
+}
+
+// publishTracked 登记确认记录并发布，发布后立即归还通道
+func (p *Pool) publishTracked(ctx context.Context, exchange, key string, body []byte, headers amqp.Table, pc *pendingConfirm) (*ChannelWrapper, error) {
+	cw, err := p.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	err = cw.publish(ctx, exchange, key, true, pc, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  "application/json",
+		Body:         body,
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    time.Now(),
+		MessageId:    pc.messageID,
+	})
+	// 等待确认不占用通道，其他发布方可继续使用
+	p.Release(cw)
+	return cw, err
+}
+
+// publishAndWait 发布并等待确认，超时或 ctx 结束时转为异步（之后失败调用 pc.onFail）并返回 ErrConfirmTimeout
+func (p *Pool) publishAndWait(ctx context.Context, exchange, key string, body []byte, headers amqp.Table, pc *pendingConfirm) error {
+	pc.done = make(chan error, 1)
+	cw, err := p.publishTracked(ctx, exchange, key, body, headers, pc)
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(p.confirmTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-pc.done:
+		return err
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	cw.mu.Lock()
+	done := pc.done
+	if !pc.taken {
+		pc.done = nil
+	}
+	taken := pc.taken
+	cw.mu.Unlock()
+	if taken {
+		return <-done
+	}
+	return ErrConfirmTimeout
+}
+
+// IsUnavailable 判断发布失败是否由 Broker 不可用引起（连接断开/重连中），
+// 此类失败重发可能成功；Nack 与不可路由退回则不应重发
+func IsUnavailable(err error) bool {
+	return errors.Is(err, ErrPoolUnavailable) ||
+		errors.Is(err, ErrConfirmLost) ||
+		errors.Is(err, ErrConfirmTimeout) ||
+		errors.Is(err, amqp.ErrClosed)
+}
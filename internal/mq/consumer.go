@@ -0,0 +1,279 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/config"
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ConsumerSpec 消费者拓扑与参数，每次（重新）连接都会按此重新声明
+type ConsumerSpec struct {
+	Queue    string
+	BindKey  string
+	Exchange string
+	Durable  bool
+	Prefetch int
+	Args     amqp.Table
+	// Setup 可选，在声明主队列前执行（如声明死信交换机与死信队列）
+	Setup func(ch *amqp.Channel) error
+	// Retry 可选，声明重试延迟队列（到期后按 Exchange/BindKey 转发回主队列，BindKey 需为具体路由键）
+	Retry *RetryPolicy
+}
+
+// Consumer 可自动重连的消费者：连接或通道断开后按退避重连、重新声明拓扑并继续消费
+type Consumer struct {
+	url  string
+	spec ConsumerSpec
+	tag  string // 消费者标签，Shutdown 时按标签取消订阅
+
+	mu          sync.Mutex
+	conn        *amqp.Connection
+	ch          *amqp.Channel // 当前消费通道
+	pubCh       *amqp.Channel // 确认模式的发布通道，用于投递重试消息
+	pubConfirms <-chan amqp.Confirmation
+	closed      bool
+	done        chan struct{}
+	stopped     chan struct{} // Run 返回后关闭
+}
+
+func NewConsumer(cfg *config.MQConfig, spec ConsumerSpec) *Consumer {
+	host, _ := os.Hostname()
+	return &Consumer{
+		url:     fmt.Sprintf("amqp://%s:%s@%s:%d/", cfg.User, cfg.Password, cfg.Host, cfg.Port),
+		spec:    spec,
+		tag:     fmt.Sprintf("%s.%s.%d", spec.Queue, host, os.Getpid()),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Run 阻塞消费：每次连接成功后把投递通道交给 handle，handle 应消费到 msgs 关闭为止
+// 连接断开时 msgs 被关闭，handle 返回后重连；Close 后返回
+// 断开前未确认的消息由 Broker 重新投递，handle 需按 MessageId 幂等
+func (c *Consumer) Run(handle func(msgs <-chan amqp.Delivery)) {
+	defer close(c.stopped)
+	delay := minReconnectDelay
+	for {
+		conn, ch, msgs, err := c.open()
+		if err != nil {
+			if c.isClosed() {
+				return
+			}
+			logger.Warn("consumer connect failed", "queue", c.spec.Queue, "retry_in", delay, "err", err)
+			select {
+			case <-c.done:
+				return
+			case <-time.After(delay):
+			}
+			delay = nextBackoff(delay)
+			continue
+		}
+		delay = minReconnectDelay
+		logger.Info("consumer connected", "queue", c.spec.Queue)
+
+		handle(c.instrument(msgs))
+		CloseConsumer(conn, ch)
+		if c.isClosed() {
+			return
+		}
+		logger.Warn("consumer connection lost, reconnecting", "queue", c.spec.Queue)
+	}
+}
+
+// instrument 转发投递并替换确认器：为每条消息创建消费 span，确认/拒绝时结束 span 并记录处理耗时
+// msgs 关闭后转发通道随之关闭；handle 需消费到通道关闭为止
+func (c *Consumer) instrument(msgs <-chan amqp.Delivery) <-chan amqp.Delivery {
+	out := make(chan amqp.Delivery)
+	go func() {
+		defer close(out)
+		var t *deliveryTracker
+		for d := range msgs {
+			// 同一连接上的投递共用一个确认器，每个连接一个跟踪器
+			if t == nil {
+				t = &deliveryTracker{Acknowledger: d.Acknowledger, queue: c.spec.Queue, pending: make(map[uint64]*deliveryState)}
+			}
+			ctx, span := startConsumeSpan(c.spec.Queue, d)
+			t.add(d.DeliveryTag, &deliveryState{ctx: ctx, span: span, start: time.Now()})
+			d.Acknowledger = t
+			out <- d
+		}
+	}()
+	return out
+}
+
+// deliveryTracker 跟踪未确认的消息：确认/拒绝时记录处理耗时并结束消费 span；
+// multiple 确认（如批量落库后 Ack(tag, true)）结束 tag 及之前的全部消息
+type deliveryTracker struct {
+	amqp.Acknowledger
+	queue string
+
+	mu      sync.Mutex
+	pending map[uint64]*deliveryState // delivery tag -> 处理状态
+}
+
+type deliveryState struct {
+	ctx   context.Context
+	span  trace.Span
+	start time.Time
+}
+
+func (t *deliveryTracker) add(tag uint64, s *deliveryState) {
+	t.mu.Lock()
+	t.pending[tag] = s
+	t.mu.Unlock()
+}
+
+func (t *deliveryTracker) context(tag uint64) context.Context {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s, ok := t.pending[tag]; ok {
+		return s.ctx
+	}
+	return nil
+}
+
+// finish 取出已确认/拒绝的消息并结束
+func (t *deliveryTracker) finish(tag uint64, multiple bool, result string) {
+	t.mu.Lock()
+	var done []*deliveryState
+	if multiple {
+		for k, s := range t.pending {
+			if k <= tag {
+				done = append(done, s)
+				delete(t.pending, k)
+			}
+		}
+	} else if s, ok := t.pending[tag]; ok {
+		done = append(done, s)
+		delete(t.pending, tag)
+	}
+	t.mu.Unlock()
+
+	for _, s := range done {
+		metrics.MQConsumeDuration.WithLabelValues(t.queue, result).Observe(time.Since(s.start).Seconds())
+		s.span.SetAttributes(attribute.String("messaging.rabbitmq.result", result))
+		if result != "ack" {
+			s.span.SetStatus(codes.Error, result)
+		}
+		s.span.End()
+	}
+}
+
+func (t *deliveryTracker) Ack(tag uint64, multiple bool) error {
+	t.finish(tag, multiple, "ack")
+	return t.Acknowledger.Ack(tag, multiple)
+}
+
+func (t *deliveryTracker) Nack(tag uint64, multiple bool, requeue bool) error {
+	t.finish(tag, multiple, "nack")
+	return t.Acknowledger.Nack(tag, multiple, requeue)
+}
+
+func (t *deliveryTracker) Reject(tag uint64, requeue bool) error {
+	t.finish(tag, false, "reject")
+	return t.Acknowledger.Reject(tag, requeue)
+}
+
+// open 建立连接、声明拓扑并开始消费
+func (c *Consumer) open() (*amqp.Connection, *amqp.Channel, <-chan amqp.Delivery, error) {
+	conn, err := amqp.Dial(c.url)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("dial rabbitmq failed: %w", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, nil, fmt.Errorf("open channel failed: %w", err)
+	}
+	if c.spec.Setup != nil {
+		if err := c.spec.Setup(ch); err != nil {
+			CloseConsumer(conn, ch)
+			return nil, nil, nil, err
+		}
+	}
+	if c.spec.Retry != nil {
+		if err := c.spec.Retry.declare(ch, c.spec.Queue, c.spec.Exchange, c.spec.BindKey); err != nil {
+			CloseConsumer(conn, ch)
+			return nil, nil, nil, err
+		}
+	}
+	msgs, err := declareAndConsume(ch, c.spec.Queue, c.spec.BindKey, c.spec.Exchange, c.spec.Durable, c.spec.Prefetch, c.spec.Args, c.tag)
+	if err != nil {
+		CloseConsumer(conn, ch)
+		return nil, nil, nil, err
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		CloseConsumer(conn, ch)
+		return nil, nil, nil, ErrConsumerClosed
+	}
+	c.conn, c.ch = conn, ch
+	// 重试发布通道随旧连接失效，首次重试时在新连接上重建
+	c.pubCh, c.pubConfirms = nil, nil
+	c.mu.Unlock()
+	return conn, ch, msgs, nil
+}
+
+// Close 停止消费：关闭连接使 msgs 关闭，Run 随后返回
+func (c *Consumer) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.done)
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+}
+
+// Shutdown 优雅停止：取消订阅使 Broker 不再投递，已到达的消息仍交给 handle 处理并确认，
+// msgs 关闭、handle 返回后 Run 关闭连接并返回
+// ctx 到期时 handle 仍未返回则强制关闭连接，未确认的消息由 Broker 重新投递
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+		if ch := c.ch; ch != nil {
+			// 等待 cancel-ok 期间不持锁；通道已断开时 msgs 已关闭，Run 会自行返回
+			go func() {
+				if err := ch.Cancel(c.tag, false); err != nil {
+					logger.Warn("cancel consumer failed", "queue", c.spec.Queue, "err", err)
+				}
+			}()
+		}
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.stopped:
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		if c.conn != nil {
+			_ = c.conn.Close()
+		}
+		c.mu.Unlock()
+		return fmt.Errorf("consumer %s drain: %w", c.spec.Queue, ctx.Err())
+	}
+}
+
+func (c *Consumer) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
@@ -3,11 +3,17 @@ package mq
 // 高并发生产者专用 RabbitMQ 封装：
 // - 根据配置初始化连接与生产者通道池
 // - 使用异步 Confirm：发布后不阻塞等待 ACK，后台协程统一处理
-// - 消费者不使用池，每个消费者独立创建 Channel
+// - 确认结果按 delivery tag 关联到 MessageId，支持失败回调与同步确认（见 confirm.go）
+// - 连接/通道断开后自动重连并补齐通道，重连期间发布方短暂等待后快速失败
+// - 消费者不使用池，每个消费者独立创建 Channel，断线重连由 Consumer 负责（见 consumer.go）
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/CCDD2022/seckill-system/config"
@@ -19,15 +25,46 @@ type ChannelWrapper struct {
 	ch *amqp.Channel
 	// 只读通道  接收发布确认结果(来自rabbitMQ服务器)
 	confirms <-chan amqp.Confirmation
+	// mandatory 消息不可路由时由Broker退回
+	returns <-chan amqp.Return
+	// 通道已关闭（连接断开/通道异常），不能再发布
+	closed atomic.Bool
+	// 通道关闭后回调，通知池补齐通道
+	onClose func(*ChannelWrapper)
+	// 异步发布失败回调由池的回调协程执行
+	failures *failureQueue
+
+	mu      sync.Mutex
+	nextTag uint64                     // 本通道已发布的消息数，即下一条消息的 delivery tag - 1
+	pending map[uint64]*pendingConfirm // delivery tag -> 等待确认的发布
+	byMsgID map[string]uint64          // MessageId -> delivery tag，用于关联退回消息
 }
 
+var (
+	ErrPoolUnavailable = errors.New("mq pool unavailable: no healthy channel, reconnecting")
+	ErrPoolClosed      = errors.New("mq pool closed")
+	ErrConsumerClosed  = errors.New("mq consumer closed")
+)
+
 // Pool 维护一个连接与一组生产者通道（带异步确认处理）。
+// 连接断开时后台按退避重连、重新声明已登记的拓扑并补齐通道（见 reconnect.go）
 type Pool struct {
+	url            string
+	channels       chan *ChannelWrapper
+	size           int
+	syncConfirm    bool          // PublishWithConfirm 是否等待Broker确认
+	confirmTimeout time.Duration // 同步确认最长等待时间
+	acquireTimeout time.Duration // 无可用通道（重连中）时发布方最长等待时间
+	failures       *failureQueue // 异步发布失败回调，各通道共用
+
+	mu       sync.Mutex // 保护以下字段
 	conn     *amqp.Connection
-	channels chan *ChannelWrapper
-	size     int
-	mu       sync.Mutex // 防止Close被并发调用
+	live     map[*ChannelWrapper]struct{}   // 当前存活的生产者通道（含已借出的）
+	topology []func(ch *amqp.Channel) error // 已声明的拓扑，重连后重新声明
 	closed   bool
+
+	lost chan struct{} // 有通道异常关闭，需要补齐
+	done chan struct{} // Close 后关闭
 }
 
 // Init 创建连接与生产者通道池，所有通道开启 Confirm 模式并启动后台确认处理。
@@ -44,23 +81,36 @@ func Init(cfg *config.MQConfig) (*Pool, error) {
 	}
 
 	// 创建通道池
-	p := &Pool{conn: conn, channels: make(chan *ChannelWrapper, size), size: size}
+	p := &Pool{
+		url:            url,
+		channels:       make(chan *ChannelWrapper, size),
+		size:           size,
+		syncConfirm:    cfg.ConfirmMode == "sync",
+		confirmTimeout: time.Duration(cfg.ConfirmTimeoutMs) * time.Millisecond,
+		acquireTimeout: time.Duration(cfg.AcquireTimeoutMs) * time.Millisecond,
+		failures:       newFailureQueue(failureQueueSize),
+		conn:           conn,
+		live:           make(map[*ChannelWrapper]struct{}, size),
+		lost:           make(chan struct{}, 1),
+		done:           make(chan struct{}),
+	}
 	// 创建异步确认信道 不会阻塞在这条信道上publish的goroutine
-	for i := 0; i < size; i++ {
-		cw, err := p.createChannelWrapper()
-		if err != nil {
-			_ = conn.Close()
-			return nil, fmt.Errorf("open channel failed: %w", err)
-		}
-		p.channels <- cw
+	if err := p.refill(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("open channel failed: %w", err)
 	}
+	// 后台监听连接与通道关闭，断线重连
+	go p.watch()
 	logger.Info("MQ producer channel pool initialized", "size", size)
 	return p, nil
 }
 
-// createChannelWrapper 创建一个带异步确认处理的生产者通道包装
-func (p *Pool) createChannelWrapper() (*ChannelWrapper, error) {
-	ch, err := p.conn.Channel()
+// failureQueueSize 失败回调队列容量
+const failureQueueSize = 4096
+
+// newChannelWrapper 创建一个带异步确认处理的生产者通道包装
+func newChannelWrapper(conn *amqp.Connection, onClose func(*ChannelWrapper), failures *failureQueue) (*ChannelWrapper, error) {
+	ch, err := conn.Channel()
 	// 设置channel为异步确认模式
 	if err != nil {
 		return nil, err
@@ -72,30 +122,56 @@ func (p *Pool) createChannelWrapper() (*ChannelWrapper, error) {
 
 	// 创建确认监听器  返回带缓冲的确认通道
 	// 可积压1024个确认结果，避免阻塞发布协程
-	conf := ch.NotifyPublish(make(chan amqp.Confirmation, 1024))
-	// 后台异步处理确认结果：仅记录 Nack
-	go func(c <-chan amqp.Confirmation) {
-		for cf := range c {
-			// Ack=true表示消息已经成功送到rabbitMQ服务器
-			if !cf.Ack {
-				logger.Warn("publish not acked", "delivery_tag", cf.DeliveryTag)
-			}
-		}
-	}(conf)
-	return &ChannelWrapper{ch: ch, confirms: conf}, nil
+	cw := &ChannelWrapper{
+		ch:       ch,
+		confirms: ch.NotifyPublish(make(chan amqp.Confirmation, 1024)),
+		returns:  ch.NotifyReturn(make(chan amqp.Return, 1024)),
+		onClose:  onClose,
+		failures: failures,
+		pending:  make(map[uint64]*pendingConfirm),
+		byMsgID:  make(map[string]uint64),
+	}
+	// 后台异步处理确认结果：按 delivery tag 关联到发布记录，Nack/退回时通知发布方
+	failures.wg.Add(1)
+	go func() {
+		defer failures.wg.Done()
+		cw.handleConfirms()
+	}()
+	return cw, nil
 }
 
 // Acquire 获取一个可用生产者ChannelWrapper
-func (p *Pool) Acquire() *ChannelWrapper {
-	return <-p.channels
+// 重连期间最多等待 acquireTimeout，超时返回 ErrPoolUnavailable，调用方快速失败
+func (p *Pool) Acquire() (*ChannelWrapper, error) {
+	timer := time.NewTimer(p.acquireTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case cw := <-p.channels:
+			// 已失效的通道直接丢弃，由后台补齐
+			if cw.closed.Load() {
+				continue
+			}
+			return cw, nil
+		case <-timer.C:
+			return nil, ErrPoolUnavailable
+		case <-p.done:
+			return nil, ErrPoolClosed
+		}
+	}
 }
 
 // Release 归还生产者ChannelWrapper到池中
 func (p *Pool) Release(cw *ChannelWrapper) {
-	if cw == nil || p.closed {
+	if cw == nil || cw.closed.Load() {
 		return
 	}
-	p.channels <- cw
+	select {
+	case p.channels <- cw:
+	default:
+		// 不应发生：存活通道数不超过池容量
+		_ = cw.ch.Close()
+	}
 }
 
 // Close 关闭所有资源
@@ -107,35 +183,131 @@ func (p *Pool) Close() {
 		return
 	}
 	p.closed = true
-	// 关闭go channel
-	close(p.channels)
-	// 逐个关闭amqp channels
-	for cw := range p.channels {
-		_ = cw.ch.Close()
-	}
+	// 通知等待通道的发布方与后台重连协程退出
+	close(p.done)
+	// 关闭连接即关闭其上所有amqp channels
 	_ = p.conn.Close()
 }
 
-// EnsureBaseTopology 仅声明基础交换机，队列由具体消费者声明，避免参数冲突
-func (p *Pool) EnsureBaseTopology() error {
-	ch, err := p.conn.Channel()
+// Shutdown 等待已发布消息的 Broker 确认（或 ctx 到期）后关闭；调用前应已停止发布
+// 到期仍未确认的消息按确认丢失处理（异步模式回调失败处理），关闭后等待失败回调执行完毕
+func (p *Pool) Shutdown(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	var err error
+	for p.unconfirmed() > 0 {
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("wait publish confirms: %d unconfirmed: %w", p.unconfirmed(), ctx.Err())
+		case <-ticker.C:
+			continue
+		}
+		break
+	}
+	p.Close()
+	if werr := p.failures.wait(ctx); werr != nil && err == nil {
+		err = fmt.Errorf("wait publish failure callbacks: %w", werr)
+	}
+	return err
+}
+
+// unconfirmed 所有存活通道上等待确认的发布数
+func (p *Pool) unconfirmed() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for cw := range p.live {
+		cw.mu.Lock()
+		n += len(cw.pending)
+		cw.mu.Unlock()
+	}
+	return n
+}
+
+// ensureTopology 在当前连接上声明拓扑，成功后登记，重连后重新声明
+func (p *Pool) ensureTopology(declare func(ch *amqp.Channel) error) error {
+	p.mu.Lock()
+	conn := p.conn
+	p.mu.Unlock()
+	if err := withChannel(conn, declare); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.topology = append(p.topology, declare)
+	p.mu.Unlock()
+	return nil
+}
+
+// withChannel 打开临时通道执行声明（声明失败会关闭通道，不能复用生产者通道）
+func withChannel(conn *amqp.Connection, fn func(ch *amqp.Channel) error) error {
+	ch, err := conn.Channel()
 	if err != nil {
 		return err
 	}
 	defer ch.Close()
+	return fn(ch)
+}
+
+// EnsureBaseTopology 仅声明基础交换机，队列由具体消费者声明，避免参数冲突
+func (p *Pool) EnsureBaseTopology() error {
 	const exchangeName = "seckill.exchange"
-	if err := ch.ExchangeDeclare(exchangeName, "topic", true, false, false, false, nil); err != nil {
-		return fmt.Errorf("declare exchange failed: %w", err)
+	err := p.ensureTopology(func(ch *amqp.Channel) error {
+		if err := ch.ExchangeDeclare(exchangeName, "topic", true, false, false, false, nil); err != nil {
+			return fmt.Errorf("declare exchange failed: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 	logger.Info("Base MQ exchange ensured")
 	return nil
 }
 
-// PublishAsyncWithID 与 PublishAsync 类似，但可设置 AMQP MessageId 供消费者幂等去重
-func (p *Pool) PublishAsyncWithID(exchange, key string, body []byte, messageID string) error {
-	cw := p.Acquire()
+// EnsureDelayQueue 声明延迟队列：队列本身无消费者，消息按 Expiration 过期后
+// 死信转发到 deadLetterExchange/deadLetterKey，由真正的消费者处理
+// TTL 使用消息级 Expiration 而不是队列参数，修改超时配置时无需重建队列
+func (p *Pool) EnsureDelayQueue(exchange, queue, bindKey, deadLetterExchange, deadLetterKey string) error {
+	args := amqp.Table{
+		"x-dead-letter-exchange":    deadLetterExchange,
+		"x-dead-letter-routing-key": deadLetterKey,
+	}
+	return p.ensureTopology(func(ch *amqp.Channel) error {
+		if _, err := ch.QueueDeclare(queue, true, false, false, false, args); err != nil {
+			return fmt.Errorf("declare delay queue failed: %w", err)
+		}
+		if err := ch.QueueBind(queue, bindKey, exchange, false, nil); err != nil {
+			return fmt.Errorf("bind delay queue failed: %w", err)
+		}
+		return nil
+	})
+}
+
+// PublishDelayedWithID 发布延迟消息（配合 EnsureDelayQueue），delay 后投递到死信路由；ctx 中的链路随消息传递
+func (p *Pool) PublishDelayedWithID(ctx context.Context, exchange, key string, body []byte, messageID string, delay time.Duration) error {
+	cw, err := p.Acquire()
+	if err != nil {
+		return err
+	}
+	defer p.Release(cw)
+	return cw.publish(ctx, exchange, key, false, &pendingConfirm{messageID: messageID}, amqp.Publishing{
+		ContentType:  "application/json",
+		Body:         body,
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    time.Now(),
+		MessageId:    messageID,
+		Expiration:   strconv.FormatInt(delay.Milliseconds(), 10),
+	})
+}
+
+// PublishAsyncWithID 与 PublishAsync 类似，但可设置 AMQP MessageId 供消费者幂等去重；ctx 中的链路随消息传递
+func (p *Pool) PublishAsyncWithID(ctx context.Context, exchange, key string, body []byte, messageID string) error {
+	cw, err := p.Acquire()
+	if err != nil {
+		return err
+	}
 	defer p.Release(cw)
-	return cw.ch.Publish(exchange, key, false, false, amqp.Publishing{
+	return cw.publish(ctx, exchange, key, false, &pendingConfirm{messageID: messageID}, amqp.Publishing{
 		ContentType:  "application/json",
 		Body:         body,
 		DeliveryMode: amqp.Persistent,
@@ -156,45 +328,45 @@ func NewConsumerChannel(cfg *config.MQConfig, queue, bindKey, exchange string, d
 		_ = conn.Close()
 		return nil, nil, nil, fmt.Errorf("open channel failed: %w", err)
 	}
+	msgs, err := declareAndConsume(ch, queue, bindKey, exchange, durable, prefetch, args, "")
+	if err != nil {
+		CloseConsumer(conn, ch)
+		return nil, nil, nil, err
+	}
+	return conn, ch, msgs, nil
+}
+
+// declareAndConsume 声明交换机、队列与绑定，设置预取后开始消费；tag 为空时由客户端生成
+func declareAndConsume(ch *amqp.Channel, queue, bindKey, exchange string, durable bool, prefetch int, args amqp.Table, tag string) (<-chan amqp.Delivery, error) {
 	if exchange != "" {
 		// 确保交换机存在
 		if err := ch.ExchangeDeclare(exchange, "topic", true, false, false, false, nil); err != nil {
-			ch.Close()
-			conn.Close()
-			return nil, nil, nil, fmt.Errorf("declare exchange failed: %w", err)
+			return nil, fmt.Errorf("declare exchange failed: %w", err)
 		}
 	}
 	// 声明队列
 	if _, err := ch.QueueDeclare(queue, durable, false, false, false, args); err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, nil, nil, fmt.Errorf("declare queue failed: %w", err)
+		return nil, fmt.Errorf("declare queue failed: %w", err)
 	}
 
 	// 绑定队列到交换机
 	if bindKey != "" && exchange != "" {
 		if err := ch.QueueBind(queue, bindKey, exchange, false, nil); err != nil {
-			ch.Close()
-			conn.Close()
-			return nil, nil, nil, fmt.Errorf("bind queue failed: %w", err)
+			return nil, fmt.Errorf("bind queue failed: %w", err)
 		}
 	}
 	if prefetch > 0 {
 		if err := ch.Qos(prefetch, 0, false); err != nil {
-			ch.Close()
-			conn.Close()
-			return nil, nil, nil, fmt.Errorf("set qos failed: %w", err)
+			return nil, fmt.Errorf("set qos failed: %w", err)
 		}
 	}
 
 	// 生成消息通道   消费者通过这个获取消息
-	msgs, err := ch.Consume(queue, "", false, false, false, false, nil)
+	msgs, err := ch.Consume(queue, tag, false, false, false, false, nil)
 	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, nil, nil, fmt.Errorf("consume failed: %w", err)
+		return nil, fmt.Errorf("consume failed: %w", err)
 	}
-	return conn, ch, msgs, nil
+	return msgs, nil
 }
 
 // CloseConsumer 关闭消费者连接与通道
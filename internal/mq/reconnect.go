@@ -0,0 +1,215 @@
+package mq
+
+// 生产者池断线重连：
+// - 监听连接 NotifyClose，断开后按指数退避重新拨号、重新声明已登记的拓扑并补齐通道
+// - 单个通道异常关闭（如发布到不存在的交换机）时连接仍可用，只补齐该通道
+// - 重连期间池中没有可用通道，发布方在 Acquire 中等待至多 acquireTimeout 后失败
+
+import (
+	"time"
+
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/streadway/amqp"
+)
+
+const (
+	minReconnectDelay = 500 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+	// 补齐通道失败（连接仍在但开通道失败）时的重试间隔
+	refillInterval = 5 * time.Second
+)
+
+// nextBackoff 指数退避，不超过 maxReconnectDelay
+func nextBackoff(d time.Duration) time.Duration {
+	d *= 2
+	if d > maxReconnectDelay {
+		d = maxReconnectDelay
+	}
+	return d
+}
+
+// watch 后台协程：当前连接断开后重连，直到池关闭
+func (p *Pool) watch() {
+	for {
+		p.mu.Lock()
+		conn := p.conn
+		p.mu.Unlock()
+
+		if !p.serve(conn) {
+			return
+		}
+		if !p.reconnect() {
+			return
+		}
+	}
+}
+
+// serve 在连接存活期间补齐失效通道；连接断开返回 true，池关闭返回 false
+func (p *Pool) serve(conn *amqp.Connection) bool {
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	ticker := time.NewTicker(refillInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return false
+		case amqpErr := <-connClosed:
+			if p.isClosed() {
+				return false
+			}
+			logger.Warn("MQ connection lost, reconnecting", "err", amqpErr)
+			return true
+		case <-p.lost:
+			if err := p.refill(conn); err != nil {
+				logger.Warn("refill MQ channels failed", "err", err)
+			}
+		case <-ticker.C:
+			if p.liveCount() < p.size {
+				if err := p.refill(conn); err != nil {
+					logger.Warn("refill MQ channels failed", "err", err)
+				}
+			}
+		}
+	}
+}
+
+// reconnect 按退避重新拨号，重新声明拓扑并补齐通道；池关闭时返回 false
+func (p *Pool) reconnect() bool {
+	delay := minReconnectDelay
+	for {
+		select {
+		case <-p.done:
+			return false
+		case <-time.After(delay):
+		}
+
+		conn, err := amqp.Dial(p.url)
+		if err != nil {
+			logger.Warn("MQ reconnect failed", "retry_in", nextBackoff(delay), "err", err)
+			delay = nextBackoff(delay)
+			continue
+		}
+		if err := p.redeclare(conn); err != nil {
+			_ = conn.Close()
+			logger.Warn("MQ redeclare topology failed", "retry_in", nextBackoff(delay), "err", err)
+			delay = nextBackoff(delay)
+			continue
+		}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			_ = conn.Close()
+			return false
+		}
+		p.conn = conn
+		p.mu.Unlock()
+
+		// 部分通道创建失败时由 serve 定时继续补齐
+		if err := p.refill(conn); err != nil {
+			logger.Warn("refill MQ channels failed", "err", err)
+		}
+		logger.Info("MQ reconnected", "channels", p.liveCount())
+		return true
+	}
+}
+
+// redeclare 在新连接上重新声明已登记的拓扑（Broker重启后非持久化的声明会丢失）
+func (p *Pool) redeclare(conn *amqp.Connection) error {
+	p.mu.Lock()
+	topology := append([]func(ch *amqp.Channel) error(nil), p.topology...)
+	p.mu.Unlock()
+	for _, declare := range topology {
+		if err := withChannel(conn, declare); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refill 在指定连接上补齐生产者通道
+func (p *Pool) refill(conn *amqp.Connection) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.live) < p.size && !p.closed {
+		cw, err := newChannelWrapper(conn, p.channelLost, p.failures)
+		if err != nil {
+			return err
+		}
+		p.live[cw] = struct{}{}
+		if !p.offer(cw) {
+			// 缓冲区被失效通道占满，清理后重试
+			p.dropClosed()
+			if !p.offer(cw) {
+				delete(p.live, cw)
+				_ = cw.ch.Close()
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// offer 非阻塞放入通道池
+func (p *Pool) offer(cw *ChannelWrapper) bool {
+	select {
+	case p.channels <- cw:
+		return true
+	default:
+		return false
+	}
+}
+
+// dropClosed 丢弃池中已失效的通道
+func (p *Pool) dropClosed() {
+	for n := len(p.channels); n > 0; n-- {
+		select {
+		case cw := <-p.channels:
+			if !cw.closed.Load() {
+				p.offer(cw)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// channelLost 通道关闭回调：移出存活集合并通知后台补齐
+func (p *Pool) channelLost(cw *ChannelWrapper) {
+	p.mu.Lock()
+	delete(p.live, cw)
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return
+	}
+	select {
+	case p.lost <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Pool) liveCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.live)
+}
+
+func (p *Pool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// Ping 连接存活且至少有一个可用的生产者通道时返回nil，供健康检查使用
+func (p *Pool) Ping() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	if p.conn == nil || p.conn.IsClosed() || len(p.live) == 0 {
+		return ErrPoolUnavailable
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package mq
+
+// 消费失败重试拓扑：
+// - 每次重试对应一个延迟队列 <queue>.retry.<delay>ms，队列级 TTL 逐次翻倍
+// - 延迟队列无消费者，消息到期后死信转发回主交换机（路由键为消费者绑定键），重新进入主队列
+// - 已尝试次数记录在消息头 x-retry-attempt 中，达到上限后由调用方 Nack 进入最终死信队列
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/config"
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/streadway/amqp"
+)
+
+// RetryAttemptHeader 消息已重试次数（首次投递不带该头，视为0）
+const RetryAttemptHeader = "x-retry-attempt"
+
+// retryConfirmTimeout 重试消息发布等待确认的超时
+const retryConfirmTimeout = 5 * time.Second
+
+// RetryPolicy 重试策略：最多投递 MaxAttempts 次，第n次重试延迟 BaseDelay*2^(n-1)
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+}
+
+// NewRetryPolicy 按 MQ 配置创建重试策略
+func NewRetryPolicy(cfg *config.MQConfig) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: cfg.RetryMaxAttempts,
+		BaseDelay:   time.Duration(cfg.RetryBaseDelayMs) * time.Millisecond,
+	}
+}
+
+// delay 第 attempt 次重试（从1开始）的延迟
+func (r *RetryPolicy) delay(attempt int) time.Duration {
+	return r.BaseDelay << (attempt - 1)
+}
+
+// queueName 第 attempt 次重试的延迟队列名（名称带延迟时长，调整配置时不会与已有队列参数冲突）
+func (r *RetryPolicy) queueName(queue string, attempt int) string {
+	return fmt.Sprintf("%s.retry.%dms", queue, r.delay(attempt).Milliseconds())
+}
+
+// declare 声明全部重试延迟队列，到期后死信转发回 exchange/routingKey
+func (r *RetryPolicy) declare(ch *amqp.Channel, queue, exchange, routingKey string) error {
+	for attempt := 1; attempt < r.MaxAttempts; attempt++ {
+		args := amqp.Table{
+			"x-message-ttl":             r.delay(attempt).Milliseconds(),
+			"x-dead-letter-exchange":    exchange,
+			"x-dead-letter-routing-key": routingKey,
+		}
+		if _, err := ch.QueueDeclare(r.queueName(queue, attempt), true, false, false, false, args); err != nil {
+			return fmt.Errorf("declare retry queue failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// RetryAttempt 读取消息已重试次数
+func RetryAttempt(d amqp.Delivery) int {
+	switch v := d.Headers[RetryAttemptHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	case int16:
+		return int(v)
+	case int8:
+		return int(v)
+	}
+	return 0
+}
+
+// Retry 把处理失败的消息投递到下一级重试延迟队列并确认原消息
+// 返回 true 表示消息稍后会重新投递；返回 false 表示未配置重试或次数已用尽，调用方应 Nack 进入死信队列
+// 重试队列发布失败时原消息重新入队，同样返回 true
+func (c *Consumer) Retry(d amqp.Delivery) bool {
+	policy := c.spec.Retry
+	if policy == nil {
+		return false
+	}
+	attempt := RetryAttempt(d) + 1
+	if attempt >= policy.MaxAttempts {
+		logger.Warn("retry attempts exhausted", "queue", c.spec.Queue, "message_id", d.MessageId, "attempts", attempt)
+		return false
+	}
+
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[RetryAttemptHeader] = int32(attempt)
+	err := c.publishRetry(policy.queueName(c.spec.Queue, attempt), amqp.Publishing{
+		Headers:      headers,
+		ContentType:  d.ContentType,
+		Body:         d.Body,
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    time.Now(),
+		MessageId:    d.MessageId,
+	})
+	if err != nil {
+		logger.Error("publish retry failed, requeue", "queue", c.spec.Queue, "message_id", d.MessageId, "err", err)
+		_ = d.Nack(false, true)
+		return true
+	}
+	logger.Info("message scheduled for retry", "queue", c.spec.Queue, "message_id", d.MessageId, "attempt", attempt, "delay", policy.delay(attempt))
+	_ = d.Ack(false)
+	return true
+}
+
+// publishRetry 经默认交换机直接投递到重试队列并等待确认
+func (c *Consumer) publishRetry(queue string, msg amqp.Publishing) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pubCh == nil {
+		if err := c.openRetryChannel(); err != nil {
+			return err
+		}
+	}
+	if err := c.pubCh.Publish("", queue, false, false, msg); err != nil {
+		c.pubCh = nil
+		metrics.MQPublished.WithLabelValues("", queue, "error").Inc()
+		return err
+	}
+	metrics.MQPublished.WithLabelValues("", queue, "ok").Inc()
+	select {
+	case cf, ok := <-c.pubConfirms:
+		if !ok {
+			c.pubCh = nil
+			metrics.MQConfirms.WithLabelValues("lost").Inc()
+			return ErrConfirmLost
+		}
+		if !cf.Ack {
+			metrics.MQConfirms.WithLabelValues("nack").Inc()
+			return ErrPublishNacked
+		}
+		metrics.MQConfirms.WithLabelValues("ack").Inc()
+		return nil
+	case <-time.After(retryConfirmTimeout):
+		// 迟到的确认会与下一条错位，关闭发布通道，后续重试直接重新入队直到重连
+		_ = c.pubCh.Close()
+		c.pubCh = nil
+		metrics.MQConfirms.WithLabelValues("timeout").Inc()
+		return ErrConfirmTimeout
+	}
+}
+
+// openRetryChannel 在当前连接上打开确认模式的发布通道（需持有 c.mu）
+func (c *Consumer) openRetryChannel() error {
+	if c.conn == nil {
+		return amqp.ErrClosed
+	}
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("open retry channel failed: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return fmt.Errorf("enable confirm failed: %w", err)
+	}
+	c.pubCh = ch
+	c.pubConfirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	return nil
+}
@@ -0,0 +1,319 @@
+package mq
+
+// 本地溢写日志（spill WAL）：
+// - Broker 不可用时把发布失败的消息追加写入本地文件（每条一行 JSON，写入后 fsync）
+// - 后台重放协程按写入顺序、以原 MessageId 重新发布，Broker 确认后推进已重放偏移量
+// - 偏移量持久化在 <path>.offset，全部重放完成后截断文件
+// - 被 Broker 连续拒绝（Nack/不可路由退回）达到上限的消息移入 <path>.dead 并跳过，不阻塞后续重放
+// - 记录写入时的链路上下文，重放的消息仍归属原请求的链路
+// - 进程在“已确认但未推进偏移量”时退出会重复投递，消费端按 MessageId 幂等
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var ErrSpillFull = errors.New("spill log full")
+
+// SpillEntry 一条未能发布的消息
+type SpillEntry struct {
+	MessageID  string            `json:"message_id"`
+	Exchange   string            `json:"exchange"`
+	RoutingKey string            `json:"routing_key"`
+	Body       []byte            `json:"body"`
+	SpilledAt  int64             `json:"spilled_at"`
+	Trace      map[string]string `json:"trace,omitempty"` // 写入时的链路上下文（traceparent/tracestate）
+}
+
+// SpillLog 追加写的本地溢写文件
+type SpillLog struct {
+	path        string
+	maxBytes    int64
+	maxAttempts int // 同一条消息被 Broker 拒绝的次数上限，达到后移入死信文件
+
+	// 仅重放协程访问：当前被拒绝的记录偏移与已拒绝次数
+	rejectedAt int64
+	rejections int
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64 // 文件大小（已写入字节数）
+	offset int64 // 已重放到的字节偏移
+	depth  int64 // 未重放的消息数
+}
+
+// OpenSpillLog 打开（或创建）溢写文件，恢复已重放偏移量与积压深度
+// maxAttempts 为同一条消息被 Broker 拒绝（Nack/不可路由退回）的重放次数上限
+func OpenSpillLog(path string, maxBytes int64, maxAttempts int) (*SpillLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create spill dir failed: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open spill log failed: %w", err)
+	}
+	l := &SpillLog{path: path, maxBytes: maxBytes, maxAttempts: maxAttempts, rejectedAt: -1, f: f}
+	if err := l.recover(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(l.size, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	l.report()
+	if l.depth > 0 {
+		logger.Warn("spill log has pending messages", "path", path, "depth", l.depth)
+	}
+	return l, nil
+}
+
+// recover 读取偏移量，截掉末尾写了一半的记录，统计未重放的消息数
+func (l *SpillLog) recover() error {
+	if b, err := os.ReadFile(l.offsetPath()); err == nil {
+		l.offset, _ = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("read spill offset failed: %w", err)
+	}
+
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var pos, valid int64
+	r := bufio.NewReader(l.f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			// 末尾不完整的一行（写入时进程退出），丢弃
+			break
+		}
+		pos += int64(len(line))
+		valid = pos
+		if pos > l.offset {
+			l.depth++
+		}
+	}
+	if err := l.f.Truncate(valid); err != nil {
+		return fmt.Errorf("truncate spill log failed: %w", err)
+	}
+	l.size = valid
+	if l.offset > l.size {
+		l.offset = l.size
+	}
+	return nil
+}
+
+// Append 追加一条消息并落盘，返回后即可认为消息不会丢失；ctx 中的链路一并记录
+func (l *SpillLog) Append(ctx context.Context, e *SpillEntry) error {
+	if e.Trace == nil {
+		carrier := propagation.MapCarrier{}
+		otel.GetTextMapPropagator().Inject(ctx, carrier)
+		if len(carrier) > 0 {
+			e.Trace = carrier
+		}
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size+int64(len(line)) > l.maxBytes {
+		return ErrSpillFull
+	}
+	if _, err := l.f.Write(line); err != nil {
+		return fmt.Errorf("write spill log failed: %w", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("sync spill log failed: %w", err)
+	}
+	l.size += int64(len(line))
+	l.depth++
+	l.report()
+	return nil
+}
+
+// Depth 未重放的消息数
+func (l *SpillLog) Depth() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.depth
+}
+
+// Replay 按写入顺序重放积压消息，publish 返回错误时停止（下次从该条继续）；
+// 同一条消息被 Broker 拒绝达到 maxAttempts 次后移入死信文件并继续重放后续消息
+// 返回本次重放成功的条数
+func (l *SpillLog) Replay(publish func(e *SpillEntry) error) (int, error) {
+	l.mu.Lock()
+	start, end := l.offset, l.size
+	l.mu.Unlock()
+	if start >= end {
+		return 0, nil
+	}
+
+	rf, err := os.Open(l.path)
+	if err != nil {
+		return 0, err
+	}
+	defer rf.Close()
+	r := bufio.NewReader(io.NewSectionReader(rf, start, end-start))
+
+	replayed := 0
+	pos := start
+	for pos < end {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return replayed, fmt.Errorf("read spill log failed: %w", err)
+		}
+		var e SpillEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			// 损坏的记录无法重放，跳过
+			logger.Error("spill entry corrupted, skipped", "offset", pos, "err", err)
+		} else if err := publish(&e); err != nil {
+			if !l.exhausted(pos, err) {
+				return replayed, err
+			}
+			if err := l.deadLetter(line); err != nil {
+				return replayed, err
+			}
+			metrics.MQSpillDeadLettered.Inc()
+			logger.Error("ALARM: spill entry rejected repeatedly, moved to dead-letter file", "message_id", e.MessageID,
+				"routing_key", e.RoutingKey, "attempts", l.maxAttempts, "path", l.deadPath(), "err", err)
+		} else {
+			replayed++
+		}
+		pos += int64(len(line))
+		if err := l.advance(pos); err != nil {
+			return replayed, err
+		}
+	}
+	return replayed, l.compact()
+}
+
+// exhausted 记录一次发布失败，返回该条消息是否已被 Broker 拒绝达到上限
+// 只统计 Nack 与不可路由退回：Broker 不可用时失败与消息本身无关，不计次
+func (l *SpillLog) exhausted(pos int64, err error) bool {
+	if !errors.Is(err, ErrPublishNacked) && !errors.Is(err, ErrPublishReturned) {
+		return false
+	}
+	if pos != l.rejectedAt {
+		l.rejectedAt, l.rejections = pos, 0
+	}
+	l.rejections++
+	return l.rejections >= l.maxAttempts
+}
+
+// deadLetter 把无法投递的记录原样追加到死信文件并落盘，人工处理后可手动重放
+func (l *SpillLog) deadLetter(line []byte) error {
+	f, err := os.OpenFile(l.deadPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open spill dead-letter file failed: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("write spill dead-letter file failed: %w", err)
+	}
+	return f.Sync()
+}
+
+// advance 推进并持久化已重放偏移量
+func (l *SpillLog) advance(pos int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.offset = pos
+	l.depth--
+	l.report()
+	return l.saveOffset()
+}
+
+// compact 全部重放完成且期间没有新写入时截断文件
+func (l *SpillLog) compact() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.offset < l.size {
+		return nil
+	}
+	if err := l.f.Truncate(0); err != nil {
+		return fmt.Errorf("truncate spill log failed: %w", err)
+	}
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	l.size, l.offset, l.depth = 0, 0, 0
+	l.report()
+	return l.saveOffset()
+}
+
+// saveOffset 原子写入偏移量文件（需持有 l.mu）
+func (l *SpillLog) saveOffset() error {
+	tmp := l.offsetPath() + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(l.offset, 10)), 0o644); err != nil {
+		return fmt.Errorf("write spill offset failed: %w", err)
+	}
+	return os.Rename(tmp, l.offsetPath())
+}
+
+func (l *SpillLog) offsetPath() string {
+	return l.path + ".offset"
+}
+
+func (l *SpillLog) deadPath() string {
+	return l.path + ".dead"
+}
+
+// report 更新积压指标（需持有 l.mu）
+func (l *SpillLog) report() {
+	metrics.MQSpillDepth.Set(float64(l.depth))
+	metrics.MQSpillBytes.Set(float64(l.size - l.offset))
+}
+
+// Close 关闭溢写文件
+func (l *SpillLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// RunReplayer 后台重放：有积压时逐条以原 MessageId 发布并等待 Broker 确认，直到 ctx 结束
+// Broker 仍不可用时本轮停止，下个周期重试
+func (l *SpillLog) RunReplayer(ctx context.Context, p *Pool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if l.Depth() == 0 {
+			continue
+		}
+		n, err := l.Replay(func(e *SpillEntry) error {
+			// 沿用写入时的链路，重放的发布 span 挂在原请求下
+			pctx := otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(e.Trace))
+			return p.PublishAndWait(pctx, e.Exchange, e.RoutingKey, e.Body, e.MessageID)
+		})
+		if err != nil {
+			logger.Warn("spill replay paused", "replayed", n, "depth", l.Depth(), "err", err)
+			continue
+		}
+		logger.Info("spill replay finished", "replayed", n, "depth", l.Depth())
+	}
+}
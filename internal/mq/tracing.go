@@ -0,0 +1,98 @@
+package mq
+
+// 链路追踪：发布时创建 producer span 并把 W3C Trace Context 写入 AMQP 消息头，
+// 消费时从消息头提取上游链路、为每条消息创建 consumer span，确认/拒绝时结束。
+// 重试与死信转发保留原消息头，重新投递的消息仍归属原链路。
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/CCDD2022/seckill-system/pkg/tracing"
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// headerCarrier 以 AMQP 消息头承载链路上下文
+type headerCarrier amqp.Table
+
+func (c headerCarrier) Get(key string) string {
+	if v, ok := c[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// startPublishSpan 创建发布 span 并把链路注入 msg.Headers（保留已有消息头）
+func startPublishSpan(ctx context.Context, exchange, key string, msg *amqp.Publishing) trace.Span {
+	ctx, span := tracing.Tracer().Start(ctx, "publish "+destination(exchange, key),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.operation.type", "publish"),
+			attribute.String("messaging.destination.name", exchange),
+			attribute.String("messaging.rabbitmq.destination.routing_key", key),
+			attribute.String("messaging.message.id", msg.MessageId),
+		),
+	)
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(msg.Headers))
+	return span
+}
+
+// startConsumeSpan 从消息头提取上游链路并创建消费 span
+func startConsumeSpan(queue string, d amqp.Delivery) (context.Context, trace.Span) {
+	ctx := extract(d)
+	return tracing.Tracer().Start(ctx, "process "+queue,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.operation.type", "process"),
+			attribute.String("messaging.destination.name", queue),
+			attribute.String("messaging.rabbitmq.destination.routing_key", d.RoutingKey),
+			attribute.String("messaging.message.id", d.MessageId),
+			attribute.Int("messaging.rabbitmq.retry_attempt", RetryAttempt(d)),
+		),
+	)
+}
+
+// DeliveryContext 消息所属链路的 context：由 Consumer 投递的消息返回其消费 span，
+// 否则返回从消息头提取的上游链路。处理消息时用它访问 Redis/MySQL/MQ，下游调用即归属同一链路
+func DeliveryContext(d amqp.Delivery) context.Context {
+	if t, ok := d.Acknowledger.(*deliveryTracker); ok {
+		if ctx := t.context(d.DeliveryTag); ctx != nil {
+			return ctx
+		}
+	}
+	return extract(d)
+}
+
+func extract(d amqp.Delivery) context.Context {
+	if len(d.Headers) == 0 {
+		return context.Background()
+	}
+	return otel.GetTextMapPropagator().Extract(context.Background(), headerCarrier(d.Headers))
+}
+
+func destination(exchange, key string) string {
+	if exchange == "" {
+		return key // 默认交换机：路由键即队列名
+	}
+	return fmt.Sprintf("%s/%s", exchange, key)
+}
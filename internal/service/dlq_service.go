@@ -0,0 +1,251 @@
+// Package service 死信管理服务实现
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/internal/dao"
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"github.com/CCDD2022/seckill-system/internal/mq"
+	"github.com/CCDD2022/seckill-system/pkg/e"
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/proto_output/dlq"
+	"github.com/streadway/amqp"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultDLQBatch = 100  // 按条件批量处理的默认条数
+	maxDLQBatch     = 1000 // 单次批量处理上限
+	// orderCreateRoutingKey 下单消息：进入死信时库存预占保持认领，重放前需确认预占仍在，丢弃时归还
+	orderCreateRoutingKey = "order.create"
+)
+
+type DLQService struct {
+	deadLetterDao  *dao.DeadLetterDao
+	reservationDao *dao.SeckillReservationDao
+	mqPool         *mq.Pool
+	dlq.UnimplementedDLQServiceServer
+}
+
+// NewDLQService 死信管理服务（重放经生产者池发布并等待Broker确认）
+func NewDLQService(deadLetterDao *dao.DeadLetterDao, reservationDao *dao.SeckillReservationDao, mqPool *mq.Pool) *DLQService {
+	return &DLQService{
+		deadLetterDao:  deadLetterDao,
+		reservationDao: reservationDao,
+		mqPool:         mqPool,
+	}
+}
+
+// ListDeadLetters 分页查询死信
+func (s *DLQService) ListDeadLetters(ctx context.Context, req *dlq.ListDeadLettersRequest) (*dlq.ListDeadLettersResponse, error) {
+	page, pageSize := req.Page, req.PageSize
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	list, total, err := s.deadLetterDao.ListDeadLetters(ctx, toDeadLetterFilter(req.Filter), page, pageSize)
+	if err != nil {
+		return &dlq.ListDeadLettersResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+	}
+
+	items := make([]*dlq.DeadLetter, 0, len(list))
+	for _, dl := range list {
+		items = append(items, toDeadLetterProto(dl))
+	}
+	return &dlq.ListDeadLettersResponse{
+		Code:        e.SUCCESS,
+		Message:     e.GetMsg(e.SUCCESS),
+		DeadLetters: items,
+		Total:       int32(total),
+	}, nil
+}
+
+// GetDeadLetter 查看单条死信
+func (s *DLQService) GetDeadLetter(ctx context.Context, req *dlq.GetDeadLetterRequest) (*dlq.GetDeadLetterResponse, error) {
+	dl, err := s.deadLetterDao.GetDeadLetterByID(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &dlq.GetDeadLetterResponse{Code: e.ERROR_NOT_EXIST, Message: "死信不存在"}, nil
+		}
+		return &dlq.GetDeadLetterResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+	}
+	return &dlq.GetDeadLetterResponse{
+		Code:       e.SUCCESS,
+		Message:    e.GetMsg(e.SUCCESS),
+		DeadLetter: toDeadLetterProto(dl),
+	}, nil
+}
+
+// ReplayDeadLetters 按原交换机与路由键重放，保持原 MessageId 与消息头，消费端幂等去重仍然有效
+// 逐条等待Broker确认后标记已重放；已丢弃的死信、库存预占已释放的下单消息不会被重放
+func (s *DLQService) ReplayDeadLetters(ctx context.Context, req *dlq.ReplayDeadLettersRequest) (*dlq.ReplayDeadLettersResponse, error) {
+	list, err := s.selectDeadLetters(ctx, req.Ids, req.Filter, req.Limit)
+	if err != nil {
+		return &dlq.ReplayDeadLettersResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+	}
+
+	resp := &dlq.ReplayDeadLettersResponse{Code: e.SUCCESS, Message: e.GetMsg(e.SUCCESS)}
+	for _, dl := range list {
+		if dl.Status == model.DeadLetterStatusDiscarded {
+			resp.Failures = append(resp.Failures, &dlq.ReplayFailure{Id: dl.ID, Reason: "死信已丢弃"})
+			continue
+		}
+		if reason := s.checkReplayable(ctx, dl); reason != "" {
+			resp.Failures = append(resp.Failures, &dlq.ReplayFailure{Id: dl.ID, Reason: reason})
+			continue
+		}
+		if err := s.mqPool.PublishAndWaitWithHeaders(ctx, dl.Exchange, dl.RoutingKey, []byte(dl.Body), dl.MessageID, replayHeaders(dl.Headers)); err != nil {
+			logger.Warn("死信重放失败", "id", dl.ID, "message_id", dl.MessageID, "err", err)
+			resp.Failures = append(resp.Failures, &dlq.ReplayFailure{Id: dl.ID, Reason: err.Error()})
+			continue
+		}
+		// 已发布但标记失败时再次重放会重复投递，消费端按 MessageId 幂等
+		if err := s.deadLetterDao.MarkReplayed(ctx, dl.ID); err != nil {
+			logger.Error("标记死信已重放失败", "id", dl.ID, "err", err)
+		}
+		resp.Replayed++
+		logger.Info("死信已重放", "id", dl.ID, "message_id", dl.MessageID, "routing_key", dl.RoutingKey)
+	}
+	return resp, nil
+}
+
+// DiscardDeadLetters 丢弃待处理的死信
+func (s *DLQService) DiscardDeadLetters(ctx context.Context, req *dlq.DiscardDeadLettersRequest) (*dlq.DiscardDeadLettersResponse, error) {
+	list, err := s.selectDeadLetters(ctx, req.Ids, req.Filter, req.Limit)
+	if err != nil {
+		return &dlq.DiscardDeadLettersResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+	}
+	ids := make([]int64, 0, len(list))
+	for _, dl := range list {
+		ids = append(ids, dl.ID)
+	}
+	var n int64
+	if len(ids) > 0 {
+		if n, err = s.deadLetterDao.DiscardDeadLetters(ctx, ids); err != nil {
+			return &dlq.DiscardDeadLettersResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+		}
+	}
+	// 丢弃的下单消息不会再创建订单：放弃认领，由清理进程归还库存与限购额度并标记秒杀结果失败
+	for _, dl := range list {
+		if dl.Status != model.DeadLetterStatusPending || !holdsReservation(dl) {
+			continue
+		}
+		if err := s.reservationDao.AbandonReservation(ctx, dl.MessageID, time.Now().Unix()); err != nil {
+			logger.Error("归还丢弃死信的库存预占失败", "id", dl.ID, "message_id", dl.MessageID, "err", err)
+		}
+	}
+	return &dlq.DiscardDeadLettersResponse{
+		Code:      e.SUCCESS,
+		Message:   e.GetMsg(e.SUCCESS),
+		Discarded: int32(n),
+	}, nil
+}
+
+// checkReplayable 重放前检查，返回不可重放的原因
+// 下单消息只有库存预占仍在时才能下单，预占已释放（如进入死信前已过期）的重放会被消费者跳过
+func (s *DLQService) checkReplayable(ctx context.Context, dl *model.DeadLetter) string {
+	if !holdsReservation(dl) {
+		return ""
+	}
+	_, err := s.reservationDao.GetReservation(ctx, dl.MessageID)
+	if errors.Is(err, dao.ErrReservationNotFound) {
+		return "库存预占已释放或订单已创建，重放不会下单"
+	}
+	if err != nil {
+		return "查询库存预占失败: " + err.Error()
+	}
+	return ""
+}
+
+// holdsReservation 死信是否为占有库存预占的下单消息
+func holdsReservation(dl *model.DeadLetter) bool {
+	return dl.RoutingKey == orderCreateRoutingKey && dl.MessageID != ""
+}
+
+// replayHeaders 还原死信保存的原消息头（JSON），去掉 Broker 写入的死信记录与重试次数，重放后重新计数
+// JSON 数字还原为整数或浮点数，嵌套结构不再携带
+func replayHeaders(raw string) amqp.Table {
+	if raw == "" {
+		return nil
+	}
+	var saved map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &saved); err != nil {
+		logger.Warn("死信消息头解析失败，重放不携带原消息头", "err", err)
+		return nil
+	}
+	headers := amqp.Table{}
+	for k, v := range saved {
+		if k == mq.RetryAttemptHeader || strings.HasPrefix(k, "x-death") || strings.HasPrefix(k, "x-first-death") || strings.HasPrefix(k, "x-last-death") {
+			continue
+		}
+		switch val := v.(type) {
+		case string, bool:
+			headers[k] = val
+		case float64:
+			if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+				headers[k] = int64(val)
+			} else {
+				headers[k] = val
+			}
+		}
+	}
+	return headers
+}
+
+// selectDeadLetters ids 非空时按ID查询，否则按条件查询（默认只处理待处理的死信）
+func (s *DLQService) selectDeadLetters(ctx context.Context, ids []int64, f *dlq.DeadLetterFilter, limit int32) ([]*model.DeadLetter, error) {
+	if len(ids) > 0 {
+		if len(ids) > maxDLQBatch {
+			ids = ids[:maxDLQBatch]
+		}
+		return s.deadLetterDao.GetDeadLettersByIDs(ctx, ids)
+	}
+	if limit <= 0 {
+		limit = defaultDLQBatch
+	}
+	if limit > maxDLQBatch {
+		limit = maxDLQBatch
+	}
+	return s.deadLetterDao.FindDeadLetters(ctx, toDeadLetterFilter(f), int(limit))
+}
+
+func toDeadLetterFilter(f *dlq.DeadLetterFilter) dao.DeadLetterFilter {
+	if f == nil {
+		return dao.DeadLetterFilter{Status: model.DeadLetterStatusPending}
+	}
+	return dao.DeadLetterFilter{
+		Status:     f.Status,
+		RoutingKey: f.RoutingKey,
+		Queue:      f.Queue,
+		Reason:     f.Reason,
+		MessageID:  f.MessageId,
+	}
+}
+
+func toDeadLetterProto(dl *model.DeadLetter) *dlq.DeadLetter {
+	p := &dlq.DeadLetter{
+		Id:          dl.ID,
+		MessageId:   dl.MessageID,
+		Exchange:    dl.Exchange,
+		RoutingKey:  dl.RoutingKey,
+		Queue:       dl.Queue,
+		Reason:      dl.Reason,
+		Headers:     dl.Headers,
+		Body:        dl.Body,
+		Status:      dl.Status,
+		ReplayCount: dl.ReplayCount,
+		CreatedAt:   dl.CreatedAt.Unix(),
+	}
+	if dl.ReplayedAt != nil {
+		p.ReplayedAt = dl.ReplayedAt.Unix()
+	}
+	return p
+}
@@ -3,15 +3,14 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/CCDD2022/seckill-system/internal/dao"
 	"github.com/CCDD2022/seckill-system/internal/model"
-	"github.com/CCDD2022/seckill-system/internal/mq"
 	"github.com/CCDD2022/seckill-system/pkg/e"
+	"github.com/CCDD2022/seckill-system/pkg/idgen"
 	"github.com/CCDD2022/seckill-system/pkg/logger"
 	"github.com/CCDD2022/seckill-system/proto_output/order"
 	"gorm.io/gorm"
@@ -23,6 +22,7 @@ type orderCanceledEvent struct {
 	OrderID    int64  `json:"order_id"`
 	UserID     int64  `json:"user_id"`
 	ProductID  int64  `json:"product_id"`
+	ActivityID int64  `json:"activity_id"`
 	Quantity   int32  `json:"quantity"`
 }
 
@@ -30,22 +30,32 @@ const orderCanceledKey = "order.canceled"
 
 type OrderService struct {
 	orderDao *dao.OrderDao
-	mqPool   *mq.Pool
+	idGen    *idgen.Generator
 	order.UnimplementedOrderServiceServer
 }
 
-// NewOrderServiceWithMQ 带MQ发布能力的订单服务（使用生产者池）
-func NewOrderServiceWithMQ(orderDao *dao.OrderDao, mqPool *mq.Pool) *OrderService {
+// NewOrderService 订单服务（订单事件经事务发件箱由 outbox_relay 投递）
+func NewOrderService(orderDao *dao.OrderDao, idGen *idgen.Generator) *OrderService {
 	return &OrderService{
 		orderDao: orderDao,
-		mqPool:   mqPool,
+		idGen:    idGen,
 	}
 }
 
 // CreateOrder 创建订单
 func (s *OrderService) CreateOrder(ctx context.Context, req *order.CreateOrderRequest) (*order.CreateOrderResponse, error) {
+	// 与秒杀订单共用ID生成器，避免显式ID与自增ID冲突
+	orderID, err := s.idGen.NextID()
+	if err != nil {
+		return &order.CreateOrderResponse{
+			Code:    e.ERROR,
+			Message: e.GetMsg(e.ERROR),
+		}, err
+	}
+
 	// 创建订单模型  待支付
 	newOrder := &model.Order{
+		ID:         orderID,
 		UserID:     req.UserId,
 		ProductID:  req.ProductId,
 		Quantity:   req.Quantity,
@@ -54,7 +64,7 @@ func (s *OrderService) CreateOrder(ctx context.Context, req *order.CreateOrderRe
 	}
 
 	// 保存到数据库
-	err := s.orderDao.CreateOrder(ctx, newOrder)
+	err = s.orderDao.CreateOrder(ctx, newOrder)
 	if err != nil {
 		return &order.CreateOrderResponse{
 			Code:    e.ERROR,
@@ -89,6 +99,7 @@ func (s *OrderService) GetOrder(ctx context.Context, req *order.GetOrderRequest)
 		Id:         orderData.ID,
 		UserId:     orderData.UserID,
 		ProductId:  orderData.ProductID,
+		ActivityId: orderData.ActivityID,
 		Quantity:   orderData.Quantity,
 		TotalPrice: orderData.TotalPrice,
 		Status:     orderData.Status,
@@ -119,6 +130,7 @@ func (s *OrderService) ListUserOrders(ctx context.Context, req *order.ListUserOr
 			Id:         o.ID,
 			UserId:     o.UserID,
 			ProductId:  o.ProductID,
+			ActivityId: o.ActivityID,
 			Quantity:   o.Quantity,
 			TotalPrice: o.TotalPrice,
 			Status:     o.Status,
@@ -157,10 +169,25 @@ func (s *OrderService) CancelOrder(ctx context.Context, req *order.CancelOrderRe
 		return &order.CancelOrderResponse{Code: e.SUCCESS, Message: "订单状态不可取消或已处理"}, nil
 	}
 
-	// 状态改为Canceled
-	err := s.orderDao.CancelOrder(ctx, req.OrderId)
+	// 使用确定性幂等ID（不包含时间）避免重复取消产生不同事件ID
+	evt := orderCanceledEvent{
+		EventID:    deterministicEventID(req.OrderId, ord.ProductID, req.UserId, "cancel"),
+		OccurredAt: time.Now().Unix(),
+		OrderID:    req.OrderId,
+		UserID:     req.UserId,
+		ProductID:  ord.ProductID,
+		ActivityID: ord.ActivityID,
+		Quantity:   ord.Quantity,
+	}
+	outboxEvt, err := model.NewOutboxEvent(evt.EventID, "seckill.exchange", orderCanceledKey, evt)
+	if err != nil {
+		return &order.CancelOrderResponse{Code: e.ERROR, Message: "取消订单失败"}, err
+	}
+
+	// 状态改为Canceled，取消事件在同一事务内写入发件箱，由 outbox_relay 投递（至少一次）
+	err = s.orderDao.CancelOrder(ctx, req.OrderId, outboxEvt)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, dao.ErrOrderStatusChanged) {
 			return &order.CancelOrderResponse{
 				Code:    e.ERROR_ORDER_STATUS_CHANGED,
 				Message: e.GetMsg(e.ERROR_ORDER_STATUS_CHANGED),
@@ -171,29 +198,7 @@ func (s *OrderService) CancelOrder(ctx context.Context, req *order.CancelOrderRe
 			Message: "取消订单失败",
 		}, err
 	}
-
-	// 发布取消事件（生产者池异步发布，不等待确认）
-	if s.mqPool != nil {
-		// 使用确定性幂等ID（不包含时间）避免重复取消产生不同事件ID
-		evt := orderCanceledEvent{
-			EventID:    deterministicEventID(req.OrderId, ord.ProductID, req.UserId, "cancel"),
-			OccurredAt: time.Now().Unix(),
-			OrderID:    req.OrderId,
-			UserID:     req.UserId,
-			ProductID:  ord.ProductID,
-			Quantity:   ord.Quantity,
-		}
-		if b, mErr := json.Marshal(evt); mErr == nil {
-			// 使用事件ID作为 AMQP MessageId，实现跨队列幂等追踪
-			if err := s.mqPool.PublishAsyncWithID("seckill.exchange", orderCanceledKey, b, evt.EventID); err != nil {
-				logger.Warn("订单取消事件发布失败", "order_id", req.OrderId, "err", err)
-			} else {
-				logger.Info("订单取消事件已发布", "order_id", req.OrderId, "product_id", ord.ProductID, "qty", ord.Quantity, "event_id", evt.EventID)
-			}
-		} else {
-			logger.Warn("订单取消事件序列化失败", "order_id", req.OrderId, "err", mErr)
-		}
-	}
+	logger.Info("订单已取消，取消事件已写入发件箱", "order_id", req.OrderId, "product_id", ord.ProductID, "qty", ord.Quantity, "event_id", evt.EventID)
 
 	return &order.CancelOrderResponse{
 		Code:    e.SUCCESS,
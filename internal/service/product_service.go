@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/CCDD2022/seckill-system/internal/dao"
@@ -11,13 +12,17 @@ import (
 )
 
 type ProductService struct {
-	productDao *dao.ProductDao
+	productDao  *dao.ProductDao
+	activityDao *dao.SeckillActivityDao
+	stockLogDao *dao.StockLogDao
 	product.UnimplementedProductServiceServer
 }
 
-func NewProductService(productDao *dao.ProductDao) *ProductService {
+func NewProductService(productDao *dao.ProductDao, activityDao *dao.SeckillActivityDao, stockLogDao *dao.StockLogDao) *ProductService {
 	return &ProductService{
-		productDao: productDao,
+		productDao:  productDao,
+		activityDao: activityDao,
+		stockLogDao: stockLogDao,
 	}
 }
 
@@ -128,8 +133,15 @@ func (s *ProductService) UpdateProduct(ctx context.Context, request *product.Upd
 	if request.Price > 0 {
 		updates["price"] = request.Price
 	}
-	if request.Stock >= 0 {
-		updates["stock"] = request.Stock
+	// 库存仅在请求显式携带时修改，避免部分更新把库存置0并错误调整库存基线
+	if request.Stock != nil {
+		if *request.Stock < 0 {
+			return &product.UpdateProductResponse{
+				Code:    e.INVALID_PARAMS,
+				Message: e.GetMsg(e.INVALID_PARAMS),
+			}, nil
+		}
+		updates["stock"] = *request.Stock
 	}
 	if request.ImageUrl != "" {
 		updates["image_url"] = request.ImageUrl
@@ -150,7 +162,7 @@ func (s *ProductService) UpdateProduct(ctx context.Context, request *product.Upd
 	}
 
 	// 更新商品
-	err = s.productDao.UpdateProduct(ctx, request.ProductId, updates)
+	err = s.productDao.UpdateProduct(ctx, request.ProductId, updates, dao.StockOp{Reason: model.StockReasonAdminEdit, Actor: request.Operator})
 	if err != nil {
 		// 数据库更新失败是系统错误
 		return &product.UpdateProductResponse{
@@ -208,6 +220,138 @@ func (s *ProductService) ListProducts(ctx context.Context, request *product.List
 	return s.buildListResponse(products, total, e.SUCCESS), nil
 }
 
+// ListActiveSeckillProducts 获取可秒杀商品列表（由进行中的秒杀活动驱动）
+// 同一商品有多场活动时每场活动各返回一条，价格/库存/时间取自活动
+func (s *ProductService) ListActiveSeckillProducts(ctx context.Context, request *product.ListProductsRequest) (*product.ListProductsResponse, error) {
+	page, pageSize := request.Page, request.PageSize
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	activities, total, err := s.activityDao.ListActiveActivities(ctx, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return &product.ListProductsResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+	}
+
+	now := time.Now()
+	productList := make([]*product.Product, 0, len(activities))
+	for _, act := range activities {
+		p, err := s.productDao.GetProductByID(ctx, act.ProductID)
+		if err != nil {
+			// 商品已删除的活动不展示
+			continue
+		}
+		item := &product.Product{
+			Id:               p.ID,
+			Name:             p.Name,
+			Description:      p.Description,
+			Price:            p.Price,
+			Stock:            act.Stock,
+			ImageUrl:         p.ImageURL,
+			SeckillStartTime: act.StartTime.Unix(),
+			SeckillEndTime:   act.EndTime.Unix(),
+			SecondsUntilEnd:  int64(act.EndTime.Sub(now).Seconds()),
+			CreatedAt:        p.CreatedAt.Unix(),
+			UpdatedAt:        p.UpdatedAt.Unix(),
+			ActivityId:       act.ID,
+			SeckillPrice:     act.SeckillPrice,
+		}
+		if stock, ok := s.activityDao.GetLiveStock(ctx, act.ID); ok {
+			item.Stock = stock
+		}
+		productList = append(productList, item)
+	}
+
+	return &product.ListProductsResponse{
+		Code:     e.SUCCESS,
+		Message:  e.GetMsg(e.SUCCESS),
+		Products: productList,
+		Total:    int32(total),
+	}, nil
+}
+
+// DeductStock 管理员扣减商品Redis库存（下架/盘亏），不受秒杀时间窗口与每人限购约束，
+// 库存基线在同一脚本内同步调整，并标记脏集合交由Reconciler回写MySQL
+func (s *ProductService) DeductStock(ctx context.Context, request *product.DeductStockRequest) (*product.DeductStockResponse, error) {
+	if request.ProductId <= 0 || request.Quantity <= 0 {
+		return &product.DeductStockResponse{Success: false, Message: e.GetMsg(e.INVALID_PARAMS)}, nil
+	}
+
+	op := dao.StockOp{Reason: model.StockReasonAdminDeduct, Actor: request.Operator}
+	if err := s.productDao.AdjustStock(ctx, request.ProductId, -request.Quantity, op); err != nil {
+		// 库存不足是业务错误，返回nil error
+		if errors.Is(err, dao.ErrStockNotEnough) {
+			return &product.DeductStockResponse{Success: false, Message: err.Error()}, nil
+		}
+		return &product.DeductStockResponse{Success: false, Message: err.Error()}, err
+	}
+
+	return &product.DeductStockResponse{Success: true, Message: e.GetMsg(e.SUCCESS)}, nil
+}
+
+// ReturnStock 管理员补货（Lua原子归还，并标记脏集合交由Reconciler回写MySQL）
+func (s *ProductService) ReturnStock(ctx context.Context, request *product.ReturnStockRequest) (*product.ReturnStockResponse, error) {
+	if request.ProductId <= 0 || request.Quantity <= 0 {
+		return &product.ReturnStockResponse{Success: false, Message: e.GetMsg(e.INVALID_PARAMS)}, nil
+	}
+
+	op := dao.StockOp{Reason: model.StockReasonAdminReturn, Actor: request.Operator}
+	// 管理员补货与库存基线在同一脚本内调整，供全量对账推算应有库存
+	if err := s.productDao.AdjustStock(ctx, request.ProductId, request.Quantity, op); err != nil {
+		return &product.ReturnStockResponse{Success: false, Message: err.Error()}, err
+	}
+
+	return &product.ReturnStockResponse{Success: true, Message: e.GetMsg(e.SUCCESS)}, nil
+}
+
+// ListStockLogs 分页查询商品（或其秒杀活动）的库存变更流水，按发生时间倒序
+func (s *ProductService) ListStockLogs(ctx context.Context, request *product.ListStockLogsRequest) (*product.ListStockLogsResponse, error) {
+	if request.ProductId <= 0 && request.ActivityId <= 0 {
+		return &product.ListStockLogsResponse{Code: e.INVALID_PARAMS, Message: e.GetMsg(e.INVALID_PARAMS)}, nil
+	}
+	page, pageSize := request.Page, request.PageSize
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	kind, targetID := model.StockKindProduct, request.ProductId
+	if request.ActivityId > 0 {
+		kind, targetID = model.StockKindActivity, request.ActivityId
+	}
+	logs, total, err := s.stockLogDao.ListStockLogs(ctx, kind, targetID, page, pageSize)
+	if err != nil {
+		return &product.ListStockLogsResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+	}
+
+	entries := make([]*product.StockLogEntry, 0, len(logs))
+	for _, l := range logs {
+		entries = append(entries, &product.StockLogEntry{
+			Id:         l.ID,
+			Kind:       l.Kind,
+			TargetId:   l.TargetID,
+			Delta:      l.Delta,
+			StockAfter: l.StockAfter,
+			Store:      l.Store,
+			Reason:     l.Reason,
+			Actor:      l.Actor,
+			Ref:        l.Ref,
+			OccurredAt: l.OccurredAt.UnixMilli(),
+		})
+	}
+	return &product.ListStockLogsResponse{
+		Code:    e.SUCCESS,
+		Message: e.GetMsg(e.SUCCESS),
+		Logs:    entries,
+		Total:   int32(total),
+	}, nil
+}
+
 // buildListResponse 构建列表响应
 func (s *ProductService) buildListResponse(products []*model.Product, total int64, code int) *product.ListProductsResponse {
 	var productList []*product.Product
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/internal/dao"
+	"github.com/CCDD2022/seckill-system/internal/model"
+	"github.com/CCDD2022/seckill-system/pkg/e"
+	"github.com/CCDD2022/seckill-system/proto_output/seckill"
+	"gorm.io/gorm"
+)
+
+// CreateActivity 创建秒杀活动（管理员操作）
+func (s *SeckillService) CreateActivity(ctx context.Context, req *seckill.CreateActivityRequest) (*seckill.CreateActivityResponse, error) {
+	if req.ProductId <= 0 || req.SeckillPrice <= 0 || req.TotalStock <= 0 ||
+		req.StartTime <= 0 || req.EndTime <= req.StartTime {
+		return &seckill.CreateActivityResponse{Code: e.INVALID_PARAMS, Message: e.GetMsg(e.INVALID_PARAMS)}, nil
+	}
+
+	// 检查商品是否存在
+	if _, err := s.productDao.GetProductByID(ctx, req.ProductId); err != nil {
+		return &seckill.CreateActivityResponse{
+			Code:    e.ERROR_PRODUCT_NOT_EXISTS,
+			Message: e.GetMsg(e.ERROR_PRODUCT_NOT_EXISTS),
+		}, nil
+	}
+
+	// 未指定限购时使用系统默认限购
+	perUserLimit := req.PerUserLimit
+	if perUserLimit <= 0 {
+		perUserLimit = s.limits.DefaultPerUserLimit
+	}
+	act := &model.SeckillActivity{
+		ProductID:    req.ProductId,
+		Name:         req.Name,
+		SeckillPrice: req.SeckillPrice,
+		TotalStock:   req.TotalStock,
+		PerUserLimit: perUserLimit,
+		StartTime:    time.Unix(req.StartTime, 0),
+		EndTime:      time.Unix(req.EndTime, 0),
+	}
+
+	id, err := s.activityDao.CreateActivity(ctx, act)
+	if err != nil {
+		return &seckill.CreateActivityResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+	}
+
+	return &seckill.CreateActivityResponse{
+		Code:       e.SUCCESS,
+		Message:    e.GetMsg(e.SUCCESS),
+		ActivityId: id,
+	}, nil
+}
+
+// UpdateActivity 更新秒杀活动（管理员操作）
+func (s *SeckillService) UpdateActivity(ctx context.Context, req *seckill.UpdateActivityRequest) (*seckill.UpdateActivityResponse, error) {
+	act, err := s.activityDao.GetActivityByID(ctx, req.ActivityId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &seckill.UpdateActivityResponse{
+				Code:    e.ERROR_ACTIVITY_NOT_EXISTS,
+				Message: e.GetMsg(e.ERROR_ACTIVITY_NOT_EXISTS),
+			}, nil
+		}
+		return &seckill.UpdateActivityResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+	}
+
+	// 构建更新字段
+	updates := make(map[string]interface{})
+	if req.Name != "" {
+		updates["name"] = req.Name
+	}
+	if req.SeckillPrice > 0 {
+		updates["seckill_price"] = req.SeckillPrice
+	}
+	if req.TotalStock > 0 {
+		updates["total_stock"] = req.TotalStock
+	}
+	if req.PerUserLimit > 0 {
+		updates["per_user_limit"] = req.PerUserLimit
+	}
+	startTime, endTime := act.StartTime, act.EndTime
+	if req.StartTime > 0 {
+		startTime = time.Unix(req.StartTime, 0)
+		updates["start_time"] = startTime
+	}
+	if req.EndTime > 0 {
+		endTime = time.Unix(req.EndTime, 0)
+		updates["end_time"] = endTime
+	}
+
+	// 没有需要更新的字段，或时间窗口非法
+	if len(updates) == 0 || !endTime.After(startTime) {
+		return &seckill.UpdateActivityResponse{Code: e.INVALID_PARAMS, Message: e.GetMsg(e.INVALID_PARAMS)}, nil
+	}
+
+	op := dao.StockOp{Reason: model.StockReasonAdminEdit, Actor: req.Operator}
+	if err := s.activityDao.UpdateActivity(ctx, req.ActivityId, updates, op); err != nil {
+		// 新的分配量低于已售出/已预占数量
+		if errors.Is(err, dao.ErrStockNotEnough) {
+			return &seckill.UpdateActivityResponse{Code: e.ERROR_STOCK_NOT_ENOUGH, Message: e.GetMsg(e.ERROR_STOCK_NOT_ENOUGH)}, nil
+		}
+		return &seckill.UpdateActivityResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+	}
+
+	return &seckill.UpdateActivityResponse{Code: e.SUCCESS, Message: e.GetMsg(e.SUCCESS)}, nil
+}
+
+// DeleteActivity 删除秒杀活动（管理员操作）
+func (s *SeckillService) DeleteActivity(ctx context.Context, req *seckill.DeleteActivityRequest) (*seckill.DeleteActivityResponse, error) {
+	if _, err := s.activityDao.GetActivityByID(ctx, req.ActivityId); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &seckill.DeleteActivityResponse{
+				Code:    e.ERROR_ACTIVITY_NOT_EXISTS,
+				Message: e.GetMsg(e.ERROR_ACTIVITY_NOT_EXISTS),
+			}, nil
+		}
+		return &seckill.DeleteActivityResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+	}
+
+	if err := s.activityDao.DeleteActivity(ctx, req.ActivityId); err != nil {
+		return &seckill.DeleteActivityResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+	}
+
+	return &seckill.DeleteActivityResponse{Code: e.SUCCESS, Message: e.GetMsg(e.SUCCESS)}, nil
+}
+
+// GetActivity 获取秒杀活动详情（剩余库存优先取Redis实时值）
+func (s *SeckillService) GetActivity(ctx context.Context, req *seckill.GetActivityRequest) (*seckill.GetActivityResponse, error) {
+	act, err := s.activityDao.GetActivityByID(ctx, req.ActivityId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &seckill.GetActivityResponse{
+				Code:    e.ERROR_ACTIVITY_NOT_EXISTS,
+				Message: e.GetMsg(e.ERROR_ACTIVITY_NOT_EXISTS),
+			}, nil
+		}
+		return &seckill.GetActivityResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+	}
+
+	item := buildActivityProto(act)
+	if stock, ok := s.activityDao.GetLiveStock(ctx, act.ID); ok {
+		item.Stock = stock
+	}
+
+	return &seckill.GetActivityResponse{
+		Code:     e.SUCCESS,
+		Message:  e.GetMsg(e.SUCCESS),
+		Activity: item,
+	}, nil
+}
+
+// ListActivities 分页查询秒杀活动
+func (s *SeckillService) ListActivities(ctx context.Context, req *seckill.ListActivitiesRequest) (*seckill.ListActivitiesResponse, error) {
+	page, pageSize := req.Page, req.PageSize
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	activities, total, err := s.activityDao.ListActivities(ctx, req.ProductId, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return &seckill.ListActivitiesResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+	}
+
+	list := make([]*seckill.SeckillActivity, 0, len(activities))
+	for _, act := range activities {
+		list = append(list, buildActivityProto(act))
+	}
+
+	return &seckill.ListActivitiesResponse{
+		Code:       e.SUCCESS,
+		Message:    e.GetMsg(e.SUCCESS),
+		Activities: list,
+		Total:      int32(total),
+	}, nil
+}
+
+// buildActivityProto 模型转换为protobuf消息
+func buildActivityProto(act *model.SeckillActivity) *seckill.SeckillActivity {
+	return &seckill.SeckillActivity{
+		Id:           act.ID,
+		ProductId:    act.ProductID,
+		Name:         act.Name,
+		SeckillPrice: act.SeckillPrice,
+		TotalStock:   act.TotalStock,
+		Stock:        act.Stock,
+		PerUserLimit: act.PerUserLimit,
+		StartTime:    act.StartTime.Unix(),
+		EndTime:      act.EndTime.Unix(),
+		CreatedAt:    act.CreatedAt.Unix(),
+		UpdatedAt:    act.UpdatedAt.Unix(),
+	}
+}
@@ -3,101 +3,240 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/CCDD2022/seckill-system/config"
 	"github.com/CCDD2022/seckill-system/internal/dao"
+	"github.com/CCDD2022/seckill-system/internal/model"
 	"github.com/CCDD2022/seckill-system/internal/mq"
+	"github.com/CCDD2022/seckill-system/pkg/e"
+	"github.com/CCDD2022/seckill-system/pkg/idgen"
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
 	"github.com/CCDD2022/seckill-system/proto_output/seckill"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
 )
 
 type SeckillService struct {
-	productDao *dao.ProductDao
-	redisDB    redis.UniversalClient
-	mqPool     *mq.Pool
+	productDao  *dao.ProductDao
+	activityDao *dao.SeckillActivityDao
+	resultDao   *dao.SeckillResultDao
+	redisDB     redis.UniversalClient
+	mqPool      *mq.Pool
+	spill       *mq.SpillLog // 本地溢写日志，未启用时为nil
+	idGen       *idgen.Generator
+	limits      config.SeckillConfig
 	seckill.UnimplementedSeckillServiceServer
 }
 
-func NewSeckillService(productDao *dao.ProductDao, redisDB redis.UniversalClient, mqPool *mq.Pool) *SeckillService {
+func NewSeckillService(productDao *dao.ProductDao, activityDao *dao.SeckillActivityDao, resultDao *dao.SeckillResultDao, redisDB redis.UniversalClient, mqPool *mq.Pool, spill *mq.SpillLog, idGen *idgen.Generator, limits config.SeckillConfig) *SeckillService {
 	return &SeckillService{
-		productDao: productDao,
-		redisDB:    redisDB,
-		mqPool:     mqPool,
+		productDao:  productDao,
+		activityDao: activityDao,
+		resultDao:   resultDao,
+		redisDB:     redisDB,
+		mqPool:      mqPool,
+		spill:       spill,
+		idGen:       idGen,
+		limits:      limits,
 	}
 }
 
 // SeckillMessage 发送到rabbitMQ的秒杀消息结构体
 type SeckillMessage struct {
+	OrderID    int64   `json:"order_id"` // 预分配的订单ID，消费者按此ID落库
 	UserID     int64   `json:"user_id"`
 	ProductID  int64   `json:"product_id"`
+	ActivityID int64   `json:"activity_id"` // 秒杀活动ID，兼容旧版商品秒杀时为0
 	Quantity   int32   `json:"quantity"`
 	TotalPrice float64 `json:"total_price"`
 }
 
-// StockLogMessage 库存变更日志消息（审计/可选）
-type StockLogMessage struct {
-	ProductID int64  `json:"product_id"`
-	Delta     int32  `json:"delta"`
-	Reason    string `json:"reason"`
-	TimeUnix  int64  `json:"time_unix"`
+// seckillTarget 一次秒杀请求解析后的目标：秒杀活动，或（兼容旧版的）商品
+type seckillTarget struct {
+	productID    int64
+	activityID   int64
+	perUserLimit int32   // 每人累计限购数量
+	unitPrice    float64 // 活动秒杀价；商品模式下为0，扣减后再查询商品价格
 }
 
 const mqExchange = "seckill.exchange"
 
-// ExecuteSeckill 执行秒杀
+// failureCallbackTimeout 发布失败回调（溢写/标记失败）的超时
+const failureCallbackTimeout = 3 * time.Second
+
+var errSpillDisabled = errors.New("spill log disabled")
+
+// resolveTarget 解析秒杀目标：优先按活动，未指定活动时按商品
+// 返回非nil响应表示业务校验未通过
+func (s *SeckillService) resolveTarget(ctx context.Context, req *seckill.SeckillRequest) (*seckillTarget, *seckill.SeckillResponse, error) {
+	if req.Quantity <= 0 {
+		return nil, &seckill.SeckillResponse{Success: false, Code: e.INVALID_PARAMS, Message: e.GetMsg(e.INVALID_PARAMS)}, nil
+	}
+	if req.Quantity > s.limits.MaxQuantityPerRequest {
+		return nil, &seckill.SeckillResponse{Success: false, Code: e.ERROR_EXCEED_LIMIT, Message: fmt.Sprintf("单次最多购买%d件", s.limits.MaxQuantityPerRequest)}, nil
+	}
+
+	if req.ActivityId <= 0 {
+		if req.ProductId <= 0 {
+			return nil, &seckill.SeckillResponse{Success: false, Code: e.INVALID_PARAMS, Message: e.GetMsg(e.INVALID_PARAMS)}, nil
+		}
+		return &seckillTarget{
+			productID:    req.ProductId,
+			perUserLimit: s.limits.DefaultPerUserLimit,
+		}, nil, nil
+	}
+
+	actx, acancel := context.WithTimeout(ctx, 120*time.Millisecond)
+	defer acancel()
+	act, err := s.activityDao.GetActivityByID(actx, req.ActivityId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &seckill.SeckillResponse{Success: false, Code: e.ERROR_ACTIVITY_NOT_EXISTS, Message: e.GetMsg(e.ERROR_ACTIVITY_NOT_EXISTS)}, nil
+		}
+		return nil, &seckill.SeckillResponse{Success: false, Code: e.ERROR, Message: "系统繁忙，请稍后再试"}, err
+	}
+	// 活动未单独配置限购时使用系统默认值
+	perUserLimit := act.PerUserLimit
+	if perUserLimit <= 0 {
+		perUserLimit = s.limits.DefaultPerUserLimit
+	}
+	return &seckillTarget{
+		productID:    act.ProductID,
+		activityID:   act.ID,
+		perUserLimit: perUserLimit,
+		unitPrice:    act.SeckillPrice,
+	}, nil, nil
+}
+
+// reserveStock 按目标预占活动库存或商品库存（单脚本完成时间窗口、限购、扣减与预占记录）
+func (s *SeckillService) reserveStock(ctx context.Context, t *seckillTarget, r *model.SeckillReservation) error {
+	if t.activityID > 0 {
+		return s.activityDao.ReserveStock(ctx, r, t.perUserLimit)
+	}
+	return s.productDao.ReserveStock(ctx, r, t.perUserLimit)
+}
+
+// compensateOp 消息投递失败时补偿预占，记入库存日志
+var compensateOp = dao.StockOp{Reason: model.StockReasonReservationRelease, Actor: model.SystemActor("seckill_service")}
+
+// releaseReservation 按目标补偿预占（归还库存与限购额度，删除预占记录）
+func (s *SeckillService) releaseReservation(ctx context.Context, t *seckillTarget, ticket string) error {
+	if t.activityID > 0 {
+		return s.activityDao.ReleaseReservation(ctx, t.activityID, ticket, compensateOp)
+	}
+	return s.productDao.ReleaseReservation(ctx, t.productID, ticket, compensateOp)
+}
+
+// ExecuteSeckill 执行秒杀，并按结果计数
 func (s *SeckillService) ExecuteSeckill(ctx context.Context, req *seckill.SeckillRequest) (*seckill.SeckillResponse, error) {
-	productID := req.ProductId
+	resp, err := s.executeSeckill(ctx, req)
+	outcome := seckillOutcome(resp, err)
+	metrics.SeckillOutcomes.WithLabelValues(outcome).Inc()
+	// 记录到 gRPC 服务端 span，按结果检索链路（如只看库存不足或系统错误的请求）
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("seckill.outcome", outcome))
+	if resp != nil && resp.Ticket != "" {
+		span.SetAttributes(attribute.String("seckill.ticket", resp.Ticket))
+	}
+	return resp, err
+}
+
+// seckillOutcome 秒杀结果分类
+func seckillOutcome(resp *seckill.SeckillResponse, err error) string {
+	if err != nil || resp == nil {
+		return metrics.OutcomeSystemError
+	}
+	if resp.Success {
+		return metrics.OutcomeSuccess
+	}
+	switch resp.Code {
+	case e.ERROR_STOCK_NOT_ENOUGH:
+		return metrics.OutcomeSoldOut
+	case e.ERROR_EXCEED_LIMIT:
+		return metrics.OutcomeLimitExceeded
+	case e.ERROR_SECKILL_NOT_STARTED, e.ERROR_SECKILL_ENDED:
+		return metrics.OutcomeInactive
+	case e.INVALID_PARAMS, e.ERROR_ACTIVITY_NOT_EXISTS:
+		return metrics.OutcomeInvalid
+	default:
+		return metrics.OutcomeSystemError
+	}
+}
+
+func (s *SeckillService) executeSeckill(ctx context.Context, req *seckill.SeckillRequest) (*seckill.SeckillResponse, error) {
 	userID := req.UserId
 	quantity := req.Quantity
 
-	// 1. 使用参与集合去重，占用内存小
-	joinKey := fmt.Sprintf("seckill:joined:product:%d", productID)
-	jctx, jcancel := context.WithTimeout(ctx, 80*time.Millisecond)
-	defer jcancel()
-	added, err := s.redisDB.SAdd(jctx, joinKey, userID).Result()
-	s.redisDB.Expire(jctx, joinKey, 24*time.Hour)
-	if err != nil {
-		return &seckill.SeckillResponse{Success: false, Message: "系统繁忙，请稍后再试"}, err
+	target, failResp, err := s.resolveTarget(ctx, req)
+	if failResp != nil {
+		return failResp, err
 	}
-	if added == 0 {
-		return &seckill.SeckillResponse{Success: false, Message: "您已参与过该商品的秒杀，请勿重复下单"}, nil
+	productID := target.productID
+
+	// 预分配订单ID，用户无需等待异步落库即可拿到订单号
+	orderID, err := s.idGen.NextID()
+	if err != nil {
+		logger.Error("生成订单ID失败", "err", err)
+		return &seckill.SeckillResponse{Success: false, Code: e.ERROR, Message: "系统繁忙，请稍后再试"}, err
 	}
 
-	// 仅在需要允许重试的失败场景下移除参与标记
-	removeJoinMark := func() {
-		c, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
-		defer cancel()
-		_ = s.redisDB.SRem(c, joinKey, userID).Err()
+	// 生成 MessageId（用于消费者 Redis 幂等 SetNX），同时作为返回给用户的秒杀凭证(ticket)与预占记录键
+	// 尽量包含业务语义前缀，便于排查
+	now := time.Now()
+	msgID := fmt.Sprintf("create:%d:%d:%d", userID, productID, now.UnixNano())
+
+	// 1. 预占库存（统一走DAO的Lua脚本，保证键名一致与行为一致）
+	// 时间窗口、每人限购、库存扣减与预占记录在同一脚本内完成，进程中途退出也不会留下半截状态
+	// 预占到期仍未生成订单（消息丢失/进入死信）时，由 reservation_sweeper 归还库存与限购额度
+	reservation := &model.SeckillReservation{
+		Ticket:     msgID,
+		UserID:     userID,
+		ProductID:  productID,
+		ActivityID: target.activityID,
+		Quantity:   quantity,
+		CreatedAt:  now.Unix(),
+		ExpireAt:   now.Add(time.Duration(s.limits.ReservationTTLSeconds) * time.Second).Unix(),
+	}
+	if err := s.reserveStock(ctx, target, reservation); err != nil {
+		return &seckill.SeckillResponse{Success: false, Code: deductErrCode(err), Message: err.Error()}, nil
 	}
 
-	// 2. 预扣减库存（统一走DAO的Lua脚本，保证键名一致与行为一致）
-	if err := s.productDao.DeductStock(ctx, productID, quantity); err != nil {
-		// 库存失败，移除参与标记，允许用户重试
-		removeJoinMark()
-		return &seckill.SeckillResponse{Success: false, Message: err.Error()}, nil
+	// 后续步骤失败时按预占记录补偿（归还库存与限购额度），允许用户重试
+	rollback := func() {
+		if err := s.releaseReservation(context.Background(), target, msgID); err != nil {
+			logger.Error("预占补偿失败", "ticket", msgID, "err", err)
+		}
 	}
 
-	// 3. 获取商品信息计算总价
-	pctx, pcancel := context.WithTimeout(ctx, 120*time.Millisecond)
-	price, err := s.productDao.GetProductPrice(pctx, productID)
-	pcancel()
-	if err != nil {
-		// 回滚库存（DAO归还保证一致键名与逻辑）
-		_ = s.productDao.ReturnStock(context.Background(), productID, quantity)
-		// 获取价格失败，移除参与标记，允许重试
-		removeJoinMark()
-		return &seckill.SeckillResponse{
-			Success: false,
-			Message: "获取商品信息失败",
-		}, err
+	// 2. 计算总价：活动使用秒杀价，商品模式查询商品价格
+	price := target.unitPrice
+	if target.activityID == 0 {
+		pctx, pcancel := context.WithTimeout(ctx, 120*time.Millisecond)
+		price, err = s.productDao.GetProductPrice(pctx, productID)
+		pcancel()
+		if err != nil {
+			// 回滚库存（DAO归还保证一致键名与逻辑）
+			rollback()
+			return &seckill.SeckillResponse{
+				Success: false,
+				Message: "获取商品信息失败",
+			}, err
+		}
 	}
 	totalPrice := price * float64(quantity)
 
-	// 4. 发送消息到队列进行异步订单创建
+	// 3. 发送消息到队列进行异步订单创建
 	msg := SeckillMessage{
+		OrderID:    orderID,
 		UserID:     userID,
 		ProductID:  productID,
+		ActivityID: target.activityID,
 		Quantity:   quantity,
 		TotalPrice: totalPrice,
 	}
@@ -105,31 +244,126 @@ func (s *SeckillService) ExecuteSeckill(ctx context.Context, req *seckill.Seckil
 	msgBody, err := json.Marshal(msg)
 	if err != nil {
 		// 回滚库存
-		_ = s.productDao.ReturnStock(context.Background(), productID, quantity)
-		// 允许重试
-		removeJoinMark()
+		rollback()
 		return &seckill.SeckillResponse{
 			Success: false,
 			Message: "创建订单消息失败",
 		}, err
 	}
 
-	// 生成 MessageId（用于消费者 Redis 幂等 SetNX）
-	// 尽量包含业务语义前缀，便于排查
-	msgID := fmt.Sprintf("create:%d:%d:%d", userID, productID, time.Now().UnixNano())
+	// 先登记处理中状态，再投递消息，避免消费者写入的结果被覆盖
+	rctx, rcancel := context.WithTimeout(ctx, 80*time.Millisecond)
+	err = s.resultDao.MarkPending(rctx, msgID, userID, productID)
+	rcancel()
+	if err != nil {
+		rollback()
+		return &seckill.SeckillResponse{Success: false, Message: "系统繁忙，请稍后再试"}, err
+	}
+
+	// Broker Nack 或消息不可路由被退回时补偿预占并标记失败
+	// 消费者已认领的预占不会被释放，订单照常生成
+	// 通道断开未收到确认时消息可能未入队，优先写入溢写日志由重放补发（消费端按 MessageId 幂等）
+	// 回调在请求返回后异步执行，此时请求 ctx 已取消：只沿用其链路，另设超时
+	spanCtx := trace.SpanContextFromContext(ctx)
+	onFail := func(ticket string, perr error) {
+		fctx, cancel := context.WithTimeout(trace.ContextWithSpanContext(context.Background(), spanCtx), failureCallbackTimeout)
+		defer cancel()
+		if mq.IsUnavailable(perr) && s.spillOrder(fctx, ticket, msgBody) == nil {
+			return
+		}
+		rollback()
+		_ = s.resultDao.MarkFailed(fctx, ticket, "订单消息投递失败")
+	}
 
-	// 发布创建订单事件（异步Confirm，提高吞吐），携带 MessageId
-	if err := s.mqPool.PublishAsyncWithID(mqExchange, "order.create", msgBody, msgID); err != nil {
-		_ = s.productDao.ReturnStock(context.Background(), productID, quantity)
+	// 发布创建订单事件，携带 MessageId；按配置同步等待确认或异步回调
+	if err := s.mqPool.PublishWithConfirm(ctx, mqExchange, "order.create", msgBody, msgID, onFail); err != nil {
+		// Broker 不可用：写入本地溢写日志，恢复后按原 MessageId 重放，预占保持不变
+		// 积压超过预占有效期的消息重放后会因预占已释放而下单失败，不会超卖
+		if mq.IsUnavailable(err) && s.spillOrder(ctx, msgID, msgBody) == nil {
+			return &seckill.SeckillResponse{
+				Success: true,
+				Message: "秒杀成功，订单处理中",
+				OrderId: orderID,
+				Ticket:  msgID,
+			}, nil
+		}
 		// 发布失败，允许重试
-		removeJoinMark()
+		rollback()
+		_ = s.resultDao.MarkFailed(context.Background(), msgID, "订单消息投递失败")
 		return &seckill.SeckillResponse{Success: false, Message: "秒杀失败，请重试"}, err
 	}
 
-	// 不再等待确认，改为异步处理（提高吞吐）
+	// 不再等待确认，改为异步处理（提高吞吐），客户端凭ticket轮询下单结果
 	return &seckill.SeckillResponse{
 		Success: true,
 		Message: "秒杀成功，订单处理中",
-		OrderId: 0, // 订单ID将在异步处理后生成
+		OrderId: orderID, // 预分配的订单号，订单异步落库，落库结果凭ticket查询
+		Ticket:  msgID,
+	}, nil
+}
+
+// spillOrder 把订单消息写入本地溢写日志（记录 ctx 中的链路），未启用或写入失败时返回错误
+func (s *SeckillService) spillOrder(ctx context.Context, msgID string, body []byte) error {
+	if s.spill == nil {
+		return errSpillDisabled
+	}
+	err := s.spill.Append(ctx, &mq.SpillEntry{
+		MessageID:  msgID,
+		Exchange:   mqExchange,
+		RoutingKey: "order.create",
+		Body:       body,
+		SpilledAt:  time.Now().Unix(),
+	})
+	if err != nil {
+		logger.Error("订单消息溢写失败", "message_id", msgID, "err", err)
+		return err
+	}
+	logger.Warn("MQ不可用，订单消息已写入本地溢写日志", "message_id", msgID, "spill_depth", s.spill.Depth())
+	return nil
+}
+
+// deductErrCode 将库存扣减错误映射为业务错误码
+func deductErrCode(err error) int32 {
+	switch {
+	case errors.Is(err, dao.ErrStockNotEnough):
+		return e.ERROR_STOCK_NOT_ENOUGH
+	case errors.Is(err, dao.ErrSeckillNotStarted):
+		return e.ERROR_SECKILL_NOT_STARTED
+	case errors.Is(err, dao.ErrSeckillEnded):
+		return e.ERROR_SECKILL_ENDED
+	case errors.Is(err, dao.ErrExceedPurchaseLimit):
+		return e.ERROR_EXCEED_LIMIT
+	default:
+		return e.ERROR
+	}
+}
+
+// QuerySeckillResult 根据秒杀凭证查询异步下单结果
+func (s *SeckillService) QuerySeckillResult(ctx context.Context, req *seckill.QuerySeckillResultRequest) (*seckill.QuerySeckillResultResponse, error) {
+	if req.Ticket == "" {
+		return &seckill.QuerySeckillResultResponse{Code: e.INVALID_PARAMS, Message: e.GetMsg(e.INVALID_PARAMS)}, nil
+	}
+
+	res, err := s.resultDao.GetResult(ctx, req.Ticket)
+	if err != nil {
+		if errors.Is(err, dao.ErrSeckillResultNotFound) {
+			return &seckill.QuerySeckillResultResponse{Code: e.ERROR_NOT_EXIST, Message: err.Error()}, nil
+		}
+		logger.Error("查询秒杀结果失败", "ticket", req.Ticket, "err", err)
+		return &seckill.QuerySeckillResultResponse{Code: e.ERROR, Message: e.GetMsg(e.ERROR)}, err
+	}
+
+	// 凭证只允许本人查询，不暴露他人是否存在该凭证
+	if res.UserID != req.UserId {
+		return &seckill.QuerySeckillResultResponse{Code: e.ERROR_NOT_EXIST, Message: dao.ErrSeckillResultNotFound.Error()}, nil
+	}
+
+	return &seckill.QuerySeckillResultResponse{
+		Code:    e.SUCCESS,
+		Message: e.GetMsg(e.SUCCESS),
+		Ticket:  res.Ticket,
+		Status:  res.Status,
+		OrderId: res.OrderID,
+		Reason:  res.Reason,
 	}, nil
 }
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	healthInterval     = 5 * time.Second
+	healthCheckTimeout = 2 * time.Second
+)
+
+// Health gRPC 标准健康检查（grpc.health.v1）：定期检查各依赖（MySQL、Redis、MQ 等）
+//   - 整体（service 为空）与服务名：全部依赖正常时为 SERVING，任一失败为 NOT_SERVING
+//   - 依赖名（如 "redis"）：该依赖自身的状态，调用方据此给出不可用原因
+//
+// 收到退出信号后全部置为 NOT_SERVING，调用方在 GracefulStop 前即停止转发新请求
+type Health struct {
+	srv     *health.Server
+	service string
+
+	mu     sync.Mutex
+	checks []dependencyCheck
+	failed map[string]bool // 依赖名 -> 上次检查是否失败，只在状态变化时记录日志
+}
+
+type dependencyCheck struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// NewHealth 在 gRPC 服务器上注册健康检查服务，首轮检查完成前为 NOT_SERVING
+func NewHealth(grpcServer *grpc.Server, service string) *Health {
+	h := &Health{srv: health.NewServer(), service: service, failed: make(map[string]bool)}
+	h.srv.SetServingStatus("", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	h.srv.SetServingStatus(service, grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	grpc_health_v1.RegisterHealthServer(grpcServer, h.srv)
+	return h
+}
+
+// AddCheck 添加依赖检查，需在 Run 之前调用
+func (h *Health) AddCheck(name string, fn func(ctx context.Context) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, dependencyCheck{name: name, fn: fn})
+}
+
+// Run 立即检查一轮，之后每 healthInterval 检查一次，直到 ctx 结束
+func (h *Health) Run(ctx context.Context) {
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+	for {
+		h.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			h.srv.Shutdown()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkAll 并发执行全部依赖检查并更新状态
+func (h *Health) checkAll(ctx context.Context) {
+	h.mu.Lock()
+	checks := h.checks
+	h.mu.Unlock()
+
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c dependencyCheck) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			errs[i] = c.fn(cctx)
+		}(i, c)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	overall := grpc_health_v1.HealthCheckResponse_SERVING
+	for i, c := range checks {
+		status := grpc_health_v1.HealthCheckResponse_SERVING
+		if errs[i] != nil {
+			status = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+			overall = status
+		}
+		h.srv.SetServingStatus(c.name, status)
+		h.logChange(c.name, errs[i])
+	}
+	h.srv.SetServingStatus("", overall)
+	h.srv.SetServingStatus(h.service, overall)
+}
+
+func (h *Health) logChange(name string, err error) {
+	h.mu.Lock()
+	was := h.failed[name]
+	h.failed[name] = err != nil
+	h.mu.Unlock()
+	switch {
+	case err != nil && !was:
+		logger.Error("依赖检查失败", "service", h.service, "dependency", name, "err", err)
+	case err == nil && was:
+		logger.Info("依赖已恢复", "service", h.service, "dependency", name)
+	}
+}
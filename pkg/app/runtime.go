@@ -0,0 +1,198 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/config"
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/CCDD2022/seckill-system/pkg/metrics"
+	"github.com/CCDD2022/seckill-system/pkg/tracing"
+	"google.golang.org/grpc"
+)
+
+// Runtime 进程生命周期：收到 SIGINT/SIGTERM（或服务启动失败）后分两个阶段退出
+//  1. 停止阶段：按注册的逆序停止接收新工作并等待处理中的工作完成（gRPC GracefulStop、HTTP Shutdown、消费者取消订阅并确认完已到达的消息、后台循环退出）
+//  2. 关闭阶段：按注册顺序释放资源（Redis、MySQL、MQ 等）
+//
+// 两个阶段共用 server.shutdown_timeout_seconds 的期限，到期后剩余步骤强制执行
+type Runtime struct {
+	ctx     context.Context // 收到退出信号后取消
+	cancel  context.CancelFunc
+	timeout time.Duration
+
+	mu       sync.Mutex
+	stoppers []hook
+	closers  []hook
+	failed   bool
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// NewRuntime 开始监听退出信号
+func NewRuntime(cfg *config.Config) *Runtime {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	return &Runtime{
+		ctx:     ctx,
+		cancel:  cancel,
+		timeout: time.Duration(cfg.Server.ShutdownTimeoutSeconds) * time.Second,
+	}
+}
+
+// Context 收到退出信号后取消，后台循环据此退出
+func (r *Runtime) Context() context.Context {
+	return r.ctx
+}
+
+// OnStop 注册停止步骤：停止接收新工作并等待处理中的工作完成，退出时按注册的逆序执行
+func (r *Runtime) OnStop(name string, fn func(ctx context.Context) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stoppers = append(r.stoppers, hook{name: name, fn: fn})
+}
+
+// OnClose 注册资源释放步骤，停止阶段完成后按注册顺序执行
+func (r *Runtime) OnClose(name string, fn func(ctx context.Context) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closers = append(r.closers, hook{name: name, fn: fn})
+}
+
+// Go 启动后台循环，fn 应在 ctx 取消后尽快返回；停止阶段等待其返回
+func (r *Runtime) Go(name string, fn func(ctx context.Context)) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(r.ctx)
+	}()
+	r.OnStop(name, func(ctx context.Context) error {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// ServeGRPC 启动 gRPC 服务；退出时 GracefulStop 等待处理中的 RPC 完成，到期后强制 Stop
+func (r *Runtime) ServeGRPC(name string, srv *grpc.Server, lis net.Listener) {
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			r.fail(name, err)
+		}
+	}()
+	r.OnStop(name, func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			srv.Stop()
+			return ctx.Err()
+		}
+	})
+}
+
+// ServeHTTP 启动 HTTP 服务；退出时 Shutdown 等待处理中的请求完成，到期后强制关闭连接
+func (r *Runtime) ServeHTTP(name string, srv *http.Server) {
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			r.fail(name, err)
+		}
+	}()
+	r.OnStop(name, func(ctx context.Context) error {
+		if err := srv.Shutdown(ctx); err != nil {
+			_ = srv.Close()
+			return err
+		}
+		return nil
+	})
+}
+
+// ServeMetrics 在 addr 上暴露 /metrics（Prometheus），addr 为空时不监听
+// 监听失败只记录日志，不影响业务
+func (r *Runtime) ServeMetrics(addr string) {
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("指标监听失败", "addr", addr, "err", err)
+		}
+	}()
+	r.OnStop("metrics", srv.Shutdown)
+	logger.Info("Metrics listening", "addr", addr)
+}
+
+// InitTracing 按 tracing 配置初始化链路追踪，service 为进程名；关闭阶段导出剩余 span
+// 初始化失败只记录日志，不影响业务
+func (r *Runtime) InitTracing(cfg config.TracingConfig, service string) {
+	shutdown, err := tracing.Init(cfg, service)
+	if err != nil {
+		logger.Error("链路追踪初始化失败", "exporter", cfg.Exporter, "err", err)
+		return
+	}
+	r.OnClose("tracing", shutdown)
+}
+
+// fail 服务异常退出（如端口被占用），触发整个进程退出
+func (r *Runtime) fail(name string, err error) {
+	logger.Error("服务异常退出", "name", name, "err", err)
+	r.mu.Lock()
+	r.failed = true
+	r.mu.Unlock()
+	r.cancel()
+}
+
+// Wait 阻塞到收到退出信号，依次执行停止与关闭步骤；服务异常退出时以非0状态码结束进程
+func (r *Runtime) Wait() {
+	<-r.ctx.Done()
+	// 恢复默认信号处理：再次收到信号时立即退出
+	r.cancel()
+	logger.Info("开始优雅退出", "timeout", r.timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	r.mu.Lock()
+	stoppers, closers, failed := r.stoppers, r.closers, r.failed
+	r.mu.Unlock()
+
+	for i := len(stoppers) - 1; i >= 0; i-- {
+		r.run(ctx, stoppers[i])
+	}
+	for _, h := range closers {
+		r.run(ctx, h)
+	}
+	logger.Info("已退出")
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func (r *Runtime) run(ctx context.Context, h hook) {
+	start := time.Now()
+	if err := h.fn(ctx); err != nil {
+		logger.Warn("退出步骤未正常完成", "step", h.name, "elapsed", time.Since(start), "err", err)
+		return
+	}
+	logger.Info("退出步骤完成", "step", h.name, "elapsed", time.Since(start))
+}
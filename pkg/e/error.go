@@ -15,8 +15,12 @@ const (
 	ERROR_USER_NOT_EXISTS = 20002
 	ERROR_PASSWORD        = 20003
 
-	ERROR_PRODUCT_NOT_EXISTS = 30001
-	ERROR_STOCK_NOT_ENOUGH   = 30002
+	ERROR_PRODUCT_NOT_EXISTS  = 30001
+	ERROR_STOCK_NOT_ENOUGH    = 30002
+	ERROR_SECKILL_NOT_STARTED = 30003
+	ERROR_SECKILL_ENDED       = 30004
+	ERROR_ACTIVITY_NOT_EXISTS = 30005
+	ERROR_EXCEED_LIMIT        = 30006
 
 	ERROR_NOT_EXIST = 40001
 
@@ -37,8 +41,12 @@ var msgFlags = map[int]string{
 	ERROR_USER_NOT_EXISTS: "用户不存在",
 	ERROR_PASSWORD:        "密码错误",
 
-	ERROR_PRODUCT_NOT_EXISTS: "商品不存在",
-	ERROR_STOCK_NOT_ENOUGH:   "库存不足",
+	ERROR_PRODUCT_NOT_EXISTS:  "商品不存在",
+	ERROR_STOCK_NOT_ENOUGH:    "库存不足",
+	ERROR_SECKILL_NOT_STARTED: "秒杀尚未开始",
+	ERROR_SECKILL_ENDED:       "秒杀已结束",
+	ERROR_ACTIVITY_NOT_EXISTS: "秒杀活动不存在",
+	ERROR_EXCEED_LIMIT:        "超过限购数量",
 
 	ERROR_NOT_EXIST:            "资源不存在",
 	ERROR_ORDER_STATUS_CHANGED: "订单状态已变更",
@@ -0,0 +1,27 @@
+package idgen
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// NewFromConfig 按配置创建生成器：static 使用配置的 worker_id，lease（默认）通过 Redis 租用
+func NewFromConfig(cfg *config.IDGenConfig, rdb redis.UniversalClient) (*Generator, error) {
+	if cfg.Mode == "static" {
+		return NewGenerator(int64(cfg.WorkerID))
+	}
+	if rdb == nil {
+		return nil, errors.New("idgen: lease mode requires redis")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lease, err := AcquireWorkerLease(ctx, rdb, time.Duration(cfg.LeaseTTLSeconds)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return NewLeasedGenerator(lease), nil
+}
@@ -0,0 +1,217 @@
+package idgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// workerKeyTemplate workerID 租约键，值为持有者标识
+	workerKeyTemplate = "idgen:worker:%d"
+	// lastIssuedKeyTemplate 上一个持有者释放租约时最后生成ID的毫秒时间戳（自 Epoch），保留 ttl
+	lastIssuedKeyTemplate = "idgen:worker:%d:last"
+)
+
+// ErrNoWorkerID 所有 workerID 均被占用
+var ErrNoWorkerID = errors.New("idgen: no free worker id")
+
+// renewLeaseScript 仅持有者可续期
+// KEYS[1]=租约键 ARGV[1]=持有者标识 ARGV[2]=有效期毫秒
+var renewLeaseScript = redis.NewScript(`
+    if redis.call('get', KEYS[1]) == ARGV[1] then
+        return redis.call('pexpire', KEYS[1], ARGV[2])
+    end
+    return 0
+`)
+
+// releaseLeaseScript 仅持有者可释放：记录最后生成ID的时间戳后删除租约键
+// KEYS[1]=租约键 KEYS[2]=最后时间戳键 ARGV[1]=持有者标识 ARGV[2]=最后生成ID的毫秒时间戳 ARGV[3]=保留毫秒
+var releaseLeaseScript = redis.NewScript(`
+    if redis.call('get', KEYS[1]) ~= ARGV[1] then
+        return 0
+    end
+    if tonumber(ARGV[2]) > 0 then
+        redis.call('set', KEYS[2], ARGV[2], 'PX', ARGV[3])
+    end
+    return redis.call('del', KEYS[1])
+`)
+
+// WorkerLease 通过 Redis 租用的 workerID，后台定期续期
+// 关闭时删除租约键，workerID 可立即被其他实例复用；同时留下本实例最后生成ID的时间戳，
+// 新持有者从该时间戳之后开始生成，即便新实例的时钟比旧实例慢也不会生成重复ID（时钟差超出回拨容忍时拒绝生成）
+// 租约被他人占用（如 Redis 长时间不可用导致过期）后在后台重新租用 workerID，期间 Valid 返回 false
+type WorkerLease struct {
+	rdb      redis.UniversalClient
+	token    string
+	ttl      time.Duration
+	expireAt atomic.Int64 // 本地视角的租约到期时间（unix纳秒），以发起请求的时间计算，偏保守
+
+	mu         sync.Mutex
+	slot       leaseSlot    // 当前租到的 workerID
+	generation atomic.Int64 // 每次重新租用加一，生成器据此切换 workerID
+	lastMs     atomic.Int64 // 本实例最后生成ID的毫秒时间戳，释放时留给下一个持有者
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// leaseSlot 租到的 workerID 及其键
+type leaseSlot struct {
+	workerID   int64
+	key        string
+	lastKey    string
+	prevLastMs int64 // 上一个持有者最后生成ID的毫秒时间戳（自 Epoch），0 表示没有记录
+}
+
+// AcquireWorkerLease 从随机位置开始依次尝试租用 workerID，成功后启动续期
+func AcquireWorkerLease(ctx context.Context, rdb redis.UniversalClient, ttl time.Duration) (*WorkerLease, error) {
+	host, _ := os.Hostname()
+	token := fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano())
+	slot, requestedAt, err := acquireSlot(ctx, rdb, token, ttl)
+	if err != nil {
+		return nil, err
+	}
+	l := &WorkerLease{
+		rdb:   rdb,
+		token: token,
+		ttl:   ttl,
+		slot:  slot,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	l.expireAt.Store(requestedAt.Add(ttl).UnixNano())
+	go l.keepalive()
+	return l, nil
+}
+
+// acquireSlot 从随机位置开始依次尝试 SetNX 租约键，返回租到的 workerID 与发起请求的时间
+func acquireSlot(ctx context.Context, rdb redis.UniversalClient, token string, ttl time.Duration) (leaseSlot, time.Time, error) {
+	start := rand.Int63n(MaxWorkerID + 1)
+	for i := int64(0); i <= MaxWorkerID; i++ {
+		id := (start + i) % (MaxWorkerID + 1)
+		key := fmt.Sprintf(workerKeyTemplate, id)
+		requestedAt := time.Now()
+		ok, err := rdb.SetNX(ctx, key, token, ttl).Result()
+		if err != nil {
+			return leaseSlot{}, time.Time{}, err
+		}
+		if !ok {
+			continue
+		}
+		lastKey := fmt.Sprintf(lastIssuedKeyTemplate, id)
+		prev, err := rdb.Get(ctx, lastKey).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			_ = rdb.Del(ctx, key).Err()
+			return leaseSlot{}, time.Time{}, err
+		}
+		return leaseSlot{workerID: id, key: key, lastKey: lastKey, prevLastMs: prev}, requestedAt, nil
+	}
+	return leaseSlot{}, time.Time{}, ErrNoWorkerID
+}
+
+// WorkerID 当前租到的 workerID
+func (l *WorkerLease) WorkerID() int64 {
+	return l.current().workerID
+}
+
+func (l *WorkerLease) current() leaseSlot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.slot
+}
+
+// Valid 租约是否仍在有效期内
+func (l *WorkerLease) Valid() bool {
+	return time.Now().UnixNano() < l.expireAt.Load()
+}
+
+// Close 停止续期并释放租约（租约已被他人占用时不删除），之后 Valid 返回 false
+func (l *WorkerLease) Close() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+		<-l.done
+		l.expireAt.Store(0)
+
+		slot := l.current()
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		keys := []string{slot.key, slot.lastKey}
+		if err := releaseLeaseScript.Run(ctx, l.rdb, keys, l.token, l.lastMs.Load(), l.ttl.Milliseconds()).Err(); err != nil {
+			// 释放失败时租约键在 ttl 后自然过期
+			logger.Warn("释放 workerID 租约失败", "worker_id", slot.workerID, "err", err)
+		}
+	})
+}
+
+// keepalive 每 ttl/3 续期一次；租约被他人占用时立即失效并重新租用
+func (l *WorkerLease) keepalive() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		slot := l.current()
+		requestedAt := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+		n, err := renewLeaseScript.Run(ctx, l.rdb, []string{slot.key}, l.token, l.ttl.Milliseconds()).Int64()
+		cancel()
+		if err != nil {
+			// 临时错误：保持原到期时间，下次继续尝试；到期后 Valid 返回 false，恢复后续期成功即重新生效
+			logger.Warn("workerID 租约续期失败", "worker_id", slot.workerID, "err", err)
+			continue
+		}
+		if n == 0 {
+			l.expireAt.Store(0)
+			logger.Error("workerID 租约已丢失，停止生成ID并重新租用", "worker_id", slot.workerID)
+			if !l.reacquire() {
+				return
+			}
+			continue
+		}
+		l.expireAt.Store(requestedAt.Add(l.ttl).UnixNano())
+	}
+}
+
+// reacquire 按退避重新租用 workerID，成功返回 true，Close 时返回 false
+// 生成器切换到新 workerID 后从「本实例与新 workerID 上一个持有者」两者中较晚的时间戳之后生成，时钟落后时按时钟回拨处理
+func (l *WorkerLease) reacquire() bool {
+	delay := l.ttl / 3
+	for {
+		select {
+		case <-l.stop:
+			return false
+		case <-time.After(delay):
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), l.ttl)
+		slot, requestedAt, err := acquireSlot(ctx, l.rdb, l.token, l.ttl)
+		cancel()
+		if err != nil {
+			logger.Warn("重新租用 workerID 失败", "retry_in", delay, "err", err)
+			delay = min(delay*2, l.ttl)
+			continue
+		}
+		l.mu.Lock()
+		l.slot = slot
+		l.mu.Unlock()
+		// 先切换 workerID 再生效：生成器看到租约有效时必然能读到新的 workerID
+		l.generation.Add(1)
+		l.expireAt.Store(requestedAt.Add(l.ttl).UnixNano())
+		logger.Info("已重新租用 workerID", "worker_id", slot.workerID)
+		return true
+	}
+}
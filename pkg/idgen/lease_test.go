@@ -0,0 +1,179 @@
+package idgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return mr, rdb
+}
+
+// occupyAllBut 占用除 free 以外的所有 workerID，使租约落在指定 workerID 上
+func occupyAllBut(t *testing.T, mr *miniredis.Miniredis, free int64) {
+	t.Helper()
+	for id := int64(0); id <= MaxWorkerID; id++ {
+		if id != free {
+			if err := mr.Set(fmt.Sprintf(workerKeyTemplate, id), "other"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// waitFor 轮询直到条件成立或超时
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestWorkerLeaseRenewal(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	occupyAllBut(t, mr, 5)
+	const ttl = 300 * time.Millisecond
+
+	lease, err := AcquireWorkerLease(context.Background(), rdb, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lease.Close()
+	key := fmt.Sprintf(workerKeyTemplate, 5)
+	if lease.WorkerID() != 5 || !lease.Valid() {
+		t.Fatalf("lease = (worker %d, valid %v), want (5, true)", lease.WorkerID(), lease.Valid())
+	}
+
+	// 模拟时间流逝：续期前剩余有效期缩短，续期后恢复为完整 ttl
+	mr.FastForward(200 * time.Millisecond)
+	if got := mr.TTL(key); got != 100*time.Millisecond {
+		t.Fatalf("ttl before renewal = %v, want 100ms", got)
+	}
+	if !waitFor(t, time.Second, func() bool { return mr.TTL(key) == ttl }) {
+		t.Fatalf("lease not renewed, ttl = %v", mr.TTL(key))
+	}
+	if !lease.Valid() {
+		t.Fatal("lease invalid after renewal")
+	}
+}
+
+func TestWorkerLeaseLost(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	occupyAllBut(t, mr, 9)
+
+	lease, err := AcquireWorkerLease(context.Background(), rdb, 150*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewLeasedGenerator(lease)
+	defer g.Close()
+	if _, err := g.NextID(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 租约被其他实例占用：续期失败后立即停止生成
+	if err := mr.Set(fmt.Sprintf(workerKeyTemplate, 9), "other"); err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(t, time.Second, func() bool { return !lease.Valid() }) {
+		t.Fatal("lease still valid after being taken over")
+	}
+	if _, err := g.NextID(); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("NextID err = %v, want ErrLeaseLost", err)
+	}
+	if err := g.Ping(); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Ping err = %v, want ErrLeaseLost", err)
+	}
+
+	// 有空闲 workerID 后在后台重新租用，生成器切换到新的 workerID
+	mr.Del(fmt.Sprintf(workerKeyTemplate, 4))
+	if !waitFor(t, 2*time.Second, lease.Valid) {
+		t.Fatal("lease not re-acquired")
+	}
+	id, err := g.NextID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, workerID, _ := Parse(id); workerID != 4 || g.WorkerID() != 4 || g.Ping() != nil {
+		t.Fatalf("after re-acquire worker id = %d (generator %d), want 4", workerID, g.WorkerID())
+	}
+
+	// 关闭时只释放自己的租约，不删除他人的租约
+	g.Close()
+	if got, _ := mr.Get(fmt.Sprintf(workerKeyTemplate, 9)); got != "other" {
+		t.Fatalf("lease key = %q after close, want other holder kept", got)
+	}
+	if mr.Exists(fmt.Sprintf(workerKeyTemplate, 4)) {
+		t.Fatal("re-acquired lease not released on close")
+	}
+}
+
+func TestWorkerLeaseReleaseOnClose(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	occupyAllBut(t, mr, 3)
+	ctx := context.Background()
+
+	lease, err := AcquireWorkerLease(ctx, rdb, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewLeasedGenerator(lease)
+	last, err := g.NextID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Close()
+
+	if mr.Exists(fmt.Sprintf(workerKeyTemplate, 3)) {
+		t.Fatal("lease key not deleted on close")
+	}
+	if _, err := g.NextID(); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("NextID after close err = %v, want ErrLeaseLost", err)
+	}
+
+	// 同一 workerID 可立即被复用，新持有者从上一个持有者最后的时间戳之后生成
+	next, err := AcquireWorkerLease(ctx, rdb, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g2 := NewLeasedGenerator(next)
+	defer g2.Close()
+	if next.WorkerID() != 3 {
+		t.Fatalf("worker id = %d, want 3", next.WorkerID())
+	}
+	id, err := g2.NextID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id <= last {
+		t.Fatalf("id %d from new holder not greater than last id %d of previous holder", id, last)
+	}
+
+	// 新持有者时钟落后超出回拨容忍时拒绝生成，而不是生成可能重复的ID
+	g2.Close()
+	again, err := AcquireWorkerLease(ctx, rdb, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g3 := NewLeasedGenerator(again)
+	defer g3.Close()
+	g3.now = func() time.Time { return time.Now().Add(-time.Second) }
+	if _, err := g3.NextID(); !errors.Is(err, ErrClockBackwards) {
+		t.Fatalf("NextID with lagging clock err = %v, want ErrClockBackwards", err)
+	}
+}
@@ -0,0 +1,151 @@
+// Package idgen 分布式 Snowflake 风格ID生成器
+//
+// ID 布局（63位正整数）：41位毫秒时间戳（自 Epoch 起）| 10位 workerID | 12位序列号
+// 单个 worker 每毫秒最多生成 4096 个ID，可用约 69 年。
+package idgen
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	workerBits   = 10
+	sequenceBits = 12
+
+	// MaxWorkerID workerID 取值上限（含）
+	MaxWorkerID  = 1<<workerBits - 1
+	maxSequence  = 1<<sequenceBits - 1
+	workerShift  = sequenceBits
+	timeShift    = sequenceBits + workerBits
+	maxBackwards = 10 * time.Millisecond // 可容忍的时钟回拨，范围内等待追平，超过则拒绝生成
+)
+
+// Epoch 时间戳起点 2024-01-01 00:00:00 UTC
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	// ErrInvalidWorkerID workerID 超出范围
+	ErrInvalidWorkerID = errors.New("idgen: worker id out of range")
+	// ErrClockBackwards 时钟回拨超过容忍范围
+	ErrClockBackwards = errors.New("idgen: clock moved backwards")
+	// ErrLeaseLost workerID 租约已失效，继续生成可能与其他实例冲突
+	ErrLeaseLost = errors.New("idgen: worker lease lost")
+)
+
+// Generator 单 worker 的ID生成器，并发安全
+type Generator struct {
+	mu       sync.Mutex
+	workerID int64
+	lastMs   int64
+	sequence int64
+	lease    *WorkerLease // 租约模式下非空，租约失效后拒绝生成
+	leaseGen int64        // 已切换到的租约代数，租约重新租用后切换 workerID
+	now      func() time.Time
+}
+
+// NewGenerator 使用固定 workerID 创建生成器（由部署方保证各实例不重复）
+func NewGenerator(workerID int64) (*Generator, error) {
+	if workerID < 0 || workerID > MaxWorkerID {
+		return nil, ErrInvalidWorkerID
+	}
+	return &Generator{workerID: workerID, now: time.Now}, nil
+}
+
+// NewLeasedGenerator 使用 Redis 租约分配的 workerID 创建生成器
+// 从上一个持有者最后生成ID的时间戳之后开始生成，本地时钟落后时按时钟回拨处理
+func NewLeasedGenerator(lease *WorkerLease) *Generator {
+	g := &Generator{lease: lease, now: time.Now}
+	g.switchLease()
+	return g
+}
+
+// WorkerID 当前生成器的 workerID
+func (g *Generator) WorkerID() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.workerID
+}
+
+// Ping 生成器是否可用（固定 workerID 时始终可用），供健康检查使用
+func (g *Generator) Ping() error {
+	if g.lease != nil && !g.lease.Valid() {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// switchLease 切换到租约当前的 workerID，需持有 g.mu（或尚未发布）
+func (g *Generator) switchLease() {
+	g.leaseGen = g.lease.generation.Load()
+	slot := g.lease.current()
+	g.workerID = slot.workerID
+	g.lastMs = max(g.lastMs, slot.prevLastMs)
+}
+
+// NextID 生成下一个ID
+// 时钟小幅回拨时等待追平，回拨超过 maxBackwards 返回 ErrClockBackwards；
+// 同一毫秒序列号用尽时等待下一毫秒
+func (g *Generator) NextID() (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.lease != nil {
+		if !g.lease.Valid() {
+			return 0, ErrLeaseLost
+		}
+		if g.lease.generation.Load() != g.leaseGen {
+			g.switchLease()
+		}
+	}
+
+	ms := g.currentMs()
+	if ms < g.lastMs {
+		behind := time.Duration(g.lastMs-ms) * time.Millisecond
+		if behind > maxBackwards {
+			return 0, ErrClockBackwards
+		}
+		time.Sleep(behind)
+		if ms = g.currentMs(); ms < g.lastMs {
+			return 0, ErrClockBackwards
+		}
+	}
+
+	if ms == g.lastMs {
+		g.sequence = (g.sequence + 1) & maxSequence
+		if g.sequence == 0 {
+			for ms <= g.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				ms = g.currentMs()
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastMs = ms
+
+	return ms<<timeShift | g.workerID<<workerShift | g.sequence, nil
+}
+
+func (g *Generator) currentMs() int64 {
+	return g.now().Sub(Epoch).Milliseconds()
+}
+
+// Parse 拆解ID，便于排查
+func Parse(id int64) (ts time.Time, workerID int64, sequence int64) {
+	ms := id >> timeShift
+	return Epoch.Add(time.Duration(ms) * time.Millisecond), (id >> workerShift) & MaxWorkerID, id & maxSequence
+}
+
+// Close 释放租约并留下最后生成ID的时间戳（固定 workerID 时无操作），之后 NextID 返回 ErrLeaseLost
+func (g *Generator) Close() {
+	if g.lease == nil {
+		return
+	}
+	// 持锁释放：释放后不会再生成ID，留下的时间戳即最后一个ID的时间戳
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.lease.lastMs.Store(g.lastMs)
+	g.lease.Close()
+}
@@ -0,0 +1,179 @@
+package idgen
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 按顺序返回预设时间，用完后停在最后一个
+type fakeClock struct {
+	mu    sync.Mutex
+	times []time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.times[0]
+	if len(c.times) > 1 {
+		c.times = c.times[1:]
+	}
+	return t
+}
+
+func newFakeGenerator(t *testing.T, workerID int64, times ...time.Time) *Generator {
+	t.Helper()
+	g, err := NewGenerator(workerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.now = (&fakeClock{times: times}).now
+	return g
+}
+
+func TestNextIDLayout(t *testing.T) {
+	at := Epoch.Add(123456789 * time.Millisecond)
+	tests := []struct {
+		name     string
+		workerID int64
+		calls    int // 同一毫秒内的第几次调用
+		wantSeq  int64
+	}{
+		{name: "first id of worker 0", workerID: 0, calls: 1, wantSeq: 0},
+		{name: "max worker id", workerID: MaxWorkerID, calls: 1, wantSeq: 0},
+		{name: "sequence increments within a millisecond", workerID: 42, calls: 3, wantSeq: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newFakeGenerator(t, tt.workerID, at)
+			var id int64
+			for i := 0; i < tt.calls; i++ {
+				var err error
+				if id, err = g.NextID(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want := int64(123456789)<<22 | tt.workerID<<12 | tt.wantSeq
+			if id != want {
+				t.Fatalf("id = %d, want %d", id, want)
+			}
+			ts, workerID, seq := Parse(id)
+			if !ts.Equal(at) || workerID != tt.workerID || seq != tt.wantSeq {
+				t.Fatalf("Parse = (%v, %d, %d), want (%v, %d, %d)", ts, workerID, seq, at, tt.workerID, tt.wantSeq)
+			}
+		})
+	}
+}
+
+func TestNewGeneratorRejectsInvalidWorkerID(t *testing.T) {
+	for _, id := range []int64{-1, MaxWorkerID + 1} {
+		if _, err := NewGenerator(id); !errors.Is(err, ErrInvalidWorkerID) {
+			t.Fatalf("NewGenerator(%d) err = %v, want ErrInvalidWorkerID", id, err)
+		}
+	}
+}
+
+func TestNextIDClockBackwards(t *testing.T) {
+	base := Epoch.Add(time.Hour)
+	ms := func(n int) time.Time { return base.Add(time.Duration(n) * time.Millisecond) }
+	tests := []struct {
+		name    string
+		times   []time.Time
+		wantErr error
+	}{
+		// 回拨 5ms（容忍范围内）：等待后时钟追平，继续生成更大的ID
+		{name: "within tolerance", times: []time.Time{ms(0), ms(1), ms(-4), ms(2)}},
+		// 回拨 5ms 且等待后仍未追平
+		{name: "not caught up after wait", times: []time.Time{ms(0), ms(1), ms(-4), ms(-3)}, wantErr: ErrClockBackwards},
+		// 回拨超过 maxBackwards 立即拒绝
+		{name: "beyond tolerance", times: []time.Time{ms(0), ms(1), ms(-50)}, wantErr: ErrClockBackwards},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newFakeGenerator(t, 1, tt.times...)
+			var last int64
+			for i := 0; i < 2; i++ {
+				id, err := g.NextID()
+				if err != nil {
+					t.Fatal(err)
+				}
+				last = id
+			}
+			id, err := g.NextID()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && id <= last {
+				t.Fatalf("id %d not greater than previous %d after clock rollback", id, last)
+			}
+		})
+	}
+}
+
+func TestNextIDSequenceOverflowWaitsNextMillisecond(t *testing.T) {
+	base := Epoch.Add(time.Hour)
+	times := make([]time.Time, 0, maxSequence+3)
+	for i := 0; i <= maxSequence+1; i++ {
+		times = append(times, base)
+	}
+	times = append(times, base.Add(time.Millisecond))
+	g := newFakeGenerator(t, 1, times...)
+
+	var last int64
+	for i := 0; i <= maxSequence+1; i++ {
+		id, err := g.NextID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id <= last {
+			t.Fatalf("id %d not greater than previous %d", id, last)
+		}
+		last = id
+	}
+	ts, _, seq := Parse(last)
+	if !ts.Equal(base.Add(time.Millisecond)) || seq != 0 {
+		t.Fatalf("overflow id = (%v, seq %d), want next millisecond with seq 0", ts, seq)
+	}
+}
+
+func TestNextIDUniqueConcurrent(t *testing.T) {
+	g, err := NewGenerator(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const workers, perWorker = 8, 5000
+	ids := make([][]int64, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				id, err := g.NextID()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				// 单个调用方看到的ID严格递增
+				if n := len(ids[w]); n > 0 && id <= ids[w][n-1] {
+					t.Errorf("id %d not greater than previous %d", id, ids[w][n-1])
+					return
+				}
+				ids[w] = append(ids[w], id)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[int64]bool, workers*perWorker)
+	for _, list := range ids {
+		for _, id := range list {
+			if seen[id] {
+				t.Fatalf("duplicate id %d", id)
+			}
+			seen[id] = true
+		}
+	}
+}
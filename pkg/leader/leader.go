@@ -0,0 +1,179 @@
+// Package leader 基于 Redis 租约的主节点选举
+//
+// 每次当选都会从计数器取得单调递增的 fencing token，租约键的值即为 token：
+// 续期、释放以及业务侧的写入校验都以 token 判断是否仍为当前任期，
+// 暂停后恢复的旧主节点持有的旧 token 会被拒绝。
+package leader
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/CCDD2022/seckill-system/pkg/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireScript 租约不存在时当选并取得新 token
+// KEYS[1]=租约键 KEYS[2]=token计数器 ARGV[1]=有效期毫秒
+var acquireScript = redis.NewScript(`
+    if redis.call('exists', KEYS[1]) == 1 then
+        return 0
+    end
+    local token = redis.call('incr', KEYS[2])
+    redis.call('set', KEYS[1], token, 'PX', ARGV[1])
+    return token
+`)
+
+// renewScript 仅当前任期可续期
+// KEYS[1]=租约键 ARGV[1]=token ARGV[2]=有效期毫秒
+var renewScript = redis.NewScript(`
+    if redis.call('get', KEYS[1]) == ARGV[1] then
+        return redis.call('pexpire', KEYS[1], ARGV[2])
+    end
+    return 0
+`)
+
+// releaseScript 仅当前任期可释放
+// KEYS[1]=租约键 ARGV[1]=token
+var releaseScript = redis.NewScript(`
+    if redis.call('get', KEYS[1]) == ARGV[1] then
+        return redis.call('del', KEYS[1])
+    end
+    return 0
+`)
+
+// advanceScript 将 token 计数器推进到不低于给定值
+// KEYS[1]=token计数器 ARGV[1]=下限
+var advanceScript = redis.NewScript(`
+    local current = tonumber(redis.call('get', KEYS[1]) or '0')
+    if current < tonumber(ARGV[1]) then
+        redis.call('set', KEYS[1], ARGV[1])
+    end
+    return 0
+`)
+
+// ElectedFunc 当选回调：推进存储侧 fence、回收上一任期的在途数据等；返回错误时放弃本次任期
+type ElectedFunc func(ctx context.Context, token int64) error
+
+// Elector 参与选举的一个实例
+type Elector struct {
+	rdb      redis.UniversalClient
+	name     string
+	ttl      time.Duration
+	token    atomic.Int64 // 当前任期 token，非主节点为0
+	expireAt atomic.Int64 // 本地视角的租约到期时间（unix纳秒），以发起请求的时间计算，偏保守
+}
+
+// NewElector 创建选举实例，租约键为 leader:<name>
+// 主节点失联后最长 ttl + ttl/3 内由其他实例接管
+func NewElector(rdb redis.UniversalClient, name string, ttl time.Duration) *Elector {
+	return &Elector{rdb: rdb, name: name, ttl: ttl}
+}
+
+// Key 租约键，业务侧可在 Lua 中比对其值与 token 实现 Redis 写入的 fencing
+func (e *Elector) Key() string {
+	return "leader:" + e.name
+}
+
+func (e *Elector) tokenKey() string {
+	return fmt.Sprintf("leader:%s:token", e.name)
+}
+
+// Advance 将 token 计数器推进到不低于 floor，用于 Redis 数据丢失后计数器落后于存储侧 fence 的情况：
+// 下一次当选取得的 token 即可高于 floor
+func (e *Elector) Advance(ctx context.Context, floor int64) error {
+	return advanceScript.Run(ctx, e.rdb, []string{e.tokenKey()}, floor).Err()
+}
+
+// Token 返回当前任期 token；非主节点或租约已过期时返回 false
+func (e *Elector) Token() (int64, bool) {
+	token := e.token.Load()
+	if token == 0 || time.Now().UnixNano() >= e.expireAt.Load() {
+		return 0, false
+	}
+	return token, true
+}
+
+// Run 参与选举直到 ctx 结束：非主节点每 ttl/3 尝试当选，主节点每 ttl/3 续期
+// 退出时释放租约，其他实例可立即接管
+func (e *Elector) Run(ctx context.Context, onElected ElectedFunc) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		if e.token.Load() == 0 {
+			e.tryAcquire(ctx, onElected)
+		} else {
+			e.renew(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			e.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Elector) tryAcquire(ctx context.Context, onElected ElectedFunc) {
+	requestedAt := time.Now()
+	token, err := acquireScript.Run(ctx, e.rdb, []string{e.Key(), e.tokenKey()}, e.ttl.Milliseconds()).Int64()
+	if err != nil {
+		logger.Warn("参与选举失败", "name", e.name, "err", err)
+		return
+	}
+	if token == 0 {
+		return
+	}
+	e.expireAt.Store(requestedAt.Add(e.ttl).UnixNano())
+	if onElected != nil {
+		if err := onElected(ctx, token); err != nil {
+			logger.Error("当选初始化失败，放弃本次任期", "name", e.name, "token", token, "err", err)
+			_ = releaseScript.Run(context.Background(), e.rdb, []string{e.Key()}, token).Err()
+			e.expireAt.Store(0)
+			return
+		}
+	}
+	e.token.Store(token)
+	logger.Info("当选主节点", "name", e.name, "token", token)
+}
+
+func (e *Elector) renew(ctx context.Context) {
+	token := e.token.Load()
+	requestedAt := time.Now()
+	n, err := renewScript.Run(ctx, e.rdb, []string{e.Key()}, token, e.ttl.Milliseconds()).Int64()
+	if err != nil {
+		// 临时错误：保持原到期时间，过期后 Token 自动失效
+		logger.Warn("主节点续期失败", "name", e.name, "token", token, "err", err)
+		if time.Now().UnixNano() >= e.expireAt.Load() {
+			e.stepDown(token)
+		}
+		return
+	}
+	if n == 0 {
+		e.stepDown(token)
+		return
+	}
+	e.expireAt.Store(requestedAt.Add(e.ttl).UnixNano())
+}
+
+func (e *Elector) stepDown(token int64) {
+	e.token.Store(0)
+	e.expireAt.Store(0)
+	logger.Warn("失去主节点身份", "name", e.name, "token", token)
+}
+
+func (e *Elector) release() {
+	token := e.token.Load()
+	if token == 0 {
+		return
+	}
+	e.token.Store(0)
+	e.expireAt.Store(0)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = releaseScript.Run(ctx, e.rdb, []string{e.Key()}, token).Err()
+}
@@ -0,0 +1,120 @@
+// Package metrics Prometheus 指标定义与采集工具
+//
+// 所有进程共用同一组指标定义（注册到默认 Registry），各进程只会产生自己用到的序列；
+// 网关在服务端口的 /metrics 暴露，其余进程通过 app.Runtime.ServeMetrics 单独监听。
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace 指标名前缀
+const Namespace = "seckill"
+
+// 秒杀结果
+const (
+	OutcomeSuccess       = "success"
+	OutcomeSoldOut       = "sold_out"
+	OutcomeLimitExceeded = "limit_exceeded"
+	OutcomeInactive      = "inactive" // 活动未开始或已结束
+	OutcomeInvalid       = "invalid"  // 参数错误、活动不存在
+	OutcomeSystemError   = "system_error"
+)
+
+var (
+	// HTTP（网关）：route 为 Gin 路由模板，未匹配路由记为空
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace, Name: "http_requests_total", Help: "HTTP requests by route and status code.",
+	}, []string{"method", "route", "code"})
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace, Name: "http_request_duration_seconds", Help: "HTTP request latency by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// gRPC 服务端：method 为完整方法名（/pkg.Service/Method）
+	GRPCRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace, Name: "grpc_server_handled_total", Help: "gRPC requests by method and status code.",
+	}, []string{"method", "code"})
+	GRPCDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace, Name: "grpc_server_handling_seconds", Help: "gRPC request latency by method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+
+	// SeckillOutcomes 秒杀请求结果
+	SeckillOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace, Name: "outcomes_total", Help: "Seckill requests by outcome.",
+	}, []string{"outcome"})
+
+	// MQ 发布与确认：result 为 ok / error（发布）与 ack / nack / returned / lost / timeout（确认）
+	MQPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace, Name: "mq_published_total", Help: "Messages published to RabbitMQ.",
+	}, []string{"exchange", "routing_key", "result"})
+	MQConfirms = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace, Name: "mq_publish_confirms_total", Help: "Publisher confirms by result.",
+	}, []string{"result"})
+
+	// 本地溢写日志：未重放的消息数与字节数，以及多次被 Broker 拒绝后移入死信文件的消息数
+	MQSpillDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace, Name: "mq_spill_depth", Help: "Messages in the local spill log waiting for replay.",
+	})
+	MQSpillBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace, Name: "mq_spill_bytes", Help: "Bytes in the local spill log waiting for replay.",
+	})
+	MQSpillDeadLettered = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace, Name: "mq_spill_dead_lettered_total", Help: "Spill entries moved to the dead-letter file after repeated broker rejections.",
+	})
+
+	// MQConsumeDuration 消息从交给处理函数到确认/拒绝的耗时，result 为 ack / nack / reject
+	MQConsumeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace, Name: "mq_consume_duration_seconds", Help: "Time from delivery to ack/nack by queue.",
+		Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"queue", "result"})
+
+	// DLQArrivals 进入死信队列的消息，queue 为原队列，reason 为 rejected / expired / maxlen
+	DLQArrivals = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace, Name: "dlq_arrivals_total", Help: "Dead letters received by original queue and reason.",
+	}, []string{"queue", "reason"})
+
+	// ReconcileBatchSize 库存回写每批弹出的脏id数
+	ReconcileBatchSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace, Name: "reconciler_flush_batch_size", Help: "Dirty ids popped per stock flush.",
+		Buckets: []float64{1, 5, 10, 50, 100, 250, 500, 1000},
+	}, []string{"table"})
+
+	// guarded 回写拒绝的未授权上调：次数与被拒绝的数量
+	ReconcileFlushRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace, Name: "reconciler_flush_rejected_total", Help: "Unauthorised stock increases rejected by guarded flush.",
+	}, []string{"table"})
+	ReconcileFlushRejectedQuantity = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace, Name: "reconciler_flush_rejected_quantity_total", Help: "Stock quantity rejected by guarded flush.",
+	}, []string{"table"})
+
+	// 全量对账：轮次、修复与升级为累计值，检查数、偏差数与各对象偏差为最近一轮的结果
+	AuditRuns = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace, Name: "reconciler_audit_runs_total", Help: "Completed stock audit runs.",
+	})
+	AuditChecked = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace, Name: "reconciler_audit_checked", Help: "Products and activities checked by the last audit run.",
+	})
+	AuditDrifted = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace, Name: "reconciler_audit_drifted", Help: "Confirmed drifts found by the last audit run.",
+	})
+	AuditRepaired = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace, Name: "reconciler_audit_repaired_total", Help: "Drifts repaired automatically.",
+	})
+	AuditEscalated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace, Name: "reconciler_audit_escalated_total", Help: "Drifts escalated for manual handling.",
+	})
+	AuditDrift = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace, Name: "reconciler_audit_drift", Help: "Drift of each object confirmed by the last audit run (authoritative - expected).",
+	}, []string{"kind", "id"})
+)
+
+// Handler Prometheus 抓取接口
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
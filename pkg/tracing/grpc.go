@@ -0,0 +1,20 @@
+package tracing
+
+import (
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
+	"google.golang.org/grpc"
+)
+
+// 健康检查（探针每几秒一次）不产生 span
+var grpcFilter = otelgrpc.WithFilter(filters.Not(filters.HealthCheck()))
+
+// ServerOption gRPC 服务端埋点：从 metadata 提取上游链路并为每个 RPC 创建服务端 span
+func ServerOption() grpc.ServerOption {
+	return grpc.StatsHandler(otelgrpc.NewServerHandler(grpcFilter))
+}
+
+// DialOption gRPC 客户端埋点：为每个 RPC 创建客户端 span 并把链路注入 metadata
+func DialOption() grpc.DialOption {
+	return grpc.WithStatsHandler(otelgrpc.NewClientHandler(grpcFilter))
+}
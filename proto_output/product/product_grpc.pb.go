@@ -27,6 +27,7 @@ const (
 	ProductService_ListActiveSeckillProducts_FullMethodName = "/product.ProductService/ListActiveSeckillProducts"
 	ProductService_DeductStock_FullMethodName               = "/product.ProductService/DeductStock"
 	ProductService_ReturnStock_FullMethodName               = "/product.ProductService/ReturnStock"
+	ProductService_ListStockLogs_FullMethodName             = "/product.ProductService/ListStockLogs"
 )
 
 // ProductServiceClient is the client API for ProductService service.
@@ -45,6 +46,8 @@ type ProductServiceClient interface {
 	// 库存操作
 	DeductStock(ctx context.Context, in *DeductStockRequest, opts ...grpc.CallOption) (*DeductStockResponse, error)
 	ReturnStock(ctx context.Context, in *ReturnStockRequest, opts ...grpc.CallOption) (*ReturnStockResponse, error)
+	// 库存变更流水（管理员）
+	ListStockLogs(ctx context.Context, in *ListStockLogsRequest, opts ...grpc.CallOption) (*ListStockLogsResponse, error)
 }
 
 type productServiceClient struct {
@@ -127,6 +130,15 @@ func (c *productServiceClient) ReturnStock(ctx context.Context, in *ReturnStockR
 	return out, nil
 }
 
+func (c *productServiceClient) ListStockLogs(ctx context.Context, in *ListStockLogsRequest, opts ...grpc.CallOption) (*ListStockLogsResponse, error) {
+	out := new(ListStockLogsResponse)
+	err := c.cc.Invoke(ctx, ProductService_ListStockLogs_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ProductServiceServer is the server API for ProductService service.
 // All implementations must embed UnimplementedProductServiceServer
 // for forward compatibility
@@ -143,6 +155,8 @@ type ProductServiceServer interface {
 	// 库存操作
 	DeductStock(context.Context, *DeductStockRequest) (*DeductStockResponse, error)
 	ReturnStock(context.Context, *ReturnStockRequest) (*ReturnStockResponse, error)
+	// 库存变更流水（管理员）
+	ListStockLogs(context.Context, *ListStockLogsRequest) (*ListStockLogsResponse, error)
 	mustEmbedUnimplementedProductServiceServer()
 }
 
@@ -174,6 +188,9 @@ func (UnimplementedProductServiceServer) DeductStock(context.Context, *DeductSto
 func (UnimplementedProductServiceServer) ReturnStock(context.Context, *ReturnStockRequest) (*ReturnStockResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ReturnStock not implemented")
 }
+func (UnimplementedProductServiceServer) ListStockLogs(context.Context, *ListStockLogsRequest) (*ListStockLogsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListStockLogs not implemented")
+}
 func (UnimplementedProductServiceServer) mustEmbedUnimplementedProductServiceServer() {}
 
 // UnsafeProductServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -331,6 +348,24 @@ func _ProductService_ReturnStock_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ProductService_ListStockLogs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListStockLogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProductServiceServer).ListStockLogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProductService_ListStockLogs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProductServiceServer).ListStockLogs(ctx, req.(*ListStockLogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ProductService_ServiceDesc is the grpc.ServiceDesc for ProductService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -370,6 +405,10 @@ var ProductService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ReturnStock",
 			Handler:    _ProductService_ReturnStock_Handler,
 		},
+		{
+			MethodName: "ListStockLogs",
+			Handler:    _ProductService_ListStockLogs_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/product.proto",
@@ -19,7 +19,13 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	SeckillService_ExecuteSeckill_FullMethodName = "/seckill.SeckillService/ExecuteSeckill"
+	SeckillService_ExecuteSeckill_FullMethodName     = "/seckill.SeckillService/ExecuteSeckill"
+	SeckillService_QuerySeckillResult_FullMethodName = "/seckill.SeckillService/QuerySeckillResult"
+	SeckillService_CreateActivity_FullMethodName     = "/seckill.SeckillService/CreateActivity"
+	SeckillService_UpdateActivity_FullMethodName     = "/seckill.SeckillService/UpdateActivity"
+	SeckillService_DeleteActivity_FullMethodName     = "/seckill.SeckillService/DeleteActivity"
+	SeckillService_GetActivity_FullMethodName        = "/seckill.SeckillService/GetActivity"
+	SeckillService_ListActivities_FullMethodName     = "/seckill.SeckillService/ListActivities"
 )
 
 // SeckillServiceClient is the client API for SeckillService service.
@@ -27,6 +33,14 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type SeckillServiceClient interface {
 	ExecuteSeckill(ctx context.Context, in *SeckillRequest, opts ...grpc.CallOption) (*SeckillResponse, error)
+	// 根据秒杀凭证(ticket)查询异步下单结果
+	QuerySeckillResult(ctx context.Context, in *QuerySeckillResultRequest, opts ...grpc.CallOption) (*QuerySeckillResultResponse, error)
+	// 秒杀活动管理 增删改是管理员操作
+	CreateActivity(ctx context.Context, in *CreateActivityRequest, opts ...grpc.CallOption) (*CreateActivityResponse, error)
+	UpdateActivity(ctx context.Context, in *UpdateActivityRequest, opts ...grpc.CallOption) (*UpdateActivityResponse, error)
+	DeleteActivity(ctx context.Context, in *DeleteActivityRequest, opts ...grpc.CallOption) (*DeleteActivityResponse, error)
+	GetActivity(ctx context.Context, in *GetActivityRequest, opts ...grpc.CallOption) (*GetActivityResponse, error)
+	ListActivities(ctx context.Context, in *ListActivitiesRequest, opts ...grpc.CallOption) (*ListActivitiesResponse, error)
 }
 
 type seckillServiceClient struct {
@@ -46,11 +60,73 @@ func (c *seckillServiceClient) ExecuteSeckill(ctx context.Context, in *SeckillRe
 	return out, nil
 }
 
+func (c *seckillServiceClient) QuerySeckillResult(ctx context.Context, in *QuerySeckillResultRequest, opts ...grpc.CallOption) (*QuerySeckillResultResponse, error) {
+	out := new(QuerySeckillResultResponse)
+	err := c.cc.Invoke(ctx, SeckillService_QuerySeckillResult_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *seckillServiceClient) CreateActivity(ctx context.Context, in *CreateActivityRequest, opts ...grpc.CallOption) (*CreateActivityResponse, error) {
+	out := new(CreateActivityResponse)
+	err := c.cc.Invoke(ctx, SeckillService_CreateActivity_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *seckillServiceClient) UpdateActivity(ctx context.Context, in *UpdateActivityRequest, opts ...grpc.CallOption) (*UpdateActivityResponse, error) {
+	out := new(UpdateActivityResponse)
+	err := c.cc.Invoke(ctx, SeckillService_UpdateActivity_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *seckillServiceClient) DeleteActivity(ctx context.Context, in *DeleteActivityRequest, opts ...grpc.CallOption) (*DeleteActivityResponse, error) {
+	out := new(DeleteActivityResponse)
+	err := c.cc.Invoke(ctx, SeckillService_DeleteActivity_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *seckillServiceClient) GetActivity(ctx context.Context, in *GetActivityRequest, opts ...grpc.CallOption) (*GetActivityResponse, error) {
+	out := new(GetActivityResponse)
+	err := c.cc.Invoke(ctx, SeckillService_GetActivity_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *seckillServiceClient) ListActivities(ctx context.Context, in *ListActivitiesRequest, opts ...grpc.CallOption) (*ListActivitiesResponse, error) {
+	out := new(ListActivitiesResponse)
+	err := c.cc.Invoke(ctx, SeckillService_ListActivities_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // SeckillServiceServer is the server API for SeckillService service.
 // All implementations must embed UnimplementedSeckillServiceServer
 // for forward compatibility
 type SeckillServiceServer interface {
 	ExecuteSeckill(context.Context, *SeckillRequest) (*SeckillResponse, error)
+	// 根据秒杀凭证(ticket)查询异步下单结果
+	QuerySeckillResult(context.Context, *QuerySeckillResultRequest) (*QuerySeckillResultResponse, error)
+	// 秒杀活动管理 增删改是管理员操作
+	CreateActivity(context.Context, *CreateActivityRequest) (*CreateActivityResponse, error)
+	UpdateActivity(context.Context, *UpdateActivityRequest) (*UpdateActivityResponse, error)
+	DeleteActivity(context.Context, *DeleteActivityRequest) (*DeleteActivityResponse, error)
+	GetActivity(context.Context, *GetActivityRequest) (*GetActivityResponse, error)
+	ListActivities(context.Context, *ListActivitiesRequest) (*ListActivitiesResponse, error)
 	mustEmbedUnimplementedSeckillServiceServer()
 }
 
@@ -61,6 +137,24 @@ type UnimplementedSeckillServiceServer struct {
 func (UnimplementedSeckillServiceServer) ExecuteSeckill(context.Context, *SeckillRequest) (*SeckillResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ExecuteSeckill not implemented")
 }
+func (UnimplementedSeckillServiceServer) QuerySeckillResult(context.Context, *QuerySeckillResultRequest) (*QuerySeckillResultResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QuerySeckillResult not implemented")
+}
+func (UnimplementedSeckillServiceServer) CreateActivity(context.Context, *CreateActivityRequest) (*CreateActivityResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateActivity not implemented")
+}
+func (UnimplementedSeckillServiceServer) UpdateActivity(context.Context, *UpdateActivityRequest) (*UpdateActivityResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateActivity not implemented")
+}
+func (UnimplementedSeckillServiceServer) DeleteActivity(context.Context, *DeleteActivityRequest) (*DeleteActivityResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteActivity not implemented")
+}
+func (UnimplementedSeckillServiceServer) GetActivity(context.Context, *GetActivityRequest) (*GetActivityResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetActivity not implemented")
+}
+func (UnimplementedSeckillServiceServer) ListActivities(context.Context, *ListActivitiesRequest) (*ListActivitiesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListActivities not implemented")
+}
 func (UnimplementedSeckillServiceServer) mustEmbedUnimplementedSeckillServiceServer() {}
 
 // UnsafeSeckillServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -92,6 +186,114 @@ func _SeckillService_ExecuteSeckill_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _SeckillService_QuerySeckillResult_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QuerySeckillResultRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SeckillServiceServer).QuerySeckillResult(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SeckillService_QuerySeckillResult_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SeckillServiceServer).QuerySeckillResult(ctx, req.(*QuerySeckillResultRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SeckillService_CreateActivity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateActivityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SeckillServiceServer).CreateActivity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SeckillService_CreateActivity_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SeckillServiceServer).CreateActivity(ctx, req.(*CreateActivityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SeckillService_UpdateActivity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateActivityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SeckillServiceServer).UpdateActivity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SeckillService_UpdateActivity_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SeckillServiceServer).UpdateActivity(ctx, req.(*UpdateActivityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SeckillService_DeleteActivity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteActivityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SeckillServiceServer).DeleteActivity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SeckillService_DeleteActivity_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SeckillServiceServer).DeleteActivity(ctx, req.(*DeleteActivityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SeckillService_GetActivity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetActivityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SeckillServiceServer).GetActivity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SeckillService_GetActivity_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SeckillServiceServer).GetActivity(ctx, req.(*GetActivityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SeckillService_ListActivities_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListActivitiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SeckillServiceServer).ListActivities(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SeckillService_ListActivities_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SeckillServiceServer).ListActivities(ctx, req.(*ListActivitiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // SeckillService_ServiceDesc is the grpc.ServiceDesc for SeckillService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -103,6 +305,30 @@ var SeckillService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ExecuteSeckill",
 			Handler:    _SeckillService_ExecuteSeckill_Handler,
 		},
+		{
+			MethodName: "QuerySeckillResult",
+			Handler:    _SeckillService_QuerySeckillResult_Handler,
+		},
+		{
+			MethodName: "CreateActivity",
+			Handler:    _SeckillService_CreateActivity_Handler,
+		},
+		{
+			MethodName: "UpdateActivity",
+			Handler:    _SeckillService_UpdateActivity_Handler,
+		},
+		{
+			MethodName: "DeleteActivity",
+			Handler:    _SeckillService_DeleteActivity_Handler,
+		},
+		{
+			MethodName: "GetActivity",
+			Handler:    _SeckillService_GetActivity_Handler,
+		},
+		{
+			MethodName: "ListActivities",
+			Handler:    _SeckillService_ListActivities_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/seckill.proto",